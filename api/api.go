@@ -14,6 +14,7 @@ func Start(cfg *config.APIConfigInfo, bc *blockchain.Blockchain, tp *txpool.TxPo
 	go greeter.RunRPC()
 
 	blockChian = bc
+	txPool = tp
 	server := &Server{cfg.WEBConfig.Address, fasthttprouter.Router{}}
 	server.Run()
 }
@@ -62,17 +62,17 @@ func (g *Greeter) RunRPC() {
 			zap.Error(err), zap.String("cert file", g.tls.certFile), zap.String("key file", g.tls.keyFile))
 		os.Exit(-1)
 	}
-	server := grpc.NewServer(grpc.Creds(creds), grpc.UnaryInterceptor(ipInterceptor))
+	server := grpc.NewServer(grpc.Creds(creds), grpc.UnaryInterceptor(ipInterceptor), grpc.StreamInterceptor(ipStreamInterceptor))
 	message.RegisterGreeterServer(server, g)
 	server.Serve(lis)
 }
 
 func txToMsgTxAndOrder(tx *transaction.Transaction) (msgTx message.Tx) {
 	msgTx.Hash = hex.EncodeToString(tx.Hash)
-	msgTx.From = string(tx.From.Bytes())
+	msgTx.From = tx.From.String()
 	msgTx.Amount = tx.Amount
 	msgTx.Nonce = tx.Nonce
-	msgTx.To = string(tx.To.Bytes())
+	msgTx.To = tx.To.String()
 	msgTx.Signature = hex.EncodeToString(tx.Signature)
 	msgTx.Time = tx.Time
 	msgTx.Script = tx.Script
@@ -82,10 +82,10 @@ func txToMsgTxAndOrder(tx *transaction.Transaction) (msgTx message.Tx) {
 
 func txToMsgTx(tx *transaction.Transaction) (msgTx message.Tx) {
 	msgTx.Hash = hex.EncodeToString(tx.Hash)
-	msgTx.From = string(tx.From.Bytes())
+	msgTx.From = tx.From.String()
 	msgTx.Amount = tx.Amount
 	msgTx.Nonce = tx.Nonce
-	msgTx.To = string(tx.To.Bytes())
+	msgTx.To = tx.To.String()
 	msgTx.Signature = hex.EncodeToString(tx.Signature)
 	msgTx.Time = tx.Time
 	msgTx.Script = tx.Script
@@ -94,7 +94,11 @@ func txToMsgTx(tx *transaction.Transaction) (msgTx message.Tx) {
 
 func (s *Greeter) GetBalance(ctx context.Context, in *message.ReqBalance) (*message.ResBalance, error) {
 
-	balance, err := s.Bc.GetBalance([]byte(in.Address))
+	addr, err := types.StringToAddress(in.Address)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "address %s: %v", in.Address, err)
+	}
+	balance, err := s.Bc.GetBalance(addr.Bytes())
 	if err != nil {
 		logger.Error("s.Bc.GetBalance", zap.Error(err), zap.String("address", in.Address))
 	}
@@ -150,7 +154,11 @@ func (s *Greeter) GetBlockByHash(ctx context.Context, in *message.ReqBlockByHash
 }
 
 func (s *Greeter) GetTxsByAddr(ctx context.Context, in *message.ReqTx) (*message.ResposeTxs, error) {
-	txs, err := s.Bc.GetTransactionByAddr([]byte(in.Address), 0, 9)
+	addr, err := types.StringToAddress(in.Address)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "address %s: %v", in.Address, err)
+	}
+	txs, err := s.Bc.GetTransactionByAddr(addr.Bytes(), 0, 9)
 	if err != nil {
 		logger.Error("s.Bc.GetTransactionByAddr", zap.Error(err))
 		return nil, err
@@ -181,7 +189,11 @@ func (s *Greeter) GetTxByHash(ctx context.Context, in *message.ReqTxByHash) (*me
 }
 
 func (s *Greeter) GetAddressNonceAt(ctx context.Context, in *message.ReqNonce) (*message.ResposeNonce, error) {
-	nonce, err := s.Bc.GetNonce([]byte(in.Address))
+	addr, err := types.StringToAddress(in.Address)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "address %s: %v", in.Address, err)
+	}
+	nonce, err := s.Bc.GetNonce(addr.Bytes())
 	if err != nil {
 		logger.Error("s.Bc.GetNonce", zap.Error(err), zap.String("address", in.Address))
 		return nil, grpc.Errorf(codes.InvalidArgument, "address %s", in.Address)
@@ -214,7 +226,7 @@ func (s *Greeter) SendTransaction(ctx context.Context, in *message.ReqTransactio
 		return nil, grpc.Errorf(codes.InvalidArgument, "private key:%s", in.Priv)
 	}
 
-	tx := transaction.NewTransaction(in.Nonce, in.Amount, *from, *to)
+	tx := transaction.NewTransaction(in.Nonce, in.Amount, *from, *to, transaction.WithChainID(s.Bc.ChainID()))
 
 	tx.Sgin(priv)
 
@@ -223,12 +235,77 @@ func (s *Greeter) SendTransaction(ctx context.Context, in *message.ReqTransactio
 		return nil, grpc.Errorf(codes.InvalidArgument, "data error")
 	}
 
-	s.n.Broadcast(tx)
+	s.n.Broadcast(node.MsgTx, tx.Serialize())
 	hash := hex.EncodeToString(tx.Hash)
 
 	return &message.ResTransaction{Hash: hash}, nil
 }
 
+// SendRawTransaction 接收客户端签名后的交易，私钥不需要发送到节点
+func (s *Greeter) SendRawTransaction(ctx context.Context, in *message.ReqRawTransaction) (*message.ResRawTransaction, error) {
+	tx, err := transaction.Deserialize(in.Tx)
+	if err != nil {
+		logger.Info("Failed to decode raw transaction", zap.Error(err))
+		return &message.ResRawTransaction{Code: message.TxErrorCode_TX_INVALID_ENCODING, Message: err.Error()}, nil
+	}
+	hash := hex.EncodeToString(tx.Hash)
+
+	//币基交易只能由出块节点生成
+	if tx.IsCoinBaseTransaction() {
+		return &message.ResRawTransaction{Hash: hash, Code: message.TxErrorCode_TX_REJECTED, Message: "coinbase transaction"}, nil
+	}
+	if !tx.Verify() {
+		if tx.MultiSig != nil {
+			return &message.ResRawTransaction{Hash: hash, Code: message.TxErrorCode_TX_MULTISIG, Message: txpool.ErrMultiSig.Error()}, nil
+		}
+		return &message.ResRawTransaction{Hash: hash, Code: message.TxErrorCode_TX_BAD_SIGNATURE, Message: txpool.ErrSignature.Error()}, nil
+	}
+
+	if err := s.tp.Add(tx, s.Bc); err != nil {
+		logger.Info("Failed to add raw transaction", zap.Error(err), zap.String("hash", hash))
+		return &message.ResRawTransaction{Hash: hash, Code: txErrorCode(err), Message: err.Error()}, nil
+	}
+
+	s.n.Broadcast(node.MsgTx, tx.Serialize())
+	return &message.ResRawTransaction{Hash: hash, Code: message.TxErrorCode_TX_OK}, nil
+}
+
+func txErrorCode(err error) message.TxErrorCode {
+	switch err {
+	case txpool.ErrSignature:
+		return message.TxErrorCode_TX_BAD_SIGNATURE
+	case txpool.ErrMultiSig:
+		return message.TxErrorCode_TX_MULTISIG
+	case txpool.ErrNonceTooLow:
+		return message.TxErrorCode_TX_NONCE_TOO_LOW
+	case txpool.ErrBalance:
+		return message.TxErrorCode_TX_INSUFFICIENT_BALANCE
+	case txpool.ErrChainID, txpool.ErrLegacyTx:
+		return message.TxErrorCode_TX_WRONG_CHAIN_ID
+	case txpool.ErrTxVersion:
+		return message.TxErrorCode_TX_UNSUPPORTED_VERSION
+	case txpool.ErrAddress:
+		return message.TxErrorCode_TX_INVALID_ADDRESS
+	case txpool.ErrAmount:
+		return message.TxErrorCode_TX_AMOUNT_TOO_SMALL
+	case txpool.ErrFee:
+		return message.TxErrorCode_TX_FEE_TOO_LOW
+	case txpool.ErrKnownTx:
+		return message.TxErrorCode_TX_ALREADY_KNOWN
+	case txpool.ErrUnderpriced:
+		return message.TxErrorCode_TX_UNDERPRICED
+	case txpool.ErrNonceGap:
+		return message.TxErrorCode_TX_NONCE_GAP
+	case txpool.ErrQueueFull:
+		return message.TxErrorCode_TX_QUEUE_FULL
+	case txpool.ErrAccountLimit:
+		return message.TxErrorCode_TX_ACCOUNT_LIMIT
+	case txpool.ErrPoolFull:
+		return message.TxErrorCode_TX_POOL_FULL
+	}
+	return message.TxErrorCode_TX_REJECTED
+}
+
 func (s *Greeter) CreateAddr(ctx context.Context, in *message.ReqCreateAddr) (*message.RespCreateAddr, error) {
 	wallet := types.NewWallet()
 	return &message.RespCreateAddr{Address: wallet.Address, Privkey: util.Encode(wallet.PrivateKey)}, nil
@@ -251,6 +328,41 @@ func (s *Greeter) GetAddrByPriv(ctx context.Context, in *message.ReqAddrByPriv)
 	if len(privBytes) != 64 {
 		logger.Info("private key", zap.String("in.Priv", in.Priv))
 	}
-	addr := util.PubtoAddr(privBytes[32:])
+	addr := types.PublicKeyToAddress(privBytes[32:])
 	return &message.RespAddrByPriv{Addr: addr}, nil
 }
+
+// SubscribeTxEvents 推送交易池事件，可以按发送地址或交易哈希过滤
+func (s *Greeter) SubscribeTxEvents(in *message.ReqTxEvents, stream message.Greeter_SubscribeTxEventsServer) error {
+	address, err := normalizeAddress(in.Address)
+	if err != nil {
+		return grpc.Errorf(codes.InvalidArgument, "address %s: %v", in.Address, err)
+	}
+	sub := s.tp.SubscribeEvents()
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case ev := <-sub.C:
+			if !matchTxEvent(ev, address, in.Hash) {
+				continue
+			}
+			view := changeTxEvent(ev)
+			msg := &message.TxEvent{
+				Seq:         view.Seq,
+				Type:        view.Type,
+				Hash:        view.Hash,
+				From:        view.From,
+				Nonce:       view.Nonce,
+				Reason:      view.Reason,
+				Height:      view.Height,
+				Replacement: view.Replacement,
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
@@ -33,9 +33,24 @@ func loadWhiteList() map[string]struct{} {
 // UnaryServerInterceptor 将超过限制的ip拦截
 //var interceptor grpc.UnaryServerInterceptor
 func ipInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	if err := limitIP(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// ipStreamInterceptor 流式调用在建立时同样按ip限制
+func ipStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := limitIP(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func limitIP(ctx context.Context) error {
 	p, ok := peer.FromContext(ctx)
 	if !ok {
-		return nil, grpc.Errorf(codes.Unavailable, "context information error")
+		return grpc.Errorf(codes.Unavailable, "context information error")
 	}
 
 	ipWhiteList := loadWhiteList()
@@ -45,9 +60,8 @@ func ipInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerI
 		limiter := ipLimiter.GetLimiter(ip)
 		if !limiter.Allow() {
 			logger.Debug("ip limited", zap.String("ip", ip))
-			return nil, grpc.Errorf(codes.Unavailable, "request too frequently")
+			return grpc.Errorf(codes.Unavailable, "request too frequently")
 		}
 	}
-
-	return handler(ctx, req)
+	return nil
 }
@@ -24,6 +24,80 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+// 交易被拒绝的原因
+type TxErrorCode int32
+
+const (
+	TxErrorCode_TX_OK                   TxErrorCode = 0
+	TxErrorCode_TX_INVALID_ENCODING     TxErrorCode = 1
+	TxErrorCode_TX_BAD_SIGNATURE        TxErrorCode = 2
+	TxErrorCode_TX_NONCE_TOO_LOW        TxErrorCode = 3
+	TxErrorCode_TX_INSUFFICIENT_BALANCE TxErrorCode = 4
+	TxErrorCode_TX_WRONG_CHAIN_ID       TxErrorCode = 5
+	TxErrorCode_TX_UNSUPPORTED_VERSION  TxErrorCode = 6
+	TxErrorCode_TX_INVALID_ADDRESS      TxErrorCode = 7
+	TxErrorCode_TX_AMOUNT_TOO_SMALL     TxErrorCode = 8
+	TxErrorCode_TX_FEE_TOO_LOW          TxErrorCode = 9
+	TxErrorCode_TX_ALREADY_KNOWN        TxErrorCode = 10
+	TxErrorCode_TX_UNDERPRICED          TxErrorCode = 11
+	TxErrorCode_TX_NONCE_GAP            TxErrorCode = 12
+	TxErrorCode_TX_QUEUE_FULL           TxErrorCode = 13
+	TxErrorCode_TX_ACCOUNT_LIMIT        TxErrorCode = 14
+	TxErrorCode_TX_POOL_FULL            TxErrorCode = 15
+	TxErrorCode_TX_REJECTED             TxErrorCode = 16
+	TxErrorCode_TX_MULTISIG             TxErrorCode = 17
+)
+
+var TxErrorCode_name = map[int32]string{
+	0:  "TX_OK",
+	1:  "TX_INVALID_ENCODING",
+	2:  "TX_BAD_SIGNATURE",
+	3:  "TX_NONCE_TOO_LOW",
+	4:  "TX_INSUFFICIENT_BALANCE",
+	5:  "TX_WRONG_CHAIN_ID",
+	6:  "TX_UNSUPPORTED_VERSION",
+	7:  "TX_INVALID_ADDRESS",
+	8:  "TX_AMOUNT_TOO_SMALL",
+	9:  "TX_FEE_TOO_LOW",
+	10: "TX_ALREADY_KNOWN",
+	11: "TX_UNDERPRICED",
+	12: "TX_NONCE_GAP",
+	13: "TX_QUEUE_FULL",
+	14: "TX_ACCOUNT_LIMIT",
+	15: "TX_POOL_FULL",
+	16: "TX_REJECTED",
+	17: "TX_MULTISIG",
+}
+
+var TxErrorCode_value = map[string]int32{
+	"TX_OK":                   0,
+	"TX_INVALID_ENCODING":     1,
+	"TX_BAD_SIGNATURE":        2,
+	"TX_NONCE_TOO_LOW":        3,
+	"TX_INSUFFICIENT_BALANCE": 4,
+	"TX_WRONG_CHAIN_ID":       5,
+	"TX_UNSUPPORTED_VERSION":  6,
+	"TX_INVALID_ADDRESS":      7,
+	"TX_AMOUNT_TOO_SMALL":     8,
+	"TX_FEE_TOO_LOW":          9,
+	"TX_ALREADY_KNOWN":        10,
+	"TX_UNDERPRICED":          11,
+	"TX_NONCE_GAP":            12,
+	"TX_QUEUE_FULL":           13,
+	"TX_ACCOUNT_LIMIT":        14,
+	"TX_POOL_FULL":            15,
+	"TX_REJECTED":             16,
+	"TX_MULTISIG":             17,
+}
+
+func (x TxErrorCode) String() string {
+	return proto.EnumName(TxErrorCode_name, int32(x))
+}
+
+func (TxErrorCode) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_33c57e4bae7b9afd, []int{0}
+}
+
 type Tx struct {
 	Nonce                uint64   `protobuf:"varint,1,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
 	Amount               uint64   `protobuf:"varint,2,opt,name=Amount,proto3" json:"Amount,omitempty"`
@@ -940,7 +1014,245 @@ func (m *RespAddrByPriv) GetAddr() string {
 	return ""
 }
 
+// tx是客户端签名后transaction.Serialize的结果
+type ReqRawTransaction struct {
+	Tx                   []byte   `protobuf:"bytes,1,opt,name=tx,proto3" json:"tx,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReqRawTransaction) Reset()         { *m = ReqRawTransaction{} }
+func (m *ReqRawTransaction) String() string { return proto.CompactTextString(m) }
+func (*ReqRawTransaction) ProtoMessage()    {}
+func (*ReqRawTransaction) Descriptor() ([]byte, []int) {
+	return fileDescriptor_33c57e4bae7b9afd, []int{20}
+}
+
+func (m *ReqRawTransaction) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReqRawTransaction.Unmarshal(m, b)
+}
+func (m *ReqRawTransaction) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReqRawTransaction.Marshal(b, m, deterministic)
+}
+func (m *ReqRawTransaction) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReqRawTransaction.Merge(m, src)
+}
+func (m *ReqRawTransaction) XXX_Size() int {
+	return xxx_messageInfo_ReqRawTransaction.Size(m)
+}
+func (m *ReqRawTransaction) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReqRawTransaction.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReqRawTransaction proto.InternalMessageInfo
+
+func (m *ReqRawTransaction) GetTx() []byte {
+	if m != nil {
+		return m.Tx
+	}
+	return nil
+}
+
+type ResRawTransaction struct {
+	Hash                 string      `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	Code                 TxErrorCode `protobuf:"varint,2,opt,name=code,proto3,enum=message.TxErrorCode" json:"code,omitempty"`
+	Message              string      `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *ResRawTransaction) Reset()         { *m = ResRawTransaction{} }
+func (m *ResRawTransaction) String() string { return proto.CompactTextString(m) }
+func (*ResRawTransaction) ProtoMessage()    {}
+func (*ResRawTransaction) Descriptor() ([]byte, []int) {
+	return fileDescriptor_33c57e4bae7b9afd, []int{21}
+}
+
+func (m *ResRawTransaction) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResRawTransaction.Unmarshal(m, b)
+}
+func (m *ResRawTransaction) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResRawTransaction.Marshal(b, m, deterministic)
+}
+func (m *ResRawTransaction) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResRawTransaction.Merge(m, src)
+}
+func (m *ResRawTransaction) XXX_Size() int {
+	return xxx_messageInfo_ResRawTransaction.Size(m)
+}
+func (m *ResRawTransaction) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResRawTransaction.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResRawTransaction proto.InternalMessageInfo
+
+func (m *ResRawTransaction) GetHash() string {
+	if m != nil {
+		return m.Hash
+	}
+	return ""
+}
+
+func (m *ResRawTransaction) GetCode() TxErrorCode {
+	if m != nil {
+		return m.Code
+	}
+	return TxErrorCode_TX_OK
+}
+
+func (m *ResRawTransaction) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+type ReqTxEvents struct {
+	Address              string   `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Hash                 string   `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReqTxEvents) Reset()         { *m = ReqTxEvents{} }
+func (m *ReqTxEvents) String() string { return proto.CompactTextString(m) }
+func (*ReqTxEvents) ProtoMessage()    {}
+func (*ReqTxEvents) Descriptor() ([]byte, []int) {
+	return fileDescriptor_33c57e4bae7b9afd, []int{22}
+}
+
+func (m *ReqTxEvents) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReqTxEvents.Unmarshal(m, b)
+}
+func (m *ReqTxEvents) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReqTxEvents.Marshal(b, m, deterministic)
+}
+func (m *ReqTxEvents) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReqTxEvents.Merge(m, src)
+}
+func (m *ReqTxEvents) XXX_Size() int {
+	return xxx_messageInfo_ReqTxEvents.Size(m)
+}
+func (m *ReqTxEvents) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReqTxEvents.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReqTxEvents proto.InternalMessageInfo
+
+func (m *ReqTxEvents) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+func (m *ReqTxEvents) GetHash() string {
+	if m != nil {
+		return m.Hash
+	}
+	return ""
+}
+
+type TxEvent struct {
+	Seq                  uint64   `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Type                 string   `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Hash                 string   `protobuf:"bytes,3,opt,name=hash,proto3" json:"hash,omitempty"`
+	From                 string   `protobuf:"bytes,4,opt,name=from,proto3" json:"from,omitempty"`
+	Nonce                uint64   `protobuf:"varint,5,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	Reason               string   `protobuf:"bytes,6,opt,name=reason,proto3" json:"reason,omitempty"`
+	Height               uint64   `protobuf:"varint,7,opt,name=height,proto3" json:"height,omitempty"`
+	Replacement          string   `protobuf:"bytes,8,opt,name=replacement,proto3" json:"replacement,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TxEvent) Reset()         { *m = TxEvent{} }
+func (m *TxEvent) String() string { return proto.CompactTextString(m) }
+func (*TxEvent) ProtoMessage()    {}
+func (*TxEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_33c57e4bae7b9afd, []int{23}
+}
+
+func (m *TxEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TxEvent.Unmarshal(m, b)
+}
+func (m *TxEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TxEvent.Marshal(b, m, deterministic)
+}
+func (m *TxEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TxEvent.Merge(m, src)
+}
+func (m *TxEvent) XXX_Size() int {
+	return xxx_messageInfo_TxEvent.Size(m)
+}
+func (m *TxEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_TxEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TxEvent proto.InternalMessageInfo
+
+func (m *TxEvent) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *TxEvent) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *TxEvent) GetHash() string {
+	if m != nil {
+		return m.Hash
+	}
+	return ""
+}
+
+func (m *TxEvent) GetFrom() string {
+	if m != nil {
+		return m.From
+	}
+	return ""
+}
+
+func (m *TxEvent) GetNonce() uint64 {
+	if m != nil {
+		return m.Nonce
+	}
+	return 0
+}
+
+func (m *TxEvent) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+func (m *TxEvent) GetHeight() uint64 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func (m *TxEvent) GetReplacement() string {
+	if m != nil {
+		return m.Replacement
+	}
+	return ""
+}
+
 func init() {
+	proto.RegisterEnum("message.TxErrorCode", TxErrorCode_name, TxErrorCode_value)
 	proto.RegisterType((*Tx)(nil), "message.Tx")
 	proto.RegisterType((*ResTx)(nil), "message.res_tx")
 	proto.RegisterType((*ReqTx)(nil), "message.req_tx")
@@ -961,6 +1273,10 @@ func init() {
 	proto.RegisterType((*RespMaxBlockNumber)(nil), "message.resp_max_block_number")
 	proto.RegisterType((*ReqAddrByPriv)(nil), "message.req_addr_by_priv")
 	proto.RegisterType((*RespAddrByPriv)(nil), "message.resp_addr_by_priv")
+	proto.RegisterType((*ReqRawTransaction)(nil), "message.req_raw_transaction")
+	proto.RegisterType((*ResRawTransaction)(nil), "message.res_raw_transaction")
+	proto.RegisterType((*ReqTxEvents)(nil), "message.req_tx_events")
+	proto.RegisterType((*TxEvent)(nil), "message.tx_event")
 }
 
 func init() {
@@ -968,57 +1284,87 @@ func init() {
 }
 
 var fileDescriptor_33c57e4bae7b9afd = []byte{
-	// 792 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x55, 0x4d, 0x6f, 0xf2, 0x46,
-	0x10, 0xb6, 0xf9, 0x2c, 0x43, 0x49, 0x9a, 0x7d, 0x29, 0xf5, 0x6b, 0x25, 0x15, 0x5a, 0x25, 0x0d,
-	0x87, 0x36, 0x87, 0x54, 0x51, 0xa5, 0xde, 0x20, 0x55, 0xe0, 0x92, 0x28, 0x72, 0xac, 0x5e, 0x91,
-	0x21, 0xab, 0x60, 0x25, 0xb6, 0xc9, 0xee, 0x92, 0x9a, 0x9f, 0x55, 0xa9, 0xff, 0xa7, 0x7f, 0xe5,
-	0xd5, 0x8c, 0x6d, 0xf0, 0x42, 0x38, 0x31, 0x33, 0xfb, 0xec, 0xb3, 0xf3, 0xf1, 0x8c, 0x81, 0x4e,
-	0x24, 0x94, 0x0a, 0x5e, 0xc4, 0xd5, 0x52, 0x26, 0x3a, 0x61, 0xcd, 0xdc, 0xe5, 0xff, 0xd9, 0x50,
-	0xf1, 0x53, 0xd6, 0x85, 0xfa, 0x43, 0x12, 0xcf, 0x85, 0x63, 0xf7, 0xed, 0x41, 0xcd, 0xcb, 0x1c,
-	0xd6, 0x83, 0xc6, 0x30, 0x4a, 0x56, 0xb1, 0x76, 0x2a, 0x14, 0xce, 0x3d, 0xc6, 0xa0, 0x76, 0x27,
-	0x93, 0xc8, 0xa9, 0xf6, 0xed, 0x41, 0xcb, 0x23, 0x9b, 0x1d, 0x41, 0xc5, 0x4f, 0x9c, 0x1a, 0x45,
-	0x2a, 0x7e, 0x82, 0x98, 0x49, 0xa0, 0x16, 0x4e, 0x3d, 0xc3, 0xa0, 0xcd, 0x4e, 0xa1, 0xf5, 0x14,
-	0xbe, 0xc4, 0x81, 0x5e, 0x49, 0xe1, 0x34, 0xe8, 0x60, 0x1b, 0xc0, 0x1b, 0x7e, 0x18, 0x09, 0xa7,
-	0xd9, 0xb7, 0x07, 0x55, 0x8f, 0x6c, 0xcc, 0x40, 0xcd, 0x65, 0xb8, 0xd4, 0xce, 0x77, 0x04, 0xcf,
-	0x3d, 0x7e, 0x09, 0x0d, 0x29, 0xd4, 0x54, 0xa7, 0xec, 0x0c, 0xaa, 0x7e, 0xaa, 0x1c, 0xbb, 0x5f,
-	0x1d, 0xb4, 0xaf, 0xdb, 0x57, 0x45, 0x99, 0x7e, 0xea, 0x61, 0x9c, 0x73, 0x04, 0xbe, 0x23, 0xd0,
-	0x81, 0x66, 0xf0, 0xfc, 0x2c, 0x85, 0x52, 0x54, 0x64, 0xcb, 0x2b, 0x5c, 0x7e, 0x0e, 0x47, 0x19,
-	0x66, 0x3a, 0x5b, 0x4f, 0x17, 0x98, 0x28, 0x83, 0x1a, 0xfe, 0xe6, 0x40, 0xb2, 0xf9, 0x25, 0xb4,
-	0x11, 0x35, 0x0b, 0xde, 0x02, 0xec, 0xcd, 0x61, 0xba, 0x0b, 0x04, 0xaa, 0x0d, 0xb0, 0x07, 0x8d,
-	0x59, 0xf0, 0xb6, 0xed, 0x6d, 0xee, 0xf1, 0xdf, 0xe0, 0x0b, 0xf1, 0xbd, 0x25, 0xf3, 0x57, 0x7c,
-	0x38, 0x5e, 0x45, 0x33, 0x21, 0x11, 0xbe, 0x10, 0xe1, 0xcb, 0x42, 0x17, 0xf0, 0xcc, 0xe3, 0x97,
-	0x70, 0x62, 0xc0, 0x0f, 0xe6, 0xf9, 0xbf, 0x0d, 0x20, 0x85, 0x5a, 0x66, 0x50, 0xe4, 0x9b, 0x18,
-	0x7c, 0x99, 0xc7, 0xce, 0xa1, 0xf3, 0x28, 0xc5, 0xc7, 0x08, 0x41, 0x34, 0xa8, 0x0a, 0x71, 0x98,
-	0xc1, 0xa2, 0xbb, 0xd5, 0xcf, 0xbb, 0x8b, 0xef, 0x7b, 0x49, 0xa2, 0xf3, 0xb1, 0x93, 0x8d, 0x8d,
-	0xf9, 0x5b, 0x48, 0x15, 0x26, 0x31, 0xcd, 0xbe, 0xe6, 0x15, 0x2e, 0x8e, 0x1f, 0x87, 0xaa, 0x74,
-	0x10, 0x2d, 0x69, 0xfc, 0x55, 0x6f, 0x1b, 0xd8, 0x08, 0xa6, 0x59, 0x12, 0x4c, 0x17, 0xea, 0xf7,
-	0x61, 0x2c, 0x64, 0x3e, 0xfd, 0xcc, 0xe1, 0xbf, 0x52, 0x83, 0x97, 0x89, 0x12, 0x53, 0x9d, 0x2a,
-	0xcc, 0x51, 0x1f, 0x50, 0x80, 0x4e, 0x71, 0x1c, 0x9d, 0x02, 0x1d, 0x93, 0xaa, 0xbb, 0x50, 0x8f,
-	0xcb, 0x5a, 0x27, 0x87, 0x5f, 0x40, 0x0b, 0xfb, 0x9b, 0x41, 0x0e, 0x0f, 0xf7, 0x1f, 0x38, 0x26,
-	0xad, 0xc8, 0x20, 0x56, 0xc1, 0x5c, 0x63, 0x59, 0xc5, 0x36, 0xd8, 0x7b, 0xdb, 0x50, 0xd9, 0x6c,
-	0xc3, 0x76, 0x93, 0xaa, 0xc6, 0x26, 0x6d, 0xf6, 0xae, 0x56, 0xde, 0x3b, 0x06, 0xb5, 0x47, 0x19,
-	0x7e, 0x14, 0xbb, 0x83, 0x36, 0xbf, 0xc0, 0x87, 0xd5, 0xee, 0xc3, 0x93, 0xd2, 0xf4, 0xd1, 0xe6,
-	0x27, 0x59, 0x7e, 0x73, 0x29, 0x02, 0x2d, 0xa6, 0x98, 0x35, 0xbf, 0x83, 0x1f, 0x48, 0x0f, 0xa5,
-	0xd8, 0xe1, 0x02, 0xf1, 0x64, 0x29, 0xc3, 0x8f, 0x57, 0xb1, 0xce, 0xd3, 0x2f, 0x5c, 0xde, 0x83,
-	0x2e, 0x52, 0x47, 0x41, 0x9a, 0xab, 0x30, 0x53, 0x2c, 0xbf, 0x81, 0x1f, 0x89, 0x7f, 0xf7, 0x00,
-	0xe7, 0x1d, 0x05, 0xe9, 0x03, 0x39, 0x79, 0xb3, 0xb7, 0x01, 0xfe, 0x0b, 0xa6, 0xf5, 0x4e, 0xe9,
-	0xa0, 0x9e, 0xf1, 0x15, 0xac, 0x08, 0x7f, 0x8b, 0x8a, 0xd0, 0xce, 0x84, 0xaf, 0x96, 0x7b, 0x40,
-	0xf4, 0x0b, 0x20, 0xda, 0xd7, 0xff, 0xd6, 0xa1, 0x39, 0x96, 0x42, 0x68, 0x21, 0xd9, 0x5f, 0xd0,
-	0x19, 0x0b, 0x4d, 0x3a, 0x1e, 0xad, 0x1f, 0x56, 0x11, 0x3b, 0xdd, 0xe8, 0xe2, 0x93, 0xa5, 0x73,
-	0xbf, 0x94, 0x4e, 0x8b, 0xcd, 0xe1, 0x16, 0xbb, 0x85, 0xa3, 0x2d, 0x0b, 0x09, 0xd2, 0xfd, 0x9c,
-	0x06, 0x17, 0xef, 0x10, 0xc9, 0x9f, 0x00, 0x48, 0x92, 0x7f, 0x0d, 0xba, 0x26, 0x41, 0x16, 0x75,
-	0xcb, 0xd1, 0xcd, 0x97, 0x83, 0x5b, 0xec, 0x0f, 0xf8, 0x7e, 0x2c, 0xb4, 0x9f, 0xaa, 0xd1, 0x7a,
-	0x88, 0x63, 0x3b, 0x36, 0x6e, 0xeb, 0xd4, 0xbc, 0x58, 0x6c, 0x04, 0xb7, 0xd8, 0x0d, 0xb4, 0xe9,
-	0x62, 0x9e, 0xf6, 0x4f, 0x3b, 0xf7, 0x36, 0x39, 0x97, 0xd7, 0x85, 0x5b, 0x6c, 0x0c, 0xc7, 0x4f,
-	0x22, 0x7e, 0xf6, 0x4b, 0x22, 0x73, 0xcc, 0xab, 0xdb, 0x13, 0xd7, 0x31, 0x92, 0x2e, 0x9d, 0x70,
-	0x8b, 0x0d, 0xe1, 0x64, 0x2c, 0xf4, 0x30, 0xd3, 0x14, 0x89, 0x7a, 0xa8, 0x19, 0x33, 0xa8, 0x68,
-	0xd3, 0xdc, 0xde, 0x5e, 0x01, 0xd9, 0x3a, 0x62, 0xf3, 0xe1, 0x96, 0x14, 0x4b, 0x95, 0x9b, 0x69,
-	0x94, 0xa4, 0xec, 0x7e, 0x35, 0xdb, 0x5e, 0x56, 0xbe, 0xc5, 0x7c, 0xca, 0xe3, 0x3e, 0x48, 0x69,
-	0x88, 0x99, 0xf2, 0xd8, 0x99, 0xc1, 0xb5, 0x2b, 0x5b, 0xf7, 0x67, 0x93, 0x70, 0x4f, 0xef, 0x16,
-	0x9b, 0x90, 0xba, 0x30, 0xaf, 0xd1, 0x1a, 0x97, 0x93, 0x7d, 0x35, 0x18, 0xcb, 0x4a, 0x75, 0x5d,
-	0x93, 0xad, 0x7c, 0xc6, 0xad, 0x59, 0x83, 0xfe, 0x8e, 0x7f, 0xff, 0x16, 0x00, 0x00, 0xff, 0xff,
-	0xf0, 0x90, 0x72, 0xc4, 0x9f, 0x07, 0x00, 0x00,
+	// 1278 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x56, 0xdd, 0x72, 0xda, 0x46,
+	0x14, 0xe6, 0x9f, 0xf8, 0xd8, 0x60, 0xb1, 0x71, 0x08, 0xa1, 0x49, 0xc7, 0xb3, 0x13, 0x37, 0x9e,
+	0x4c, 0x9b, 0xe9, 0xa4, 0x93, 0xe9, 0x4c, 0x67, 0x7a, 0x21, 0x40, 0xc6, 0x6a, 0xb0, 0xa0, 0x62,
+	0x49, 0xe8, 0xd5, 0x8e, 0xc0, 0xdb, 0x98, 0x89, 0x91, 0x88, 0x24, 0xdb, 0xf2, 0x43, 0xf4, 0x6d,
+	0xfa, 0x00, 0xbd, 0xed, 0x53, 0xf4, 0x55, 0x3a, 0x67, 0xb5, 0x02, 0x09, 0xdb, 0xb9, 0x62, 0xcf,
+	0x39, 0xdf, 0x7e, 0x3a, 0x7b, 0x7e, 0x81, 0xda, 0x52, 0x04, 0x81, 0xf3, 0x49, 0xbc, 0x59, 0xf9,
+	0x5e, 0xe8, 0x91, 0xaa, 0x12, 0xe9, 0xdf, 0x79, 0x28, 0xb0, 0x88, 0x1c, 0x40, 0xd9, 0xf2, 0xdc,
+	0xb9, 0x68, 0xe5, 0x0f, 0xf3, 0xc7, 0x25, 0x3b, 0x16, 0x48, 0x13, 0x2a, 0xfa, 0xd2, 0xbb, 0x72,
+	0xc3, 0x56, 0x41, 0xaa, 0x95, 0x44, 0x08, 0x94, 0x4e, 0x7c, 0x6f, 0xd9, 0x2a, 0x1e, 0xe6, 0x8f,
+	0x77, 0x6c, 0x79, 0x26, 0x75, 0x28, 0x30, 0xaf, 0x55, 0x92, 0x9a, 0x02, 0xf3, 0x10, 0x73, 0xea,
+	0x04, 0x17, 0xad, 0x72, 0x8c, 0xc1, 0x33, 0x79, 0x0e, 0x3b, 0xe3, 0xc5, 0x27, 0xd7, 0x09, 0xaf,
+	0x7c, 0xd1, 0xaa, 0x48, 0xc3, 0x46, 0x81, 0x37, 0xd8, 0x62, 0x29, 0x5a, 0xd5, 0xc3, 0xfc, 0x71,
+	0xd1, 0x96, 0x67, 0xf4, 0x20, 0x98, 0xfb, 0x8b, 0x55, 0xd8, 0x7a, 0x24, 0xe1, 0x4a, 0xa2, 0xaf,
+	0xa0, 0xe2, 0x8b, 0x80, 0x87, 0x11, 0x79, 0x01, 0x45, 0x16, 0x05, 0xad, 0xfc, 0x61, 0xf1, 0x78,
+	0xf7, 0xed, 0xee, 0x9b, 0xe4, 0x99, 0x2c, 0xb2, 0x51, 0x4f, 0x29, 0x02, 0xbf, 0x20, 0xb0, 0x05,
+	0x55, 0xe7, 0xfc, 0xdc, 0x17, 0x41, 0x20, 0x1f, 0xb9, 0x63, 0x27, 0x22, 0x7d, 0x09, 0xf5, 0x18,
+	0xc3, 0x67, 0xb7, 0xfc, 0x02, 0x1d, 0x25, 0x50, 0xc2, 0x5f, 0x05, 0x94, 0x67, 0xfa, 0x0a, 0x76,
+	0x11, 0x35, 0x73, 0x2e, 0x1d, 0x8c, 0xcd, 0xc3, 0x74, 0x47, 0x08, 0x0c, 0xd6, 0xc0, 0x26, 0x54,
+	0x66, 0xce, 0xe5, 0x26, 0xb6, 0x4a, 0xa2, 0x3f, 0xc0, 0x63, 0xc9, 0x77, 0xe9, 0xcd, 0x3f, 0xe3,
+	0x87, 0xdd, 0xab, 0xe5, 0x4c, 0xf8, 0x08, 0xbf, 0x10, 0x8b, 0x4f, 0x17, 0x61, 0x02, 0x8f, 0x25,
+	0xfa, 0x0a, 0x1a, 0x19, 0xf8, 0x83, 0x7e, 0xfe, 0x97, 0x07, 0xf0, 0x45, 0xb0, 0x8a, 0xa1, 0xc8,
+	0x77, 0x9a, 0xe1, 0x8b, 0x25, 0xf2, 0x12, 0x6a, 0x23, 0x5f, 0x5c, 0x77, 0x10, 0x24, 0x13, 0x55,
+	0x90, 0x1c, 0x59, 0x65, 0x12, 0xdd, 0xe2, 0xfd, 0xd1, 0xc5, 0xef, 0xdb, 0x9e, 0x17, 0xaa, 0xb4,
+	0xcb, 0x33, 0x06, 0xe6, 0x83, 0xf0, 0x83, 0x85, 0xe7, 0xca, 0xdc, 0x97, 0xec, 0x44, 0xc4, 0xf4,
+	0x63, 0x52, 0x83, 0xd0, 0x59, 0xae, 0x64, 0xfa, 0x8b, 0xf6, 0x46, 0xb1, 0x2e, 0x98, 0x6a, 0xaa,
+	0x60, 0x0e, 0xa0, 0x7c, 0xb6, 0x70, 0x85, 0xaf, 0xb2, 0x1f, 0x0b, 0xf4, 0x7b, 0x19, 0xe0, 0x95,
+	0x17, 0x08, 0x1e, 0x46, 0x01, 0xfa, 0x18, 0x3e, 0x50, 0x01, 0x61, 0x84, 0xe9, 0xa8, 0x25, 0x68,
+	0x57, 0x56, 0xf5, 0x01, 0x94, 0xdd, 0x74, 0xad, 0x4b, 0x81, 0x1e, 0xc1, 0x0e, 0xc6, 0xd7, 0xf5,
+	0xbe, 0x9e, 0xdc, 0x1b, 0xd8, 0x97, 0xb5, 0xe2, 0x3b, 0x6e, 0xe0, 0xcc, 0x43, 0x7c, 0x56, 0xd2,
+	0x0d, 0xf9, 0x3b, 0xdd, 0x50, 0x58, 0x77, 0xc3, 0xa6, 0x93, 0x8a, 0x99, 0x4e, 0x5a, 0xf7, 0x5d,
+	0x29, 0xdd, 0x77, 0x04, 0x4a, 0x23, 0x7f, 0x71, 0x9d, 0xf4, 0x0e, 0x9e, 0xe9, 0x11, 0x7e, 0x38,
+	0xd8, 0xfe, 0xf0, 0x69, 0x2a, 0xfb, 0x78, 0xa6, 0x8d, 0xd8, 0xbf, 0xb9, 0x2f, 0x9c, 0x50, 0x70,
+	0xf4, 0x9a, 0x9e, 0x80, 0x26, 0xeb, 0x21, 0xa5, 0x7b, 0xf8, 0x81, 0x68, 0x59, 0xf9, 0x8b, 0xeb,
+	0xcf, 0xe2, 0x56, 0xb9, 0x9f, 0x88, 0xb4, 0x09, 0x07, 0x48, 0xbd, 0x74, 0x22, 0x55, 0x85, 0x71,
+	0xc5, 0xd2, 0x77, 0xf0, 0x44, 0xf2, 0x6f, 0x1b, 0x30, 0xdf, 0x4b, 0x27, 0xb2, 0xa4, 0xa0, 0x82,
+	0xbd, 0x51, 0xd0, 0xef, 0xd0, 0xad, 0x2f, 0xd2, 0x1d, 0xac, 0x67, 0xfc, 0x0a, 0xbe, 0x08, 0x7f,
+	0x93, 0x17, 0xe1, 0x39, 0x2e, 0xfc, 0x60, 0x75, 0x07, 0x88, 0x72, 0x02, 0x94, 0xef, 0x3c, 0x8a,
+	0x1b, 0xca, 0x77, 0x6e, 0x32, 0x51, 0xaa, 0x43, 0x21, 0x8c, 0x24, 0x70, 0xcf, 0x2e, 0x84, 0x11,
+	0xf5, 0x10, 0x16, 0xdc, 0x81, 0xdd, 0xd3, 0x4a, 0xe4, 0x35, 0x94, 0xe6, 0xde, 0xb9, 0x90, 0x81,
+	0xa8, 0xbf, 0x6d, 0xae, 0x4b, 0x2b, 0x8c, 0xb8, 0xf0, 0x7d, 0xcf, 0xe7, 0x68, 0xb5, 0x25, 0x06,
+	0xe3, 0xa6, 0xcc, 0x6a, 0x2c, 0x26, 0x22, 0xfd, 0x15, 0x6a, 0x6a, 0xbc, 0x88, 0x6b, 0xe1, 0x86,
+	0xc1, 0x57, 0x82, 0x9f, 0x38, 0x51, 0x48, 0xf5, 0xf3, 0x3f, 0x79, 0x78, 0x94, 0xdc, 0x25, 0x1a,
+	0x14, 0x03, 0xf1, 0x45, 0x05, 0x13, 0x8f, 0x78, 0x25, 0xbc, 0x5d, 0x89, 0xe4, 0x0a, 0x9e, 0xd7,
+	0x34, 0xc5, 0xd4, 0x5b, 0x08, 0x94, 0xfe, 0xc4, 0x2a, 0x55, 0xad, 0x8a, 0xe7, 0x4d, 0x27, 0x94,
+	0x53, 0x9d, 0x80, 0xb5, 0xea, 0x0b, 0x27, 0xf0, 0x5c, 0x35, 0xa2, 0x95, 0x94, 0x9a, 0x4c, 0xd5,
+	0xf4, 0x64, 0x22, 0x87, 0xd8, 0x8e, 0xab, 0x4b, 0x67, 0x2e, 0x96, 0xc2, 0x4d, 0x06, 0x75, 0x5a,
+	0xf5, 0xfa, 0xaf, 0x22, 0xd4, 0x32, 0x31, 0x23, 0x3b, 0x50, 0x66, 0x53, 0x3e, 0x7c, 0xaf, 0xe5,
+	0xc8, 0x53, 0x78, 0xcc, 0xa6, 0xdc, 0xb4, 0x3e, 0xe8, 0x03, 0xb3, 0xc7, 0x0d, 0xab, 0x3b, 0xec,
+	0x99, 0x56, 0x5f, 0xcb, 0x93, 0x03, 0xd0, 0xd8, 0x94, 0x77, 0xf4, 0x1e, 0x1f, 0x9b, 0x7d, 0x4b,
+	0x67, 0x13, 0xdb, 0xd0, 0x0a, 0x4a, 0x6b, 0x0d, 0xad, 0xae, 0xc1, 0xd9, 0x70, 0xc8, 0x07, 0xc3,
+	0x8f, 0x5a, 0x91, 0x7c, 0x03, 0x4f, 0x25, 0xc9, 0x78, 0x72, 0x72, 0x62, 0x76, 0x4d, 0xc3, 0x62,
+	0xbc, 0xa3, 0x0f, 0x74, 0xab, 0x6b, 0x68, 0x25, 0xf2, 0x04, 0x1a, 0x6c, 0xca, 0x3f, 0xda, 0x43,
+	0xab, 0xcf, 0xbb, 0xa7, 0xba, 0x69, 0x71, 0xb3, 0xa7, 0x95, 0x49, 0x1b, 0x9a, 0x6c, 0xca, 0x27,
+	0xd6, 0x78, 0x32, 0x1a, 0x0d, 0x6d, 0x66, 0xf4, 0xf8, 0x07, 0xc3, 0x1e, 0x9b, 0x43, 0x4b, 0xab,
+	0x90, 0x26, 0x90, 0x94, 0x53, 0x7a, 0xaf, 0x67, 0x1b, 0xe3, 0xb1, 0x56, 0x55, 0xce, 0xea, 0x67,
+	0xc3, 0x89, 0xc5, 0xe4, 0xe7, 0xc7, 0x67, 0xfa, 0x60, 0xa0, 0x3d, 0x22, 0x04, 0xea, 0x6c, 0xca,
+	0x4f, 0x8c, 0x8d, 0x53, 0x3b, 0xca, 0x55, 0x7d, 0x60, 0x1b, 0x7a, 0xef, 0x0f, 0xfe, 0xde, 0x1a,
+	0x7e, 0xb4, 0x34, 0x50, 0xc8, 0x89, 0xd5, 0x33, 0xec, 0x91, 0x6d, 0x76, 0x8d, 0x9e, 0xb6, 0x4b,
+	0x34, 0xd8, 0x5b, 0x3f, 0xaa, 0xaf, 0x8f, 0xb4, 0x3d, 0xd2, 0x80, 0x1a, 0x9b, 0xf2, 0xdf, 0x27,
+	0xc6, 0xc4, 0xe0, 0x27, 0x93, 0xc1, 0x40, 0xab, 0x25, 0x74, 0xdd, 0xae, 0xfc, 0xf8, 0xc0, 0x3c,
+	0x33, 0x99, 0x56, 0x57, 0x57, 0x47, 0xc3, 0xe1, 0x20, 0xc6, 0xed, 0x93, 0x7d, 0xd8, 0x65, 0x53,
+	0x6e, 0x1b, 0xbf, 0x19, 0x5d, 0x66, 0xf4, 0x34, 0x4d, 0x29, 0xce, 0x26, 0x03, 0x66, 0x8e, 0xcd,
+	0xbe, 0xd6, 0x78, 0xfb, 0x6f, 0x05, 0xaa, 0x7d, 0x5f, 0x88, 0x50, 0xf8, 0xa4, 0x07, 0xb5, 0xbe,
+	0x08, 0xe5, 0xc4, 0xef, 0xdc, 0x5a, 0x57, 0x4b, 0xf2, 0x7c, 0x5d, 0xe6, 0xf7, 0xac, 0xa7, 0xf6,
+	0xe3, 0x94, 0x35, 0xd9, 0x31, 0x34, 0x47, 0xba, 0x50, 0xdf, 0xb0, 0xc8, 0xd1, 0xdd, 0xbe, 0x9f,
+	0x06, 0x6b, 0xf1, 0x21, 0x92, 0x5f, 0x00, 0x90, 0x44, 0xed, 0xcd, 0x83, 0x2c, 0x41, 0xac, 0x6d,
+	0xa7, 0xb5, 0xeb, 0x1d, 0x4b, 0x73, 0xe4, 0x67, 0xd8, 0xeb, 0x8b, 0x90, 0x45, 0x41, 0xe7, 0x56,
+	0xc7, 0x01, 0xb7, 0x9f, 0xb9, 0x1d, 0x46, 0xd9, 0x8b, 0xc9, 0xee, 0xa0, 0x39, 0xf2, 0x0e, 0x76,
+	0xe5, 0x45, 0xe5, 0xf6, 0xd3, 0xad, 0x7b, 0x6b, 0x9f, 0xd3, 0x8b, 0x85, 0xe6, 0x48, 0x1f, 0xf6,
+	0xc7, 0xc2, 0x3d, 0x67, 0xa9, 0x09, 0xd2, 0xca, 0x5e, 0xdd, 0x58, 0xda, 0xad, 0x8c, 0xd3, 0x29,
+	0x0b, 0xcd, 0x11, 0x1b, 0x08, 0x12, 0xd9, 0xce, 0x4d, 0x9a, 0x2b, 0x9b, 0x84, 0xad, 0x59, 0xd5,
+	0x7e, 0x9e, 0xe1, 0xdb, 0xb2, 0xd2, 0x1c, 0xd1, 0xa1, 0xd1, 0x17, 0xa1, 0x1e, 0x0f, 0x15, 0xb9,
+	0x52, 0xf4, 0x90, 0x90, 0x0c, 0xa5, 0x6c, 0xf5, 0x76, 0xf3, 0x4e, 0x50, 0xa4, 0x5e, 0x26, 0x14,
+	0xba, 0x72, 0x5f, 0xc8, 0x68, 0x66, 0x9f, 0x96, 0x5a, 0x24, 0xed, 0x67, 0xd9, 0x54, 0xa6, 0x4c,
+	0x34, 0x47, 0x98, 0xf4, 0xe3, 0xcc, 0x89, 0x64, 0x61, 0xc4, 0x73, 0x9f, 0xbc, 0xc8, 0x70, 0x6d,
+	0x2f, 0x8d, 0xf6, 0xb7, 0x59, 0xc2, 0x3b, 0xdb, 0x26, 0x47, 0x4e, 0x65, 0xc5, 0xa2, 0x5f, 0x9d,
+	0x5b, 0x5c, 0x8d, 0xe4, 0x59, 0x86, 0x31, 0xbd, 0x27, 0xda, 0xed, 0x2c, 0x5b, 0xda, 0x46, 0x73,
+	0xa4, 0x03, 0x8d, 0xf1, 0xd5, 0x0c, 0xff, 0x52, 0xce, 0x04, 0x8b, 0x8c, 0x78, 0x3a, 0x37, 0xb7,
+	0x2b, 0x20, 0x9e, 0xda, 0xed, 0x46, 0x66, 0xfc, 0xa3, 0x8e, 0xe6, 0x7e, 0xcc, 0xcf, 0x2a, 0xf2,
+	0x0f, 0xf5, 0x4f, 0xff, 0x0f, 0x00, 0xe0, 0xbb, 0x4a, 0x3b, 0x61, 0x0b, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -1039,10 +1385,12 @@ type GreeterClient interface {
 	GetTxsByAddr(ctx context.Context, in *ReqTx, opts ...grpc.CallOption) (*ResposeTxs, error)
 	GetTxByHash(ctx context.Context, in *ReqTxByHash, opts ...grpc.CallOption) (*Tx, error)
 	SendTransaction(ctx context.Context, in *ReqTransaction, opts ...grpc.CallOption) (*ResTransaction, error)
+	SendRawTransaction(ctx context.Context, in *ReqRawTransaction, opts ...grpc.CallOption) (*ResRawTransaction, error)
 	GetAddressNonceAt(ctx context.Context, in *ReqNonce, opts ...grpc.CallOption) (*ResposeNonce, error)
 	CreateAddr(ctx context.Context, in *ReqCreateAddr, opts ...grpc.CallOption) (*RespCreateAddr, error)
 	GetMaxBlockNumber(ctx context.Context, in *ReqMaxBlockNumber, opts ...grpc.CallOption) (*RespMaxBlockNumber, error)
 	GetAddrByPriv(ctx context.Context, in *ReqAddrByPriv, opts ...grpc.CallOption) (*RespAddrByPriv, error)
+	SubscribeTxEvents(ctx context.Context, in *ReqTxEvents, opts ...grpc.CallOption) (Greeter_SubscribeTxEventsClient, error)
 }
 
 type greeterClient struct {
@@ -1107,6 +1455,15 @@ func (c *greeterClient) SendTransaction(ctx context.Context, in *ReqTransaction,
 	return out, nil
 }
 
+func (c *greeterClient) SendRawTransaction(ctx context.Context, in *ReqRawTransaction, opts ...grpc.CallOption) (*ResRawTransaction, error) {
+	out := new(ResRawTransaction)
+	err := c.cc.Invoke(ctx, "/message.Greeter/SendRawTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *greeterClient) GetAddressNonceAt(ctx context.Context, in *ReqNonce, opts ...grpc.CallOption) (*ResposeNonce, error) {
 	out := new(ResposeNonce)
 	err := c.cc.Invoke(ctx, "/message.Greeter/GetAddressNonceAt", in, out, opts...)
@@ -1143,6 +1500,38 @@ func (c *greeterClient) GetAddrByPriv(ctx context.Context, in *ReqAddrByPriv, op
 	return out, nil
 }
 
+func (c *greeterClient) SubscribeTxEvents(ctx context.Context, in *ReqTxEvents, opts ...grpc.CallOption) (Greeter_SubscribeTxEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Greeter_serviceDesc.Streams[0], "/message.Greeter/SubscribeTxEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &greeterSubscribeTxEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Greeter_SubscribeTxEventsClient interface {
+	Recv() (*TxEvent, error)
+	grpc.ClientStream
+}
+
+type greeterSubscribeTxEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *greeterSubscribeTxEventsClient) Recv() (*TxEvent, error) {
+	m := new(TxEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // GreeterServer is the server API for Greeter service.
 type GreeterServer interface {
 	GetBlockByNum(context.Context, *ReqBlockByNumber) (*RespBlock, error)
@@ -1151,10 +1540,12 @@ type GreeterServer interface {
 	GetTxsByAddr(context.Context, *ReqTx) (*ResposeTxs, error)
 	GetTxByHash(context.Context, *ReqTxByHash) (*Tx, error)
 	SendTransaction(context.Context, *ReqTransaction) (*ResTransaction, error)
+	SendRawTransaction(context.Context, *ReqRawTransaction) (*ResRawTransaction, error)
 	GetAddressNonceAt(context.Context, *ReqNonce) (*ResposeNonce, error)
 	CreateAddr(context.Context, *ReqCreateAddr) (*RespCreateAddr, error)
 	GetMaxBlockNumber(context.Context, *ReqMaxBlockNumber) (*RespMaxBlockNumber, error)
 	GetAddrByPriv(context.Context, *ReqAddrByPriv) (*RespAddrByPriv, error)
+	SubscribeTxEvents(*ReqTxEvents, Greeter_SubscribeTxEventsServer) error
 }
 
 // UnimplementedGreeterServer can be embedded to have forward compatible implementations.
@@ -1179,6 +1570,9 @@ func (*UnimplementedGreeterServer) GetTxByHash(ctx context.Context, req *ReqTxBy
 func (*UnimplementedGreeterServer) SendTransaction(ctx context.Context, req *ReqTransaction) (*ResTransaction, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendTransaction not implemented")
 }
+func (*UnimplementedGreeterServer) SendRawTransaction(ctx context.Context, req *ReqRawTransaction) (*ResRawTransaction, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendRawTransaction not implemented")
+}
 func (*UnimplementedGreeterServer) GetAddressNonceAt(ctx context.Context, req *ReqNonce) (*ResposeNonce, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetAddressNonceAt not implemented")
 }
@@ -1191,6 +1585,9 @@ func (*UnimplementedGreeterServer) GetMaxBlockNumber(ctx context.Context, req *R
 func (*UnimplementedGreeterServer) GetAddrByPriv(ctx context.Context, req *ReqAddrByPriv) (*RespAddrByPriv, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetAddrByPriv not implemented")
 }
+func (*UnimplementedGreeterServer) SubscribeTxEvents(req *ReqTxEvents, srv Greeter_SubscribeTxEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeTxEvents not implemented")
+}
 
 func RegisterGreeterServer(s *grpc.Server, srv GreeterServer) {
 	s.RegisterService(&_Greeter_serviceDesc, srv)
@@ -1304,6 +1701,24 @@ func _Greeter_SendTransaction_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Greeter_SendRawTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReqRawTransaction)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GreeterServer).SendRawTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/message.Greeter/SendRawTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GreeterServer).SendRawTransaction(ctx, req.(*ReqRawTransaction))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Greeter_GetAddressNonceAt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ReqNonce)
 	if err := dec(in); err != nil {
@@ -1376,6 +1791,27 @@ func _Greeter_GetAddrByPriv_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Greeter_SubscribeTxEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReqTxEvents)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GreeterServer).SubscribeTxEvents(m, &greeterSubscribeTxEventsServer{stream})
+}
+
+type Greeter_SubscribeTxEventsServer interface {
+	Send(*TxEvent) error
+	grpc.ServerStream
+}
+
+type greeterSubscribeTxEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *greeterSubscribeTxEventsServer) Send(m *TxEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _Greeter_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "message.Greeter",
 	HandlerType: (*GreeterServer)(nil),
@@ -1404,6 +1840,10 @@ var _Greeter_serviceDesc = grpc.ServiceDesc{
 			MethodName: "SendTransaction",
 			Handler:    _Greeter_SendTransaction_Handler,
 		},
+		{
+			MethodName: "SendRawTransaction",
+			Handler:    _Greeter_SendRawTransaction_Handler,
+		},
 		{
 			MethodName: "GetAddressNonceAt",
 			Handler:    _Greeter_GetAddressNonceAt_Handler,
@@ -1421,6 +1861,12 @@ var _Greeter_serviceDesc = grpc.ServiceDesc{
 			Handler:    _Greeter_GetAddrByPriv_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeTxEvents",
+			Handler:       _Greeter_SubscribeTxEvents_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "message.proto",
 }
@@ -5,14 +5,22 @@ import (
 	"encoding/json"
 	"net/http"
 	"os"
+	"time"
 
 	"kortho/logger"
+	"kortho/types"
 
 	"github.com/buaazp/fasthttprouter"
 	"github.com/valyala/fasthttp"
 	"go.uber.org/zap"
 )
 
+const (
+	//长轮询的默认和最长等待时间，单位秒
+	defaultPollTimeout = 30
+	maxPollTimeout     = 60
+)
+
 type Server struct {
 	port string
 	fasthttprouter.Router
@@ -23,6 +31,8 @@ func (s *Server) Run() {
 	s.GET("/block", s.GetBlockHandler)
 	s.GET("/balance", s.GetBalanceHandler)
 	s.GET("/transaction", s.GetTransactionHandler)
+	s.GET("/txpool", s.GetTxPoolHandler)
+	s.GET("/txpool/events", s.GetTxEventsHandler)
 
 	if err := fasthttp.ListenAndServe(s.port, s.Handler); err != nil {
 		logger.Error("asthttp.ListenAndServe failed", zap.Error(err))
@@ -40,14 +50,15 @@ func (s *Server) GetBalanceHandler(ctx *fasthttp.RequestCtx) {
 	}()
 
 	address := ctx.QueryArgs().Peek("address")
-	if len(address) == 0 {
+	addr, err := types.StringToAddress(string(address))
+	if err != nil {
 		result.Code = failedCode
 		result.Message = ErrParameters
 		ctx.Response.SetStatusCode(http.StatusBadRequest)
 		return
 	}
 
-	balance, _ := blockChian.GetBalance(address)
+	balance, _ := blockChian.GetBalance(addr.Bytes())
 
 	result.Code = successCode
 	result.Message = OK
@@ -159,8 +170,15 @@ func (s *Server) GetTransactionHandler(ctx *fasthttp.RequestCtx) {
 
 	var viewTxs []Transaction
 	if len(address) != 0 {
+		addr, err := types.StringToAddress(string(address))
+		if err != nil {
+			result.Code = failedCode
+			result.Message = ErrParameters
+			ctx.Response.SetStatusCode(http.StatusBadRequest)
+			return
+		}
 
-		txs, err := blockChian.GetTransactionByAddr(address, int64(start), int64(end))
+		txs, err := blockChian.GetTransactionByAddr(addr.Bytes(), int64(start), int64(end))
 		if err != nil {
 			logger.Error("Failed to get transactions", zap.Error(err), zap.String("address", string(address)),
 				zap.Int("start", start), zap.Int("end", end))
@@ -201,3 +219,92 @@ func (s *Server) GetTransactionHandler(ctx *fasthttp.RequestCtx) {
 	ctx.Response.SetStatusCode(http.StatusOK)
 	return
 }
+
+func (s *Server) GetTxPoolHandler(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("Access-Control-Allow-Origin", "*")
+	ctx.Response.Header.Set("Content-Type", "application/json")
+	var result resultInfo
+	defer func() {
+		jsbyte, _ := json.Marshal(result)
+		ctx.Write(jsbyte)
+	}()
+
+	//可以只查看某个地址的交易
+	address, err := normalizeAddress(string(ctx.QueryArgs().Peek("address")))
+	if err != nil {
+		result.Code = failedCode
+		result.Message = ErrParameters
+		ctx.Response.SetStatusCode(http.StatusBadRequest)
+		return
+	}
+	pending, queued := txPool.Content()
+
+	result.Code = successCode
+	result.Message = OK
+	result.Data = changeTxPoolContent(pending, queued, address)
+	ctx.Response.SetStatusCode(http.StatusOK)
+	return
+}
+
+// GetTxEventsHandler 长轮询交易池事件：返回序号大于since的事件，没有事件时最多等待timeout秒
+func (s *Server) GetTxEventsHandler(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("Access-Control-Allow-Origin", "*")
+	ctx.Response.Header.Set("Content-Type", "application/json")
+	var result resultInfo
+	defer func() {
+		jsbyte, _ := json.Marshal(result)
+		ctx.Write(jsbyte)
+	}()
+
+	args := ctx.QueryArgs()
+	address, err := normalizeAddress(string(args.Peek("address")))
+	if err != nil {
+		result.Code = failedCode
+		result.Message = ErrParameters
+		ctx.Response.SetStatusCode(http.StatusBadRequest)
+		return
+	}
+	hash := string(args.Peek("hash"))
+	since, err := args.GetUint("since")
+	if err == fasthttp.ErrNoArgValue {
+		since = 0
+	} else if err != nil {
+		result.Code = failedCode
+		result.Message = ErrParameters
+		ctx.Response.SetStatusCode(http.StatusBadRequest)
+		return
+	}
+	timeout, err := args.GetUint("timeout")
+	if err != nil || timeout <= 0 || timeout > maxPollTimeout {
+		timeout = defaultPollTimeout
+	}
+
+	events := TxEvents{Events: []TxEvent{}, Next: uint64(since)}
+	timer := time.NewTimer(time.Duration(timeout) * time.Second)
+	defer timer.Stop()
+poll:
+	for {
+		evs, notify := txPool.EventsSince(events.Next)
+		for _, ev := range evs {
+			events.Next = ev.Seq
+			if matchTxEvent(ev, address, hash) {
+				events.Events = append(events.Events, changeTxEvent(ev))
+			}
+		}
+		if len(events.Events) != 0 {
+			break
+		}
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			break poll
+		}
+	}
+
+	result.Code = successCode
+	result.Message = OK
+	result.Data = events
+	ctx.Response.SetStatusCode(http.StatusOK)
+	return
+}
@@ -5,9 +5,12 @@ import (
 	"kortho/block"
 	"kortho/blockchain"
 	"kortho/transaction"
+	"kortho/txpool"
+	"kortho/types"
 )
 
 var blockChian blockchain.Blockchains
+var txPool *txpool.TxPool
 
 type Transaction struct {
 	Nonce       uint64 `json:"nonce"`
@@ -18,15 +21,40 @@ type Transaction struct {
 	Hash        string `json:"hash"`
 	Signature   string `json:"signature"`
 	Time        int64  `json:"time"`
+	Fee         uint64 `json:"fee"`
 	Script      string `json:"script"`
 }
 
+// TxPoolContent 交易池中可以打包和等待nonce空缺的交易，按发送者分组
+type TxPoolContent struct {
+	Pending map[string][]Transaction `json:"pending"`
+	Queued  map[string][]Transaction `json:"queued"`
+}
+
+// TxEvent 交易池事件，Next是下一次长轮询使用的since
+type TxEvent struct {
+	Seq         uint64 `json:"seq"`
+	Type        string `json:"type"`
+	Hash        string `json:"hash"`
+	From        string `json:"from"`
+	Nonce       uint64 `json:"nonce"`
+	Reason      string `json:"reason,omitempty"`
+	Height      uint64 `json:"height,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+type TxEvents struct {
+	Events []TxEvent `json:"events"`
+	Next   uint64    `json:"next"`
+}
+
 type Block struct {
 	Version       uint64        `json:"version"`
 	Height        uint64        `json:"height"`
 	PrevBlockHash string        `json:"prevblockhash"`
 	Hash          string        `json:"hash"`
 	Root          string        `json:"root"`
+	StateRoot     string        `json:"stateroot"`
 	Timestamp     int64         `json:"timestamp"`
 	Miner         string        `json:"miner"`
 	Txs           []Transaction `json:"txs"`
@@ -41,6 +69,7 @@ func changeTransaction(tx *transaction.Transaction) (result Transaction) {
 	result.Signature = hex.EncodeToString(tx.Signature)
 	result.Time = tx.Time
 	result.BlockNumber = tx.BlockNumber
+	result.Fee = tx.Fee
 
 	return
 }
@@ -50,6 +79,7 @@ func changeBlock(b *block.Block) (result Block) {
 	result.Hash = hex.EncodeToString(b.Hash)
 	result.PrevBlockHash = hex.EncodeToString(b.PrevHash)
 	result.Root = hex.EncodeToString(b.Root)
+	result.StateRoot = hex.EncodeToString(b.StateRoot)
 	result.Timestamp = b.Timestamp
 	result.Version = b.Version
 	result.Miner = b.Miner.String()
@@ -59,3 +89,59 @@ func changeBlock(b *block.Block) (result Block) {
 	}
 	return
 }
+
+func changeTxPoolContent(pending, queued map[types.Address][]*transaction.Transaction, address string) (result TxPoolContent) {
+	convert := func(accounts map[types.Address][]*transaction.Transaction) map[string][]Transaction {
+		views := make(map[string][]Transaction)
+		for from, txs := range accounts {
+			if len(address) != 0 && from.String() != address {
+				continue
+			}
+			for _, tx := range txs {
+				views[from.String()] = append(views[from.String()], changeTransaction(tx))
+			}
+		}
+		return views
+	}
+
+	result.Pending = convert(pending)
+	result.Queued = convert(queued)
+	return
+}
+
+func changeTxEvent(ev txpool.TxEvent) (result TxEvent) {
+	result.Seq = ev.Seq
+	result.Type = ev.Type
+	result.Hash = hex.EncodeToString(ev.Hash)
+	result.From = ev.From.String()
+	result.Nonce = ev.Nonce
+	result.Reason = ev.Reason
+	result.Height = ev.Height
+	if len(ev.Replacement) > 0 {
+		result.Replacement = hex.EncodeToString(ev.Replacement)
+	}
+	return
+}
+
+//把输入的地址转换成带校验和的格式，用于和String()比较，空地址不转换
+func normalizeAddress(address string) (string, error) {
+	if len(address) == 0 {
+		return "", nil
+	}
+	addr, err := types.StringToAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+//地址和哈希为空时不过滤，哈希是十六进制字符串
+func matchTxEvent(ev txpool.TxEvent, address, hash string) bool {
+	if len(address) != 0 && ev.From.String() != address {
+		return false
+	}
+	if len(hash) != 0 && hex.EncodeToString(ev.Hash) != hash {
+		return false
+	}
+	return true
+}
@@ -1,65 +1,124 @@
 package block
 
 import (
-	"bytes"
 	"encoding/json"
-	"fmt"
 
-	"kortho/contract/mixed"
 	"kortho/transaction"
 	"kortho/types"
-
-	"golang.org/x/crypto/sha3"
+	"kortho/util/codec"
 )
 
+// EncodingVersion 区块二进制编码的版本号，区块中交易的编码版本与之相同
+const EncodingVersion = transaction.EncodingVersion
+
 type MinerTx struct {
 	Amount     uint64 `json:"amount"`
 	RecAddress []byte `json:"recaddress"`
 }
 
+// CommitSig 验证者对区块的precommit签名，用于证明区块的最终性
+type CommitSig struct {
+	Round     uint64        `json:"round"`
+	Validator types.Address `json:"validator"`
+	Signature []byte        `json:"signature"`
+}
+
+// Block 区块头和区块体，区块体中的交易通过区块头中的默克尔根被hash覆盖
 type Block struct {
-	Height       uint64                     `json:"height"`    //当前块号
-	PrevHash     []byte                     `json:"prevHash"`  //上一块的hash json:"prevBlockHash --> json:"prevHash
-	Hash         []byte                     `json:"hash"`      //当前块hash
-	Transactions []*transaction.Transaction `json:"txs"`       //交易数据
-	Root         []byte                     `json:"root"`      //默克根
-	Version      uint64                     `json:"version"`   //版本号
-	Timestamp    int64                      `json:"timestamp"` //时间戳
-	Miner        types.Address              `json:"miner"`
-	Results      map[string]uint64          `json:"res"`
+	BlockHeader
+	Hash         []byte                     `json:"hash"`              //当前块hash
+	Transactions []*transaction.Transaction `json:"txs"`               //交易数据
+	Commits      []*CommitSig               `json:"commits,omitempty"` //不参与hash计算
 }
 
 func newBlock(height uint64, prevHash []byte, transactions []*transaction.Transaction) *Block {
 	block := &Block{
-		Height:       height,
-		PrevHash:     prevHash,
+		BlockHeader: BlockHeader{
+			Height:   height,
+			PrevHash: prevHash,
+		},
 		Transactions: transactions,
 	}
 	return block
 }
 
+// Serialize 区块的规范二进制编码，用于存储和网络传输
 func (b *Block) Serialize() []byte {
-	block_byte, err := json.Marshal(b)
-	if err != nil {
-		fmt.Println(err)
-		return nil
+	w := codec.NewWriter()
+	w.WriteUint8(EncodingVersion)
+	b.BlockHeader.encode(w)
+	w.WriteBytes(b.Hash)
+
+	w.WriteUint32(uint32(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		tx.Encode(w, EncodingVersion)
 	}
-	return block_byte
+
+	w.WriteUint32(uint32(len(b.Commits)))
+	for _, c := range b.Commits {
+		w.WriteUint64(c.Round)
+		w.WriteFixed(c.Validator[:])
+		w.WriteBytes(c.Signature)
+	}
+	return w.Bytes()
 }
 
+// Deserialize 解析二进制编码的区块，兼容旧版本的json数据
 func Deserialize(data []byte) (*Block, error) {
 	var block Block
-	if err := json.Unmarshal(data, &block); err != nil {
+	if codec.IsJSON(data) {
+		if err := json.Unmarshal(data, &block); err != nil {
+			return nil, err
+		}
+		return &block, nil
+	}
+
+	r := codec.NewReader(data)
+	version := r.ReadUint8()
+	if version == 0 || version > EncodingVersion {
+		return nil, codec.ErrVersion
+	}
+	block.BlockHeader.decode(r)
+	block.Hash = r.ReadBytes()
+
+	//每笔交易至少占用定长的地址字段，数量不可能超过剩余数据长度
+	n := r.ReadUint32()
+	if uint64(n) > uint64(r.Len()) {
+		return nil, codec.ErrLength
+	}
+	if n > 0 {
+		block.Transactions = make([]*transaction.Transaction, n)
+	}
+	for i := range block.Transactions {
+		tx := &transaction.Transaction{}
+		tx.Decode(r, version)
+		block.Transactions[i] = tx
+	}
+
+	n = r.ReadUint32()
+	if uint64(n) > uint64(r.Len()) {
+		return nil, codec.ErrLength
+	}
+	for i := uint32(0); i < n; i++ {
+		c := &CommitSig{}
+		c.Round = r.ReadUint64()
+		r.ReadFixed(c.Validator[:])
+		c.Signature = r.ReadBytes()
+		block.Commits = append(block.Commits, c)
+	}
+
+	if err := r.Finish(); err != nil {
 		return nil, err
 	}
 	return &block, nil
 }
 
+// Header 返回区块头的拷贝
+func (b *Block) Header() *BlockHeader {
+	header := b.BlockHeader
+	return &header
+}
+
 func (b *Block) SetHash() {
-	heightBytes := mixed.E64func(b.Height)
-	txsBytes, _ := json.Marshal(b.Transactions)
-	timeBytes := mixed.E64func(uint64(b.Timestamp))
-	blockBytes := bytes.Join([][]byte{heightBytes, b.PrevHash, txsBytes, timeBytes}, []byte{})
-	hash := sha3.Sum256(blockBytes)
-	b.Hash = hash[:]
+	b.Hash = b.BlockHeader.Hash()
 }
@@ -0,0 +1,67 @@
+package block
+
+import (
+	"kortho/types"
+	"kortho/util/codec"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// BlockHeader 区块头，区块hash是区块头规范编码的hash，
+// 交易通过Root、账户状态通过StateRoot间接被hash覆盖
+type BlockHeader struct {
+	Version       uint64        `json:"version"`       //版本号
+	Height        uint64        `json:"height"`        //当前块号
+	PrevHash      []byte        `json:"prevHash"`      //上一块的hash
+	Root          []byte        `json:"root"`          //交易默克尔根
+	StateRoot     []byte        `json:"stateRoot"`     //状态根
+	Timestamp     int64         `json:"timestamp"`     //时间戳
+	Miner         types.Address `json:"miner"`         //出块者
+	ConsensusData []byte        `json:"consensusData"` //共识相关数据
+}
+
+// Encode 区块头的规范编码：定长字段大端序，变长字段带4字节长度前缀
+func (h *BlockHeader) Encode() []byte {
+	w := codec.NewWriter()
+	h.encode(w)
+	return w.Bytes()
+}
+
+func (h *BlockHeader) encode(w *codec.Writer) {
+	w.WriteUint64(h.Version)
+	w.WriteUint64(h.Height)
+	w.WriteBytes(h.PrevHash)
+	w.WriteBytes(h.Root)
+	w.WriteBytes(h.StateRoot)
+	w.WriteInt64(h.Timestamp)
+	w.WriteFixed(h.Miner[:])
+	w.WriteBytes(h.ConsensusData)
+}
+
+// DecodeHeader 解析Encode生成的数据
+func DecodeHeader(data []byte) (*BlockHeader, error) {
+	r := codec.NewReader(data)
+	h := &BlockHeader{}
+	h.decode(r)
+	if err := r.Finish(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *BlockHeader) decode(r *codec.Reader) {
+	h.Version = r.ReadUint64()
+	h.Height = r.ReadUint64()
+	h.PrevHash = r.ReadBytes()
+	h.Root = r.ReadBytes()
+	h.StateRoot = r.ReadBytes()
+	h.Timestamp = r.ReadInt64()
+	r.ReadFixed(h.Miner[:])
+	h.ConsensusData = r.ReadBytes()
+}
+
+// Hash 区块头规范编码的sha3-256
+func (h *BlockHeader) Hash() []byte {
+	hash := sha3.Sum256(h.Encode())
+	return hash[:]
+}
@@ -1,9 +1,11 @@
 package blockchain
 
 import (
+	"bytes"
 	"crypto/sha256"
-	"encoding/json"
+	"encoding/hex"
 	"errors"
+	"io"
 	"kortho/block"
 	"kortho/logger"
 	"kortho/transaction"
@@ -12,6 +14,7 @@ import (
 	"kortho/util/mixed"
 	"kortho/util/storage"
 	"kortho/util/storage/db"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -32,6 +35,7 @@ var (
 var (
 	AddrListPrefix = []byte("addr")
 	HeightPrefix   = []byte("blockheight")
+	HeaderPrefix   = []byte("header")
 	TxListName     = []byte("txlist")
 )
 
@@ -39,20 +43,23 @@ type Blockchains interface {
 	NewBlock([]*transaction.Transaction, types.Address, types.Address, types.Address, types.Address) (*block.Block, error)
 	AddBlock(*block.Block, []byte) error
 
+	ChainID() uint64
+	LegacyAllowed(uint64) bool
 	GetNonce([]byte) (uint64, error)
 	GetBalance([]byte) (uint64, error)
 	GetHeight() (uint64, error)
 	GetHash(uint64) ([]byte, error)
 	GetBlockByHash([]byte) (*block.Block, error)
 	GetBlockByHeight(uint64) (*block.Block, error)
+	GetHeaderByHash([]byte) (*block.BlockHeader, error)
+	GetHeaderByHeight(uint64) (*block.BlockHeader, error)
 
 	GetTransactions(int64, int64) ([]*transaction.Transaction, error)
 	GetTransactionByHash([]byte) (*transaction.Transaction, error)
 	GetTransactionByAddr([]byte, int64, int64) ([]*transaction.Transaction, error)
 	GetMaxBlockHeight() (uint64, error)
 
-	CalculationResults(block *block.Block) *block.Block
-	CheckResults(block *block.Block, Ds, Cm, qtj []byte) bool
+	CheckBlock(*block.Block) error
 	GetBlockSection(currentHeight, prevHeight uint64) ([]*block.Block, error)
 }
 
@@ -60,11 +67,22 @@ type Blockchain struct {
 	mu  sync.RWMutex
 	db  storage.DB
 	cdb storage.DB
+
+	chainID       uint64
+	legacyHeight  uint64
+	forkChoice    ForkChoice
+	blockVerifier func(*block.Block) error
+	orphanHandler func([]*transaction.Transaction)
 }
 
 func New() *Blockchain {
-	bgs := db.New("blockchain.db")
-	bgc := db.New("contract.db")
+	return NewWithDir(".")
+}
+
+// NewWithDir 数据库保存在指定目录下，同一个进程中可以打开多条链
+func NewWithDir(dir string) *Blockchain {
+	bgs := db.New(filepath.Join(dir, BlockchainDBName))
+	bgc := db.New(filepath.Join(dir, ContractDBName))
 	bc := &Blockchain{db: bgs, cdb: bgc}
 
 	return bc
@@ -75,23 +93,18 @@ func GetBlockchain() *Blockchain {
 }
 
 func (bc *Blockchain) NewBlock(txs []*transaction.Transaction, minaddr, Ds, Cm, QTJ types.Address) (*block.Block, error) {
-	var height, prevHeight uint64
-	var prevHash []byte
+	//第一个块是创世块，由SetupGenesis提交
 	prevHeight, err := bc.GetHeight()
 	if err != nil {
-		prevHeight = 0
-		logger.Info("Frist block")
+		logger.Error("Genesis block is not committed", zap.Error(err))
+		return nil, errNoGenesis
 	}
-	height = prevHeight + 1
+	height := prevHeight + 1
 
-	if height > 1 {
-		prevHash, err = bc.GetHash(prevHeight)
-		if err != nil {
-			logger.Error("Faied to get hash", zap.Error(err), zap.Uint64("height", prevHeight))
-			return nil, err
-		}
-	} else {
-		prevHash = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	prevHash, err := bc.GetHash(prevHeight)
+	if err != nil {
+		logger.Error("Faied to get hash", zap.Error(err), zap.Uint64("height", prevHeight))
+		return nil, err
 	}
 
 	txBytesList := make([][]byte, 0, len(txs))
@@ -103,13 +116,21 @@ func (bc *Blockchain) NewBlock(txs []*transaction.Transaction, minaddr, Ds, Cm,
 	root := tree.GetMtHash()
 
 	block := &block.Block{
-		Height:       height,
-		PrevHash:     prevHash,
+		BlockHeader: block.BlockHeader{
+			Version:   1,
+			Height:    height,
+			PrevHash:  prevHash,
+			Root:      root,
+			Timestamp: time.Now().Unix(),
+			Miner:     minaddr,
+		},
 		Transactions: txs,
-		Root:         root,
-		Version:      1,
-		Timestamp:    time.Now().Unix(),
-		Miner:        minaddr,
+	}
+
+	//在丢弃的事务中执行交易得到状态根
+	if block.StateRoot, err = bc.stateRoot(block, minaddr.Bytes()); err != nil {
+		logger.Error("Failed to calculate state root", zap.Error(err), zap.Uint64("height", height))
+		return nil, err
 	}
 	block.SetHash()
 
@@ -117,15 +138,145 @@ func (bc *Blockchain) NewBlock(txs []*transaction.Transaction, minaddr, Ds, Cm,
 }
 
 func (bc *Blockchain) AddBlock(block *block.Block, minaddr []byte) error {
+	if len(minaddr) == 0 {
+		return errEmptyAddress
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	//所有的修改在同一个事务中完成，任何一步失败都回滚
+	DBTransaction := bc.db.NewTransaction()
+	defer DBTransaction.Cancel()
+
+	if err := applyBlock(DBTransaction, block, minaddr); err != nil {
+		return err
+	}
+
+	return DBTransaction.Commit()
+}
+
+//把区块接到事务中的当前最高块之后，同时记录回滚需要的undo数据
+func applyBlock(DBTransaction storage.Transaction, block *block.Block, minaddr []byte) error {
+	if err := checkBlock(DBTransaction, block); err != nil {
+		logger.Error("Failed to check block", zap.Error(err), zap.Uint64("height", block.Height))
+		return err
+	}
+
+	undo, root, err := executeBlock(DBTransaction, block, minaddr)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, block.StateRoot) {
+		logger.Error("State root mismatch", zap.Uint64("height", block.Height),
+			zap.String("root", hex.EncodeToString(root)), zap.String("block", hex.EncodeToString(block.StateRoot)))
+		return errStateRoot
+	}
+
+	if err := DBTransaction.Set(undoKey(block.Hash), undo.Serialize()); err != nil {
+		logger.Error("Failed to set undo record", zap.Error(err))
+		return err
+	}
+	if err := DBTransaction.Set(block.Hash, block.Serialize()); err != nil {
+		logger.Error("Failed to set block", zap.Error(err))
+		return err
+	}
+	if err := DBTransaction.Set(headerKey(block.Hash), block.Encode()); err != nil {
+		logger.Error("Failed to set block header", zap.Error(err))
+		return err
+	}
+	if err := DBTransaction.Set(heightKey(block.Height), block.Hash); err != nil {
+		logger.Error("Failed to set height index", zap.Error(err))
+		return err
+	}
+	if err := DBTransaction.Set(HeightKey, mixed.E64func(block.Height)); err != nil {
+		logger.Error("Failed to set height", zap.Error(err))
+		return err
+	}
+
 	return nil
 }
 
+//检查区块是否能接在事务中的当前最高块之后
+func checkBlock(DBTransaction storage.Transaction, b *block.Block) error {
+	var prevHash []byte
+	prevHeight, err := getHeight(DBTransaction)
+	if err != nil {
+		prevHeight = 0
+		prevHash = make([]byte, 32)
+	} else if prevHash, err = DBTransaction.Get(heightKey(prevHeight)); err != nil {
+		return err
+	}
+
+	if b.Height != prevHeight+1 {
+		return errHeight
+	}
+	if !bytes.Equal(b.PrevHash, prevHash) {
+		return errPrevHash
+	}
+	if err := checkTxChainID(DBTransaction, b); err != nil {
+		return err
+	}
+
+	return verifyBlock(b)
+}
+
+//检查区块自身的hash、默克尔根和交易签名
+func verifyBlock(b *block.Block) error {
+	hash := b.Hash
+	b.SetHash()
+	if !bytes.Equal(hash, b.Hash) {
+		b.Hash = hash
+		return errBlockHash
+	}
+
+	txBytesList := make([][]byte, 0, len(b.Transactions))
+	for _, tx := range b.Transactions {
+		txBytesList = append(txBytesList, tx.Serialize())
+	}
+	if !bytes.Equal(merkle.New(sha256.New(), txBytesList).GetMtHash(), b.Root) {
+		return errBlockRoot
+	}
+
+	for _, tx := range b.Transactions {
+		if tx.Version > transaction.TxVersion {
+			return errTxVersion
+		}
+		if !tx.IsCoinBaseTransaction() && !tx.Verify() {
+			return errTxSignature
+		}
+	}
+
+	return nil
+}
+
+func getHeight(DBTransaction storage.Transaction) (uint64, error) {
+	heightBytes, err := DBTransaction.Get(HeightKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return mixed.D64func(heightBytes)
+}
+
+func (bc *Blockchain) getHeight() (uint64, error) {
+	heightBytes, err := bc.db.Get(HeightKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return mixed.D64func(heightBytes)
+}
+
+// GetNonce 账户下一笔交易的nonce，没有发送过交易时为1；只读，不写入默认值
 func (bc *Blockchain) GetNonce(address []byte) (uint64, error) {
 	nonce, err := bc.getNonce(address)
-	if err != nil {
-		bc.setNonce(address, 1)
+	if err == storage.NotExist {
 		return 1, nil
 	}
+	if err != nil {
+		return 0, err
+	}
 
 	return nonce, nil
 }
@@ -134,7 +285,7 @@ func (bc *Blockchain) getNonce(address []byte) (uint64, error) {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	nonceBytes, err := bc.db.Mget(address, NonceKey)
+	nonceBytes, err := bc.db.Mget(NonceKey, address)
 	if err != nil {
 		return 0, err
 	}
@@ -142,14 +293,6 @@ func (bc *Blockchain) getNonce(address []byte) (uint64, error) {
 	return mixed.D64func(nonceBytes)
 }
 
-func (bc *Blockchain) setNonce(address []byte, nonce uint64) error {
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
-
-	nonceBytes := mixed.E64func(nonce)
-	return bc.db.Mset(NonceKey, address, nonceBytes)
-}
-
 func (bc *Blockchain) GetBalance(address []byte) (uint64, error) {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
@@ -166,12 +309,7 @@ func (bc *Blockchain) GetHeight() (height uint64, err error) {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	heightBytes, err := bc.db.Get(HeightKey)
-	if err != nil {
-		return
-	}
-
-	return mixed.D64func(heightBytes)
+	return bc.getHeight()
 }
 
 //根据块高h获取hash
@@ -179,7 +317,7 @@ func (bc *Blockchain) GetHash(height uint64) (hash []byte, err error) {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	return bc.db.Get(append(HeightPrefix, mixed.E64func(height)...))
+	return bc.db.Get(heightKey(height))
 }
 
 //通过块hash获取块数据
@@ -194,6 +332,34 @@ func (bc *Blockchain) GetBlockByHash(hash []byte) (*block.Block, error) { //
 	return block.Deserialize(blockData)
 }
 
+//通过hash获取区块头，不需要读取和解析交易
+func (bc *Blockchain) GetHeaderByHash(hash []byte) (*block.BlockHeader, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	headerData, err := bc.db.Get(headerKey(hash))
+	if err != nil {
+		return nil, err
+	}
+	return block.DecodeHeader(headerData)
+}
+
+//通过块高获取区块头
+func (bc *Blockchain) GetHeaderByHeight(height uint64) (*block.BlockHeader, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	hash, err := bc.db.Get(heightKey(height))
+	if err != nil {
+		return nil, err
+	}
+	headerData, err := bc.db.Get(headerKey(hash))
+	if err != nil {
+		return nil, err
+	}
+	return block.DecodeHeader(headerData)
+}
+
 //通过块高获取块数据
 func (bc *Blockchain) GetBlockByHeight(height uint64) (*block.Block, error) {
 
@@ -205,7 +371,7 @@ func (bc *Blockchain) GetBlockByHeight(height uint64) (*block.Block, error) {
 	defer bc.mu.RUnlock()
 
 	// 1、先获取到hash
-	hash, err := bc.db.Get(append(HeightPrefix, mixed.E64func(height)...))
+	hash, err := bc.db.Get(heightKey(height))
 	if err != nil {
 		return nil, err
 	}
@@ -237,9 +403,9 @@ func (bc *Blockchain) GetTransactions(start, end int64) ([]*transaction.Transact
 			return nil, err
 		}
 
-		transaction := &transaction.Transaction{}
-		if err := json.Unmarshal(txBytes, transaction); err != nil {
-			logger.Error("Failed to unmarshal bytes", zap.Error(err))
+		transaction, err := transaction.Deserialize(txBytes)
+		if err != nil {
+			logger.Error("Failed to deserialize transaction", zap.Error(err))
 			return nil, err
 		}
 
@@ -259,13 +425,7 @@ func (bc *Blockchain) GetTransactionByHash(hash []byte) (*transaction.Transactio
 		return nil, err
 	}
 
-	transaction := &transaction.Transaction{}
-	err = json.Unmarshal(txBytes, transaction)
-	if err != nil {
-		return nil, err
-	}
-
-	return transaction, nil
+	return transaction.Deserialize(txBytes)
 }
 
 func (bc *Blockchain) GetTransactionByAddr(address []byte, start, end int64) ([]*transaction.Transaction, error) {
@@ -285,17 +445,30 @@ func (bc *Blockchain) GetTransactionByAddr(address []byte, start, end int64) ([]
 			logger.Error("Failed to get transaction", zap.Error(err), zap.ByteString("hash", hash))
 			return nil, err
 		}
-		var tx transaction.Transaction
-		if err := json.Unmarshal(txBytes, &tx); err != nil {
-			logger.Error("Failed to unmarshal bytes", zap.Error(err))
+		tx, err := transaction.Deserialize(txBytes)
+		if err != nil {
+			logger.Error("Failed to deserialize transaction", zap.Error(err))
 			return nil, err
 		}
-		transactions = append(transactions, &tx)
+		transactions = append(transactions, tx)
 	}
 
 	return transactions, nil
 }
 
+//导出整个区块链状态的快照
+func (bc *Blockchain) Snapshot(w io.Writer) error {
+	return bc.db.Backup(w)
+}
+
+//用快照覆盖当前区块链状态
+func (bc *Blockchain) Restore(r io.Reader) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.db.Restore(r)
+}
+
 func (bc *Blockchain) GetContractDB() storage.DB {
 	return bc.cdb
 }
@@ -312,6 +485,43 @@ func (bc *Blockchain) GetMaxBlockHeight() (uint64, error) {
 	return mixed.D64func(heightBytes)
 }
 
+func heightKey(height uint64) []byte {
+	key := make([]byte, 0, len(HeightPrefix)+8)
+	key = append(key, HeightPrefix...)
+	return append(key, mixed.E64func(height)...)
+}
+
+func headerKey(hash []byte) []byte {
+	key := make([]byte, 0, len(HeaderPrefix)+len(hash))
+	key = append(key, HeaderPrefix...)
+	return append(key, hash...)
+}
+
+//检查交易的nonce和余额
+func checkAccount(DBTransaction storage.Transaction, tx *transaction.Transaction) error {
+	nonce := uint64(1)
+	if nonceBytes, err := DBTransaction.Mget(NonceKey, tx.From.Bytes()); err == nil {
+		if nonce, err = mixed.D64func(nonceBytes); err != nil {
+			return err
+		}
+	}
+	if tx.Nonce != nonce {
+		return errTxNonce
+	}
+
+	var balance uint64
+	if balanceBytes, err := DBTransaction.Get(tx.From.Bytes()); err == nil {
+		if balance, err = mixed.D64func(balanceBytes); err != nil {
+			return err
+		}
+	}
+	if cost, ok := tx.Cost(); !ok || balance < cost {
+		return errTxBalance
+	}
+
+	return nil
+}
+
 func setMinerFee(tx storage.Transaction, to []byte, amount uint64) error {
 	tobalance, err := tx.Get(to)
 	if err != nil {
@@ -342,8 +552,7 @@ func setTxList(DBTransaction storage.Transaction, tx *transaction.Transaction) e
 	}
 
 	//交易hash->交易数据
-	txBytes, _ := json.Marshal(tx)
-	if err := DBTransaction.Set(tx.Hash, txBytes); err != nil {
+	if err := DBTransaction.Set(tx.Hash, tx.Serialize()); err != nil {
 		logger.Error("Failed to set transaction", zap.Error(err))
 		return err
 	}
@@ -376,10 +585,12 @@ func setAccount(DBTransaction storage.Transaction, tx *transaction.Transaction)
 
 	fromBalBytes, _ := DBTransaction.Get(from)
 	fromBalance, _ := mixed.D64func(fromBalBytes)
-	if tx.IsTokenTransaction() {
-		fromBalance -= tx.Amount + tx.Fee
-	} else {
-		fromBalance -= tx.Amount
+	cost, _ := tx.Cost()
+	fromBalance -= cost
+
+	//转给自己时只扣除手续费，不能用扣除前的余额覆盖
+	if bytes.Equal(from, to) {
+		return setBalance(DBTransaction, from, mixed.E64func(fromBalance+tx.Amount))
 	}
 
 	tobalance, err := DBTransaction.Get(to)
@@ -409,81 +620,13 @@ func setBalance(tx storage.Transaction, addr, balance []byte) error {
 	return tx.Set(addr, balance)
 }
 
-func (bc *Blockchain) CalculationResults(block *block.Block) *block.Block {
-	block.Results = make(map[string]uint64)
-	for _, tx := range block.Transactions {
-		if !tx.IsCoinBaseTransaction() {
-			if balance, ok := block.Results[tx.From.String()]; ok {
-				balance -= tx.Amount
-				if tx.IsTokenTransaction() {
-					balance -= tx.Fee
-				}
-				block.Results[tx.From.String()] = balance
-			} else {
-				balanceBytes, err := bc.db.Get(tx.From.Bytes())
-				if err != nil {
-					//TODO:如果找不到改该地址如何处理
-				}
-				balance, _ := mixed.D64func(balanceBytes)
-				block.Results[tx.From.String()] = balance - tx.Amount
-			}
-		}
-
-		if balance, ok := block.Results[tx.To.String()]; ok {
-			balance += tx.Amount
-			block.Results[tx.To.String()] = balance
-		} else {
-			var balance uint64
-			balanceBytes, err := bc.db.Get(tx.To.Bytes())
-			if err != nil {
-				balance = 0
-			} else {
-				balance, _ = mixed.D64func(balanceBytes)
-			}
-			block.Results[tx.To.String()] = balance + tx.Amount
-		}
-	}
-
-	return block
-}
-
-func (bc *Blockchain) CheckResults(block *block.Block, Ds, Cm, qtj []byte) bool {
-
-	//1、最后一笔交易必须是coinbase交易
-	if !block.Transactions[len(block.Transactions)-1].IsCoinBaseTransaction() {
-		logger.Info("The last transaction is not coin base")
-		return false
-	}
-
-	//2、验证leader和follower的区块交易地址的余额
-	currBlock := bc.CalculationResults(block)
-	for _, tx := range block.Transactions {
-		if !tx.IsCoinBaseTransaction() {
-			if balance, ok := block.Results[tx.From.String()]; !ok {
-				logger.Info("address is not exist", zap.String("from", tx.From.String()))
-				return false
-			} else if balance != currBlock.Results[tx.From.String()] {
-				logger.Info("balance is not equal", zap.Uint64("curBalnce", balance), zap.Uint64("resBalance", currBlock.Results[tx.From.String()]))
-				return false
-			}
-		}
-
-		if balance, ok := block.Results[tx.To.String()]; !ok {
-			logger.Info("address is not exist", zap.String("to", tx.To.String()))
-			return false
-		} else if balance != currBlock.Results[tx.To.String()] {
-			logger.Info("balance is not equal", zap.Uint64("curBalnce", balance), zap.Uint64("resBalance", currBlock.Results[tx.To.String()]))
-			return false
-		}
-	}
-
-	return true
-}
-
 func (bc *Blockchain) GetBlockSection(currentHeight, prevHeight uint64) ([]*block.Block, error) {
 	var blocks []*block.Block
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
 	for i := prevHeight; i <= currentHeight; i++ {
-		hash, err := bc.db.Mget(mixed.E64func(i), HashKey)
+		hash, err := bc.db.Get(heightKey(i))
 		if err != nil {
 			logger.Error("Failed to get hash", zap.Error(err), zap.Uint64("height", i))
 			return nil, err
@@ -494,9 +637,9 @@ func (bc *Blockchain) GetBlockSection(currentHeight, prevHeight uint64) ([]*bloc
 			return nil, err
 		}
 
-		blcok := &block.Block{}
-		if err := json.Unmarshal(B, blcok); err != nil {
-			logger.Error("Failed to unmarshal block", zap.Error(err), zap.String("hash", string(hash)))
+		blcok, err := block.Deserialize(B)
+		if err != nil {
+			logger.Error("Failed to deserialize block", zap.Error(err), zap.String("hash", hex.EncodeToString(hash)))
 			return nil, err
 		}
 		blocks = append(blocks, blcok)
@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"os"
+	"testing"
+
+	"kortho/config"
+	"kortho/transaction"
+	"kortho/types"
+	"kortho/util/merkle"
+	"kortho/util/storage"
+)
+
+type testAccount struct {
+	priv []byte
+	addr types.Address
+}
+
+func newTestAccount(t *testing.T) *testAccount {
+	w := types.NewWallet()
+	addr, err := types.StringToAddress(w.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testAccount{priv: w.PrivateKey, addr: *addr}
+}
+
+func (a *testAccount) transfer(nonce, amount uint64, to types.Address) *transaction.Transaction {
+	tx := transaction.NewTransaction(nonce, amount, a.addr, to, transaction.WithChainID(1))
+	tx.Sgin(a.priv)
+	return tx
+}
+
+func (a *testAccount) balance(t *testing.T, bc *Blockchain) uint64 {
+	balance, err := bc.GetBalance(a.addr.Bytes())
+	if err == storage.NotExist {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+//区块中任何一笔交易失败，整个区块的修改都不能写入
+func TestAddBlockAtomic(t *testing.T) {
+	bc, dir := newTestBlockchain(t)
+	defer os.RemoveAll(dir)
+
+	from, to := newTestAccount(t), newTestAccount(t)
+	genesis := newTestGenesis(config.AllocInfo{Address: from.addr.String(), Balance: 1000})
+	if _, err := bc.SetupGenesis(genesis); err != nil {
+		t.Fatal(err)
+	}
+
+	//第二笔交易余额不足，第一笔交易的转账也要回滚
+	b, err := bc.NewBlock([]*transaction.Transaction{from.transfer(1, 300, to.addr)}, to.addr, to.addr, to.addr, to.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := *b
+	overspend := from.transfer(2, 800, to.addr)
+	overspend.BlockNumber = b.Height
+	bad.Transactions = append(b.Transactions[:1:1], overspend)
+	var txBytesList [][]byte
+	for _, tx := range bad.Transactions {
+		txBytesList = append(txBytesList, tx.Serialize())
+	}
+	bad.Root = merkle.New(sha256.New(), txBytesList).GetMtHash()
+	bad.SetHash()
+
+	if err := bc.AddBlock(&bad, to.addr.Bytes()); err == nil {
+		t.Fatal("added a block with an overspending transaction")
+	}
+	if height, err := bc.GetHeight(); err != nil || height != 1 {
+		t.Fatalf("height %d, %v", height, err)
+	}
+	if nonce, err := bc.GetNonce(from.addr.Bytes()); err != nil || nonce != 1 {
+		t.Fatalf("nonce %d, %v", nonce, err)
+	}
+	if balance := from.balance(t, bc); balance != 1000 {
+		t.Fatalf("sender balance %d, want 1000", balance)
+	}
+	if _, err := bc.GetBlockByHash(bad.Hash); err == nil {
+		t.Fatal("failed block is stored")
+	}
+
+	if err := bc.AddBlock(b, to.addr.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if balance := from.balance(t, bc); balance != 700 {
+		t.Fatalf("sender balance %d, want 700", balance)
+	}
+	if balance := to.balance(t, bc); balance != 300 {
+		t.Fatalf("receiver balance %d, want 300", balance)
+	}
+}
+
+//查询nonce不能改变状态，否则查询过的节点算出的状态根和其他节点不同
+func TestGetNonceReadOnly(t *testing.T) {
+	bc, dir := newTestBlockchain(t)
+	defer os.RemoveAll(dir)
+	other, otherDir := newTestBlockchain(t)
+	defer os.RemoveAll(otherDir)
+
+	from, to := newTestAccount(t), newTestAccount(t)
+	genesis := newTestGenesis(config.AllocInfo{Address: from.addr.String(), Balance: 1000})
+	for _, c := range []*Blockchain{bc, other} {
+		if _, err := c.SetupGenesis(genesis); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, addr := range []types.Address{from.addr, to.addr} {
+		if nonce, err := bc.GetNonce(addr.Bytes()); err != nil || nonce != 1 {
+			t.Fatalf("nonce %d, %v", nonce, err)
+		}
+		if _, err := bc.db.Mget(NonceKey, addr.Bytes()); err != storage.NotExist {
+			t.Fatalf("default nonce is stored: %v", err)
+		}
+	}
+
+	b, err := other.NewBlock([]*transaction.Transaction{from.transfer(1, 300, to.addr)}, to.addr, to.addr, to.addr, to.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.AddBlock(b, to.addr.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(b, to.addr.Bytes()); err != nil {
+		t.Fatalf("block from a peer rejected after nonce queries: %v", err)
+	}
+}
+
+//普通转账的手续费从发送者扣除，支付给出块者
+func TestTransferFee(t *testing.T) {
+	bc, dir := newTestBlockchain(t)
+	defer os.RemoveAll(dir)
+
+	from, to, miner := newTestAccount(t), newTestAccount(t), newTestAccount(t)
+	genesis := newTestGenesis(config.AllocInfo{Address: from.addr.String(), Balance: 1000})
+	if _, err := bc.SetupGenesis(genesis); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := transaction.NewTransaction(1, 300, from.addr, to.addr, transaction.WithChainID(1))
+	tx.Fee = 50
+	tx.HashTransaction()
+	tx.Sgin(from.priv)
+	//转给自己只扣除手续费
+	self := transaction.NewTransaction(2, 300, from.addr, from.addr, transaction.WithChainID(1))
+	self.Fee = 50
+	self.HashTransaction()
+	self.Sgin(from.priv)
+	b, err := bc.NewBlock([]*transaction.Transaction{tx, self}, miner.addr, miner.addr, miner.addr, miner.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(b, miner.addr.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		a    *testAccount
+		want uint64
+	}{{from, 600}, {to, 300}, {miner, 100}} {
+		if balance := c.a.balance(t, bc); balance != c.want {
+			t.Fatalf("balance %d, want %d", balance, c.want)
+		}
+	}
+}
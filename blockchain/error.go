@@ -0,0 +1,38 @@
+package blockchain
+
+import "errors"
+
+var (
+	errHeight        = errors.New("block height does not follow the current height")
+	errPrevHash      = errors.New("block prev hash does not match the current hash")
+	errBlockHash     = errors.New("block hash is error")
+	errBlockRoot     = errors.New("block merkle root is error")
+	errStateRoot     = errors.New("block state root does not match the executed state")
+	errTxVersion     = errors.New("unsupported transaction version")
+	errTxChainID     = errors.New("transaction chain id does not match the chain")
+	errTxLegacy      = errors.New("legacy transaction is not accepted at this height")
+	errTxSignature   = errors.New("failed to verify transaction signature")
+	errTxNonce       = errors.New("transaction nonce is error")
+	errTxBalance     = errors.New("insufficient balance")
+	errEmptyAddress  = errors.New("miner address is empty")
+	errNoGenesis     = errors.New("genesis block is not committed")
+	errGenesisAlloc  = errors.New("duplicate address in genesis alloc")
+	errGenesisHash   = errors.New("stored genesis hash does not match the configured genesis")
+	errChainID       = errors.New("stored chain id does not match the configured chain id")
+	errRevertBlock   = errors.New("only the current block can be reverted")
+	errKnownBlock    = errors.New("block is already known")
+	errUnknownParent = errors.New("parent block is unknown")
+	errReorgDepth    = errors.New("chain reorganization is too deep")
+	errBlockVerify   = errors.New("block failed consensus verification")
+	errSideBlocks    = errors.New("too many side blocks at this height")
+)
+
+// IsInvalidBlock 区块本身不合法，而不是本地读写出错，同步时据此处罚发送区块的节点
+func IsInvalidBlock(err error) bool {
+	switch err {
+	case errHeight, errPrevHash, errBlockHash, errBlockRoot, errStateRoot, errTxVersion, errTxChainID, errTxLegacy,
+		errTxSignature, errTxNonce, errTxBalance, errUnknownParent, errReorgDepth, errBlockVerify:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"kortho/block"
+	"kortho/config"
+	"kortho/logger"
+	"kortho/transaction"
+	"kortho/types"
+	"kortho/util/codec"
+	"kortho/util/merkle"
+	"kortho/util/mixed"
+	"kortho/util/storage"
+
+	"go.uber.org/zap"
+)
+
+var (
+	GenesisKey      = []byte("genesis")
+	ChainIDKey      = []byte("chainid")
+	LegacyHeightKey = []byte("legacyheight")
+)
+
+//根据创世配置生成创世块，相同的配置总是生成相同的块
+func NewGenesisBlock(cfg *config.GenesisConfigInfo) (*block.Block, error) {
+	qtj, err := types.StringToAddress(cfg.QTJAddress)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := types.StringToAddress(cfg.DSAddress)
+	if err != nil {
+		return nil, err
+	}
+	cm, err := types.StringToAddress(cfg.CMAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	alloc := make([]config.AllocInfo, len(cfg.Alloc))
+	copy(alloc, cfg.Alloc)
+	sort.Slice(alloc, func(i, j int) bool { return alloc[i].Address < alloc[j].Address })
+
+	txs := make([]*transaction.Transaction, 0, len(alloc))
+	txBytesList := make([][]byte, 0, len(alloc))
+	for i, a := range alloc {
+		if i > 0 && alloc[i-1].Address == a.Address {
+			return nil, errGenesisAlloc
+		}
+		to, err := types.StringToAddress(a.Address)
+		if err != nil {
+			return nil, err
+		}
+		//链ID参与交易hash，不同链的创世块不同
+		tx := &transaction.Transaction{
+			Version:     transaction.TxVersion,
+			ChainID:     cfg.ChainID,
+			BlockNumber: 1,
+			Amount:      a.Balance,
+			To:          *to,
+			Time:        cfg.Timestamp,
+		}
+		tx.HashTransaction()
+		txs = append(txs, tx)
+		txBytesList = append(txBytesList, tx.Serialize())
+	}
+
+	stateRoot, err := genesisStateRoot(txs)
+	if err != nil {
+		return nil, err
+	}
+
+	genesis := &block.Block{
+		BlockHeader: block.BlockHeader{
+			Version:       1,
+			Height:        1,
+			PrevHash:      make([]byte, 32),
+			Root:          merkle.New(sha256.New(), txBytesList).GetMtHash(),
+			StateRoot:     stateRoot,
+			Timestamp:     cfg.Timestamp,
+			Miner:         *qtj,
+			ConsensusData: genesisSpec(cfg.ChainID, cfg.LegacyTxHeight, *ds, *cm),
+		},
+		Transactions: txs,
+	}
+	genesis.SetHash()
+
+	return genesis, nil
+}
+
+//创世块的共识数据记录链ID、接受旧格式交易的高度和DS、CM地址，使它们参与创世块hash，
+//配置不同的节点不会认为在同一条链上
+func genesisSpec(chainID, legacyHeight uint64, ds, cm types.Address) []byte {
+	w := codec.NewWriter()
+	w.WriteUint64(chainID)
+	w.WriteUint64(legacyHeight)
+	w.WriteFixed(ds[:])
+	w.WriteFixed(cm[:])
+	return w.Bytes()
+}
+
+//提交创世块，如果已经存在则检查是否与配置一致
+func (bc *Blockchain) SetupGenesis(cfg *config.GenesisConfigInfo) (*block.Block, error) {
+	genesis, err := NewGenesisBlock(cfg)
+	if err != nil {
+		logger.Error("Failed to new genesis block", zap.Error(err))
+		return nil, err
+	}
+
+	if hash, err := bc.db.Get(GenesisKey); err == nil {
+		if !bytes.Equal(hash, genesis.Hash) {
+			logger.Error("Genesis hash mismatch", zap.String("stored", hex.EncodeToString(hash)), zap.String("config", hex.EncodeToString(genesis.Hash)))
+			return nil, errGenesisHash
+		}
+		if err := bc.checkChainID(cfg.ChainID); err != nil {
+			return nil, err
+		}
+		bc.chainID, bc.legacyHeight = cfg.ChainID, cfg.LegacyTxHeight
+		return genesis, nil
+	}
+
+	if err := bc.commitGenesis(genesis, cfg); err != nil {
+		logger.Error("Failed to add genesis block", zap.Error(err))
+		return nil, err
+	}
+	bc.chainID, bc.legacyHeight = cfg.ChainID, cfg.LegacyTxHeight
+	logger.Info("Commit genesis block", zap.Uint64("chainid", cfg.ChainID), zap.Int("alloc", len(genesis.Transactions)))
+
+	return genesis, nil
+}
+
+//创世块、链ID、旧格式交易高度和GenesisKey在同一个事务中写入
+func (bc *Blockchain) commitGenesis(genesis *block.Block, cfg *config.GenesisConfigInfo) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	DBTransaction := bc.db.NewTransaction()
+	defer DBTransaction.Cancel()
+
+	if err := applyBlock(DBTransaction, genesis, genesis.Miner.Bytes()); err != nil {
+		return err
+	}
+	if err := DBTransaction.Set(ChainIDKey, mixed.E64func(cfg.ChainID)); err != nil {
+		return err
+	}
+	if err := DBTransaction.Set(LegacyHeightKey, mixed.E64func(cfg.LegacyTxHeight)); err != nil {
+		return err
+	}
+	if err := DBTransaction.Set(GenesisKey, genesis.Hash); err != nil {
+		return err
+	}
+	return DBTransaction.Commit()
+}
+
+func (bc *Blockchain) checkChainID(chainID uint64) error {
+	chainIDBytes, err := bc.db.Get(ChainIDKey)
+	if err != nil {
+		return err
+	}
+	stored, err := mixed.D64func(chainIDBytes)
+	if err != nil {
+		return err
+	}
+	if stored != chainID {
+		logger.Error("Chain id mismatch", zap.Uint64("stored", stored), zap.Uint64("config", chainID))
+		return errChainID
+	}
+	return nil
+}
+
+//获取创世块hash
+func (bc *Blockchain) GetGenesisHash() ([]byte, error) {
+	return bc.db.Get(GenesisKey)
+}
+
+// ChainID 创世配置中的链ID，新格式的交易必须签名相同的链ID
+func (bc *Blockchain) ChainID() uint64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.chainID
+}
+
+// LegacyAllowed 高度为height的块是否可以包含旧格式交易，只在创世配置的高度之前接受
+func (bc *Blockchain) LegacyAllowed(height uint64) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return height <= bc.legacyHeight
+}
+
+//旧格式交易的高度限制和链ID一起在创世块提交时写入，没有时不接受旧格式交易
+func getLegacyHeight(DBTransaction storage.Transaction) (uint64, error) {
+	legacyBytes, err := DBTransaction.Get(LegacyHeightKey)
+	if err == storage.NotExist {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return mixed.D64func(legacyBytes)
+}
+
+//检查区块中交易的链ID，链ID在创世块提交之后写入
+func checkTxChainID(DBTransaction storage.Transaction, b *block.Block) error {
+	chainIDBytes, err := DBTransaction.Get(ChainIDKey)
+	if err == storage.NotExist {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	chainID, err := mixed.D64func(chainIDBytes)
+	if err != nil {
+		return err
+	}
+	legacyHeight, err := getLegacyHeight(DBTransaction)
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range b.Transactions {
+		if tx.IsCoinBaseTransaction() {
+			continue
+		}
+		if tx.Version == transaction.LegacyVersion {
+			if b.Height > legacyHeight {
+				return errTxLegacy
+			}
+			continue
+		}
+		if tx.ChainID != chainID {
+			return errTxChainID
+		}
+	}
+	return nil
+}
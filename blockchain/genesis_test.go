@@ -0,0 +1,132 @@
+package blockchain
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kortho/block"
+	"kortho/config"
+	"kortho/logger"
+	"kortho/transaction"
+	"kortho/types"
+	"kortho/util/mixed"
+)
+
+func newTestBlockchain(t *testing.T) (*Blockchain, string) {
+	dir, err := ioutil.TempDir("", "blockchain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.InitLogger(&config.LogConfigInfo{Level: "INFO", FileName: filepath.Join(dir, "test.log")})
+	return NewWithDir(dir), dir
+}
+
+func newTestGenesis(alloc ...config.AllocInfo) *config.GenesisConfigInfo {
+	qtj := types.NewWallet().Address
+	return &config.GenesisConfigInfo{ChainID: 1, Timestamp: 1600000000, QTJAddress: qtj, DSAddress: qtj, CMAddress: qtj, Alloc: alloc}
+}
+
+func TestGenesisSpec(t *testing.T) {
+	cfg := newTestGenesis()
+	genesis, err := NewGenesisBlock(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := NewGenesisBlock(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(genesis.Hash, again.Hash) {
+		t.Fatal("genesis is not deterministic")
+	}
+
+	//DS和CM地址参与创世块hash
+	for _, change := range []func(c *config.GenesisConfigInfo){
+		func(c *config.GenesisConfigInfo) { c.DSAddress = types.NewWallet().Address },
+		func(c *config.GenesisConfigInfo) { c.CMAddress = types.NewWallet().Address },
+		func(c *config.GenesisConfigInfo) { c.ChainID = 2 },
+	} {
+		other := *cfg
+		change(&other)
+		b, err := NewGenesisBlock(&other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(b.Hash, genesis.Hash) {
+			t.Fatalf("genesis hash does not cover %+v", other)
+		}
+	}
+}
+
+func TestSetupGenesis(t *testing.T) {
+	bc, dir := newTestBlockchain(t)
+	defer os.RemoveAll(dir)
+
+	cfg := newTestGenesis(config.AllocInfo{Address: types.NewWallet().Address, Balance: 100})
+	genesis, err := bc.SetupGenesis(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := bc.GetGenesisHash()
+	if err != nil || !bytes.Equal(hash, genesis.Hash) {
+		t.Fatalf("genesis key: %v", err)
+	}
+	if err := bc.checkChainID(cfg.ChainID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.SetupGenesis(cfg); err != nil {
+		t.Fatalf("setup again: %v", err)
+	}
+
+	other := *cfg
+	other.CMAddress = types.NewWallet().Address
+	if _, err := bc.SetupGenesis(&other); err != errGenesisHash {
+		t.Fatalf("different spec: %v", err)
+	}
+	//旧格式交易的高度是共识规则，不同的配置不在同一条链上
+	other = *cfg
+	other.LegacyTxHeight = 100
+	if _, err := bc.SetupGenesis(&other); err != errGenesisHash {
+		t.Fatalf("different legacy height: %v", err)
+	}
+}
+
+//旧格式交易只能出现在LegacyHeight之前的块中
+func TestCheckTxChainID(t *testing.T) {
+	bc, dir := newTestBlockchain(t)
+	defer os.RemoveAll(dir)
+	if _, err := bc.SetupGenesis(newTestGenesis()); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := newTestAccount(t), newTestAccount(t)
+	legacy := from.transfer(1, 1, to.addr)
+	legacy.Version = transaction.LegacyVersion
+	wrong := transaction.NewTransaction(1, 1, from.addr, to.addr, transaction.WithChainID(2))
+
+	DBTransaction := bc.db.NewTransaction()
+	defer DBTransaction.Cancel()
+	for _, c := range []struct {
+		tx     *transaction.Transaction
+		height uint64
+		legacy uint64
+		want   error
+	}{
+		{from.transfer(1, 1, to.addr), 2, 0, nil},
+		{wrong, 2, 10, errTxChainID},
+		{legacy, 2, 0, errTxLegacy},
+		{legacy, 10, 10, nil},
+		{legacy, 11, 10, errTxLegacy},
+	} {
+		if err := DBTransaction.Set(LegacyHeightKey, mixed.E64func(c.legacy)); err != nil {
+			t.Fatal(err)
+		}
+		b := &block.Block{BlockHeader: block.BlockHeader{Height: c.height}, Transactions: []*transaction.Transaction{c.tx}}
+		if err := checkTxChainID(DBTransaction, b); err != c.want {
+			t.Fatalf("height %d, legacy height %d: %v, want %v", c.height, c.legacy, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package blockchain
+
+import (
+	"kortho/block"
+	"kortho/logger"
+	"kortho/transaction"
+	"kortho/util/codec"
+	"kortho/util/storage"
+
+	"go.uber.org/zap"
+)
+
+// MigrateEncoding 把主链上以json存储的区块和交易改写为二进制编码，返回改写的区块数。
+// 未迁移的数据仍然可以读取，迁移只是减少存储空间和解析开销
+func (bc *Blockchain) MigrateEncoding() (int, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	height, err := bc.getHeight()
+	if err != nil {
+		//还没有提交创世块
+		return 0, nil
+	}
+
+	var count int
+	for h := uint64(1); h <= height; h++ {
+		hash, err := bc.db.Get(heightKey(h))
+		if err != nil {
+			return count, err
+		}
+		data, err := bc.db.Get(hash)
+		if err != nil {
+			return count, err
+		}
+		if !codec.IsJSON(data) {
+			continue
+		}
+		if err := bc.migrateBlock(hash, data); err != nil {
+			logger.Error("Failed to migrate block", zap.Error(err), zap.Uint64("height", h))
+			return count, err
+		}
+		count++
+	}
+
+	if count > 0 {
+		logger.Info("Migrate block encoding", zap.Int("blocks", count))
+	}
+	return count, nil
+}
+
+func (bc *Blockchain) migrateBlock(hash, data []byte) error {
+	b, err := block.Deserialize(data)
+	if err != nil {
+		return err
+	}
+
+	DBTransaction := bc.db.NewTransaction()
+	defer DBTransaction.Cancel()
+
+	for _, tx := range b.Transactions {
+		if err := migrateTransaction(DBTransaction, tx.Hash); err != nil {
+			return err
+		}
+	}
+	if err := DBTransaction.Set(hash, b.Serialize()); err != nil {
+		return err
+	}
+	if _, err := DBTransaction.Get(headerKey(hash)); err == storage.NotExist {
+		if err := DBTransaction.Set(headerKey(hash), b.Encode()); err != nil {
+			return err
+		}
+	}
+
+	return DBTransaction.Commit()
+}
+
+func migrateTransaction(DBTransaction storage.Transaction, hash []byte) error {
+	data, err := DBTransaction.Get(hash)
+	if err == storage.NotExist {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !codec.IsJSON(data) {
+		return nil
+	}
+
+	tx, err := transaction.Deserialize(data)
+	if err != nil {
+		return err
+	}
+	return DBTransaction.Set(hash, tx.Serialize())
+}
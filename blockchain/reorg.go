@@ -0,0 +1,388 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+
+	"kortho/block"
+	"kortho/logger"
+	"kortho/transaction"
+	"kortho/util/mixed"
+	"kortho/util/storage"
+
+	"go.uber.org/zap"
+)
+
+var (
+	UndoPrefix      = []byte("undo")
+	SideBlockPrefix = []byte("sideblocks")
+)
+
+const (
+	// 链重组在一个事务中完成，限制回滚和应用的块数，避免事务超过存储的大小限制
+	maxReorgDepth = 64
+	// 每个高度最多保存的侧链块数量，避免其他节点用大量分叉块占满存储
+	maxSideBlocks = 16
+)
+
+// ForkChoice 决定是否从当前链切换到候选块所在的分支
+type ForkChoice interface {
+	Prefer(current, candidate *block.Block) bool
+}
+
+// LongestChain 选择最高的链，高度相同时选择hash较小的块，保证所有节点选择一致
+type LongestChain struct{}
+
+func (LongestChain) Prefer(current, candidate *block.Block) bool {
+	if candidate.Height != current.Height {
+		return candidate.Height > current.Height
+	}
+	return bytes.Compare(candidate.Hash, current.Hash) < 0
+}
+
+// 区块修改之前账户的余额和nonce，值为nil表示修改前不存在
+type undoRecord struct {
+	Balances map[string][]byte `json:"balances"`
+	Nonces   map[string][]byte `json:"nonces"`
+}
+
+func undoKey(hash []byte) []byte {
+	key := make([]byte, 0, len(UndoPrefix)+len(hash))
+	key = append(key, UndoPrefix...)
+	return append(key, hash...)
+}
+
+func newUndoRecord(DBTransaction storage.Transaction, b *block.Block, minaddr []byte) (*undoRecord, error) {
+	undo := &undoRecord{
+		Balances: make(map[string][]byte),
+		Nonces:   make(map[string][]byte),
+	}
+
+	record := func(addr []byte) error {
+		if _, ok := undo.Balances[string(addr)]; ok {
+			return nil
+		}
+		balance, err := DBTransaction.Get(addr)
+		if err != nil && err != storage.NotExist {
+			return err
+		}
+		nonce, err := DBTransaction.Mget(NonceKey, addr)
+		if err != nil && err != storage.NotExist {
+			return err
+		}
+		undo.Balances[string(addr)] = balance
+		undo.Nonces[string(addr)] = nonce
+		return nil
+	}
+
+	for _, tx := range b.Transactions {
+		if !tx.IsCoinBaseTransaction() {
+			if err := record(tx.From.Bytes()); err != nil {
+				return nil, err
+			}
+		}
+		if err := record(tx.To.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if err := record(minaddr); err != nil {
+		return nil, err
+	}
+
+	return undo, nil
+}
+
+func (u *undoRecord) Serialize() []byte {
+	data, _ := json.Marshal(u)
+	return data
+}
+
+// 撤销事务中的最高块，恢复账户状态和交易索引
+func revertBlock(DBTransaction storage.Transaction, b *block.Block) error {
+	height, err := getHeight(DBTransaction)
+	if err != nil {
+		return err
+	}
+	hash, err := DBTransaction.Get(heightKey(height))
+	if err != nil {
+		return err
+	}
+	if height != b.Height || !bytes.Equal(hash, b.Hash) || b.Height <= 1 {
+		return errRevertBlock
+	}
+
+	data, err := DBTransaction.Get(undoKey(b.Hash))
+	if err != nil {
+		return err
+	}
+	var undo undoRecord
+	if err := json.Unmarshal(data, &undo); err != nil {
+		return err
+	}
+
+	for addr, balance := range undo.Balances {
+		if balance == nil {
+			err = DBTransaction.Del([]byte(addr))
+		} else {
+			err = DBTransaction.Set([]byte(addr), balance)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for addr, nonce := range undo.Nonces {
+		if nonce == nil {
+			err = DBTransaction.Mdel(NonceKey, []byte(addr))
+		} else {
+			err = DBTransaction.Mset(NonceKey, []byte(addr), nonce)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	//交易索引都是头部插入，按相反的顺序弹出
+	for i := len(b.Transactions) - 1; i >= 0; i-- {
+		tx := b.Transactions[i]
+		if _, err := DBTransaction.Llpop(TxListName); err != nil {
+			return err
+		}
+		if _, err := DBTransaction.Llpop(append(AddrListPrefix, tx.To.Bytes()...)); err != nil {
+			return err
+		}
+		if !tx.IsCoinBaseTransaction() {
+			if _, err := DBTransaction.Llpop(append(AddrListPrefix, tx.From.Bytes()...)); err != nil {
+				return err
+			}
+		}
+		if err := DBTransaction.Del(tx.Hash); err != nil {
+			return err
+		}
+	}
+
+	if err := DBTransaction.Del(undoKey(b.Hash)); err != nil {
+		return err
+	}
+	if err := DBTransaction.Del(heightKey(b.Height)); err != nil {
+		return err
+	}
+	//区块数据保留，作为侧链块
+	return DBTransaction.Set(HeightKey, mixed.E64func(b.Height-1))
+}
+
+// SetForkChoice 设置分叉选择规则，默认是最长链
+func (bc *Blockchain) SetForkChoice(fc ForkChoice) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.forkChoice = fc
+}
+
+// SetOrphanHandler 设置链重组后被丢弃交易的处理函数，一般是放回交易池
+func (bc *Blockchain) SetOrphanHandler(handler func([]*transaction.Transaction)) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.orphanHandler = handler
+}
+
+// SetBlockVerifier 设置插入块的共识校验，例如bft的commit签名，没有设置时只检查块本身
+func (bc *Blockchain) SetBlockVerifier(verify func(*block.Block) error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.blockVerifier = verify
+}
+
+// InsertBlock 插入来自其他节点的块，可以接在最高块之后，也可以是侧链上的块，
+// 侧链比当前链更优时进行链重组
+func (bc *Blockchain) InsertBlock(b *block.Block) error {
+	//校验可能读取链的状态，在加锁之前完成
+	bc.mu.RLock()
+	verify := bc.blockVerifier
+	bc.mu.RUnlock()
+	if verify != nil {
+		if err := verify(b); err != nil {
+			logger.Info("Failed to verify inserted block", zap.Error(err), zap.Uint64("height", b.Height))
+			return errBlockVerify
+		}
+	}
+
+	bc.mu.Lock()
+	orphans, err := bc.insertBlock(b)
+	handler := bc.orphanHandler
+	bc.mu.Unlock()
+
+	if len(orphans) > 0 && handler != nil {
+		handler(orphans)
+	}
+	return err
+}
+
+func (bc *Blockchain) insertBlock(b *block.Block) ([]*transaction.Transaction, error) {
+	if _, err := bc.db.Get(b.Hash); err == nil {
+		return nil, errKnownBlock
+	}
+
+	height, err := bc.getHeight()
+	if err != nil {
+		return nil, errNoGenesis
+	}
+	tipHash, err := bc.db.Get(heightKey(height))
+	if err != nil {
+		return nil, err
+	}
+
+	DBTransaction := bc.db.NewTransaction()
+	defer DBTransaction.Cancel()
+
+	if bytes.Equal(b.PrevHash, tipHash) {
+		if err := applyBlock(DBTransaction, b, b.Miner.Bytes()); err != nil {
+			return nil, err
+		}
+		return nil, DBTransaction.Commit()
+	}
+
+	parent, err := bc.getBlock(b.PrevHash)
+	if err != nil {
+		return nil, errUnknownParent
+	}
+	if parent.Height+1 != b.Height {
+		return nil, errHeight
+	}
+	if err := verifyBlock(b); err != nil {
+		return nil, err
+	}
+	//侧链块和块头在同一个事务中写入，不切换分支时单独提交
+	if err := DBTransaction.Set(b.Hash, b.Serialize()); err != nil {
+		return nil, err
+	}
+	if err := DBTransaction.Set(headerKey(b.Hash), b.Encode()); err != nil {
+		return nil, err
+	}
+
+	tip, err := bc.getBlock(tipHash)
+	if err != nil {
+		return nil, err
+	}
+	if !bc.getForkChoice().Prefer(tip, b) {
+		if err := addSideBlock(DBTransaction, b.Height); err != nil {
+			return nil, err
+		}
+		if err := DBTransaction.Commit(); err != nil {
+			return nil, err
+		}
+		logger.Info("Insert side block", zap.Uint64("height", b.Height), zap.String("hash", hex.EncodeToString(b.Hash)))
+		return nil, nil
+	}
+	return bc.reorg(DBTransaction, height, b)
+}
+
+// 回滚到公共祖先，再依次应用新分支上的块，全部在一个事务中完成，
+// 超过maxReorgDepth的重组被拒绝
+func (bc *Blockchain) reorg(DBTransaction storage.Transaction, height uint64, head *block.Block) ([]*transaction.Transaction, error) {
+	var branch []*block.Block
+	for cur := head; ; {
+		if hash, err := bc.db.Get(heightKey(cur.Height)); err == nil && bytes.Equal(hash, cur.Hash) {
+			break
+		}
+		branch = append(branch, cur)
+		if len(branch) > maxReorgDepth {
+			logger.Error("Chain reorganization is too deep", zap.Uint64("height", head.Height), zap.Int("depth", len(branch)))
+			return nil, errReorgDepth
+		}
+
+		var err error
+		if cur, err = bc.getBlock(cur.PrevHash); err != nil {
+			return nil, errUnknownParent
+		}
+	}
+	ancestor := branch[len(branch)-1].Height - 1
+	if height-ancestor > maxReorgDepth {
+		logger.Error("Chain reorganization is too deep", zap.Uint64("ancestor", ancestor), zap.Uint64("height", height))
+		return nil, errReorgDepth
+	}
+
+	var reverted []*block.Block
+	for h := height; h > ancestor; h-- {
+		hash, err := bc.db.Get(heightKey(h))
+		if err != nil {
+			return nil, err
+		}
+		b, err := bc.getBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := revertBlock(DBTransaction, b); err != nil {
+			logger.Error("Failed to revert block", zap.Error(err), zap.Uint64("height", h))
+			return nil, err
+		}
+		reverted = append(reverted, b)
+	}
+
+	included := make(map[string]bool)
+	for i := len(branch) - 1; i >= 0; i-- {
+		if err := applyBlock(DBTransaction, branch[i], branch[i].Miner.Bytes()); err != nil {
+			return nil, err
+		}
+		for _, tx := range branch[i].Transactions {
+			included[string(tx.Hash)] = true
+		}
+	}
+
+	if err := DBTransaction.Commit(); err != nil {
+		return nil, err
+	}
+
+	var orphans []*transaction.Transaction
+	for _, b := range reverted {
+		for _, tx := range b.Transactions {
+			if !tx.IsCoinBaseTransaction() && !included[string(tx.Hash)] {
+				orphans = append(orphans, tx)
+			}
+		}
+	}
+	logger.Info("Chain reorganization", zap.Uint64("ancestor", ancestor), zap.Int("reverted", len(reverted)),
+		zap.Int("applied", len(branch)), zap.Int("orphans", len(orphans)))
+
+	return orphans, nil
+}
+
+func (bc *Blockchain) getBlock(hash []byte) (*block.Block, error) {
+	data, err := bc.db.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	return block.Deserialize(data)
+}
+
+func sideBlockKey(height uint64) []byte {
+	key := make([]byte, 0, len(SideBlockPrefix)+8)
+	key = append(key, SideBlockPrefix...)
+	return append(key, mixed.E64func(height)...)
+}
+
+// 记录高度上的侧链块数量，超过maxSideBlocks时拒绝
+func addSideBlock(DBTransaction storage.Transaction, height uint64) error {
+	var count uint64
+	data, err := DBTransaction.Get(sideBlockKey(height))
+	if err == nil {
+		if count, err = mixed.D64func(data); err != nil {
+			return err
+		}
+	} else if err != storage.NotExist {
+		return err
+	}
+	if count >= maxSideBlocks {
+		return errSideBlocks
+	}
+	return DBTransaction.Set(sideBlockKey(height), mixed.E64func(count+1))
+}
+
+func (bc *Blockchain) getForkChoice() ForkChoice {
+	if bc.forkChoice == nil {
+		return LongestChain{}
+	}
+	return bc.forkChoice
+}
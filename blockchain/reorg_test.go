@@ -0,0 +1,135 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"kortho/block"
+	"kortho/config"
+	"kortho/transaction"
+	"kortho/types"
+)
+
+func mineBlock(t *testing.T, bc *Blockchain, miner types.Address, txs ...*transaction.Transaction) {
+	txs = append(txs, transaction.NewCoinBaseTransaction(miner, 5))
+	b, err := bc.NewBlock(txs, miner, miner, miner, miner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(b, miner.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//切换到更长的分支时回滚转账，被丢弃的交易交给orphan处理函数
+func TestReorgUndo(t *testing.T) {
+	bc, dir := newTestBlockchain(t)
+	defer os.RemoveAll(dir)
+	other, otherDir := newTestBlockchain(t)
+	defer os.RemoveAll(otherDir)
+
+	from, to := newTestAccount(t), newTestAccount(t)
+	genesis := newTestGenesis(config.AllocInfo{Address: from.addr.String(), Balance: 1000})
+	for _, c := range []*Blockchain{bc, other} {
+		if _, err := c.SetupGenesis(genesis); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	transfer := from.transfer(1, 300, to.addr)
+	mineBlock(t, bc, newTestAccount(t).addr, transfer)
+	if balance := to.balance(t, bc); balance != 300 {
+		t.Fatalf("receiver balance %d, want 300", balance)
+	}
+
+	var orphans []*transaction.Transaction
+	bc.SetOrphanHandler(func(txs []*transaction.Transaction) { orphans = append(orphans, txs...) })
+
+	miner := newTestAccount(t).addr
+	mineBlock(t, other, miner)
+	mineBlock(t, other, miner)
+	for height := uint64(2); height <= 3; height++ {
+		b, err := other.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.InsertBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	head, err := other.GetHash(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := bc.GetHash(3); err != nil || !bytes.Equal(hash, head) {
+		t.Fatalf("head %x, want %x: %v", hash, head, err)
+	}
+	if balance := from.balance(t, bc); balance != 1000 {
+		t.Fatalf("sender balance %d, want 1000", balance)
+	}
+	if balance := to.balance(t, bc); balance != 0 {
+		t.Fatalf("receiver balance %d, want 0", balance)
+	}
+	if nonce, err := bc.GetNonce(from.addr.Bytes()); err != nil || nonce != 1 {
+		t.Fatalf("nonce %d, %v", nonce, err)
+	}
+	if balance := (&testAccount{addr: miner}).balance(t, bc); balance != 10 {
+		t.Fatalf("miner balance %d, want 10", balance)
+	}
+	if len(orphans) != 1 || !bytes.Equal(orphans[0].Hash, transfer.Hash) {
+		t.Fatalf("orphans %v, want the reverted transfer", orphans)
+	}
+	if _, err := bc.GetTransactionByHash(transfer.Hash); err == nil {
+		t.Fatal("reverted transfer is still indexed")
+	}
+}
+
+//侧链块先通过共识校验，每个高度保存的侧链块有上限
+func TestSideBlocks(t *testing.T) {
+	bc, dir := newTestBlockchain(t)
+	defer os.RemoveAll(dir)
+	other, otherDir := newTestBlockchain(t)
+	defer os.RemoveAll(otherDir)
+
+	genesis := newTestGenesis()
+	for _, c := range []*Blockchain{bc, other} {
+		if _, err := c.SetupGenesis(genesis); err != nil {
+			t.Fatal(err)
+		}
+	}
+	miner := newTestAccount(t).addr
+	mineBlock(t, bc, miner)
+	mineBlock(t, bc, miner)
+
+	//other上高度2的块，出块者不同
+	side := func() *block.Block {
+		m := newTestAccount(t).addr
+		b, err := other.NewBlock([]*transaction.Transaction{transaction.NewCoinBaseTransaction(m, 5)}, m, m, m, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	bc.SetBlockVerifier(func(*block.Block) error { return errors.New("no commits") })
+	b := side()
+	if err := bc.InsertBlock(b); err != errBlockVerify {
+		t.Fatalf("insert unverified side block: %v, want %v", err, errBlockVerify)
+	}
+	if _, err := bc.GetHeaderByHash(b.Hash); err == nil {
+		t.Fatal("unverified side block is stored")
+	}
+
+	bc.SetBlockVerifier(func(*block.Block) error { return nil })
+	for i := 0; i < maxSideBlocks; i++ {
+		if err := bc.InsertBlock(side()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bc.InsertBlock(side()); err != errSideBlocks {
+		t.Fatalf("insert side block over the limit: %v, want %v", err, errSideBlocks)
+	}
+}
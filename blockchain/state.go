@@ -0,0 +1,210 @@
+package blockchain
+
+import (
+	"kortho/block"
+	"kortho/logger"
+	"kortho/transaction"
+	"kortho/util/mixed"
+	"kortho/util/smt"
+	"kortho/util/storage"
+
+	"go.uber.org/zap"
+)
+
+// 执行区块中的交易并更新状态树，返回回滚数据和新的状态根
+func executeBlock(DBTransaction storage.Transaction, block *block.Block, minaddr []byte) (*undoRecord, []byte, error) {
+	undo, err := newUndoRecord(DBTransaction, block, minaddr)
+	if err != nil {
+		logger.Error("Failed to new undo record", zap.Error(err), zap.Uint64("height", block.Height))
+		return nil, nil, err
+	}
+
+	var minerFee uint64
+	for _, tx := range block.Transactions {
+		if tx.IsCoinBaseTransaction() {
+			if err := setToAccount(DBTransaction, tx); err != nil {
+				logger.Error("Failed to set coinbase account", zap.Error(err), zap.String("to", tx.To.String()))
+				return nil, nil, err
+			}
+		} else {
+			if err := checkAccount(DBTransaction, tx); err != nil {
+				logger.Error("Failed to check account", zap.Error(err), zap.String("from", tx.From.String()),
+					zap.Uint64("nonce", tx.Nonce), zap.Uint64("amount", tx.Amount))
+				return nil, nil, err
+			}
+			if err := setAccount(DBTransaction, tx); err != nil {
+				logger.Error("Failed to set account", zap.Error(err), zap.String("from", tx.From.String()))
+				return nil, nil, err
+			}
+			if err := setNonce(DBTransaction, tx.From.Bytes(), mixed.E64func(tx.Nonce+1)); err != nil {
+				logger.Error("Failed to set nonce", zap.Error(err), zap.String("from", tx.From.String()))
+				return nil, nil, err
+			}
+			if err := setTxbyaddr(DBTransaction, tx.From.Bytes(), *tx); err != nil {
+				logger.Error("Failed to set from txlist", zap.Error(err), zap.String("from", tx.From.String()))
+				return nil, nil, err
+			}
+			minerFee += tx.EffectiveFee()
+		}
+
+		if err := setTxbyaddr(DBTransaction, tx.To.Bytes(), *tx); err != nil {
+			logger.Error("Failed to set to txlist", zap.Error(err), zap.String("to", tx.To.String()))
+			return nil, nil, err
+		}
+		if err := setTxList(DBTransaction, tx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if minerFee > 0 {
+		if err := setMinerFee(DBTransaction, minaddr, minerFee); err != nil {
+			logger.Error("Failed to set miner fee", zap.Error(err), zap.Uint64("fee", minerFee))
+			return nil, nil, err
+		}
+	}
+
+	root, err := updateState(DBTransaction, block, undo)
+	if err != nil {
+		logger.Error("Failed to update state", zap.Error(err), zap.Uint64("height", block.Height))
+		return nil, nil, err
+	}
+
+	return undo, root, nil
+}
+
+// 把区块修改过的账户写入父块的状态树
+func updateState(DBTransaction storage.Transaction, b *block.Block, undo *undoRecord) ([]byte, error) {
+	var parentRoot []byte
+	if b.Height > 1 {
+		headerData, err := DBTransaction.Get(headerKey(b.PrevHash))
+		if err != nil {
+			return nil, err
+		}
+		parent, err := block.DecodeHeader(headerData)
+		if err != nil {
+			return nil, err
+		}
+		parentRoot = parent.StateRoot
+	}
+
+	tree := smt.New(DBTransaction, parentRoot)
+	for addr := range undo.Balances {
+		value, err := accountValue(DBTransaction, []byte(addr))
+		if err != nil {
+			return nil, err
+		}
+		if err := tree.Update([]byte(addr), value); err != nil {
+			return nil, err
+		}
+	}
+
+	return tree.Root(), nil
+}
+
+// 状态树中账户的值：余额和nonce各8字节，账户不存在时为nil。
+// 执行交易写入的nonce至少是2，默认值1按没有nonce处理，旧版本查询时写入的默认值不影响状态根
+func accountValue(DBTransaction storage.Transaction, addr []byte) ([]byte, error) {
+	balance, err := DBTransaction.Get(addr)
+	if err != nil && err != storage.NotExist {
+		return nil, err
+	}
+	nonce, err := DBTransaction.Mget(NonceKey, addr)
+	if err != nil && err != storage.NotExist {
+		return nil, err
+	}
+	if n, err := mixed.D64func(nonce); err == nil && n <= 1 {
+		nonce = nil
+	}
+	if balance == nil && nonce == nil {
+		return nil, nil
+	}
+	return encodeAccount(balance, nonce), nil
+}
+
+func encodeAccount(balance, nonce []byte) []byte {
+	value := make([]byte, 16)
+	copy(value[8-len(balance):8], balance)
+	copy(value[16-len(nonce):], nonce)
+	return value
+}
+
+// 在丢弃的事务中执行区块，计算区块的状态根
+func (bc *Blockchain) stateRoot(b *block.Block, minaddr []byte) ([]byte, error) {
+	DBTransaction := bc.db.NewTransaction()
+	defer DBTransaction.Cancel()
+
+	_, root, err := executeBlock(DBTransaction, b, minaddr)
+	return root, err
+}
+
+// CheckBlock 检查区块能否接到当前最高块之后，包括执行交易后的状态根，不修改数据
+func (bc *Blockchain) CheckBlock(b *block.Block) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	DBTransaction := bc.db.NewTransaction()
+	defer DBTransaction.Cancel()
+
+	return applyBlock(DBTransaction, b, b.Miner.Bytes())
+}
+
+// GetStateRoot 当前最高块的状态根
+func (bc *Blockchain) GetStateRoot() ([]byte, error) {
+	height, err := bc.GetHeight()
+	if err != nil {
+		return nil, err
+	}
+	header, err := bc.GetHeaderByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	return header.StateRoot, nil
+}
+
+// GetAccountProof 返回账户在当前状态根下的值和默克尔证明，账户不存在时值为nil
+func (bc *Blockchain) GetAccountProof(addr []byte) ([]byte, *smt.Proof, []byte, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	height, err := bc.getHeight()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hash, err := bc.db.Get(heightKey(height))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	headerData, err := bc.db.Get(headerKey(hash))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	header, err := block.DecodeHeader(headerData)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	DBTransaction := bc.db.NewTransaction()
+	defer DBTransaction.Cancel()
+
+	tree := smt.New(DBTransaction, header.StateRoot)
+	value, err := tree.Get(addr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	proof, err := tree.Prove(addr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return value, proof, header.StateRoot, nil
+}
+
+// 创世块的状态根，与提交创世块时的执行结果一致
+func genesisStateRoot(txs []*transaction.Transaction) ([]byte, error) {
+	tree := smt.New(smt.MemStore{}, nil)
+	for _, tx := range txs {
+		if err := tree.Update(tx.To.Bytes(), encodeAccount(mixed.E64func(tx.Amount), nil)); err != nil {
+			return nil, err
+		}
+	}
+	return tree.Root(), nil
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+
 	"github.com/siddontang/go-log/log"
 	"github.com/spf13/viper"
 )
@@ -11,6 +13,9 @@ type cfgInfo struct {
 	P2PConfig       *P2PConfigInfo     `yaml:"p2pconfig"`
 	ConsensusConfig *BftConfig         `yaml:"consensusconfig"`
 	APIConfig       *APIConfigInfo     `yaml:"apiconfig"`
+	TxPoolConfig    *TxPoolConfigInfo  `yaml:"txpoolconfig"`
+	GenesisFile     string             `yaml:"genesisfile"`
+	GenesisConfig   *GenesisConfigInfo `yaml:"-"`
 }
 
 type LogConfigInfo struct {
@@ -37,12 +42,31 @@ type APIConfigInfo struct {
 	WEBConfig *WEBConfigInfo `yaml:"webconfig"`
 }
 
+// 交易池配置，为0时使用默认值
+type TxPoolConfigInfo struct {
+	MaxNonceGap  uint64 `yaml:"maxnoncegap"`  //queued中的交易与pending之间允许的最大nonce差距
+	AccountQueue int    `yaml:"accountqueue"` //每个发送者queued中的最大交易数
+	Lifetime     int64  `yaml:"lifetime"`     //交易在queued中停留的最长时间，单位秒
+	Journal      string `yaml:"journal"`      //交易日志文件，为空时不保存交易
+	Rejournal    int64  `yaml:"rejournal"`    //重写交易日志的间隔，单位秒
+}
+
 type P2PConfigInfo struct {
 	BindPort      int      `yaml:"bindport"`
 	BindAddr      string   `yaml:"bindaddr"`
 	AdvertiseAddr string   `yaml:"advertiseaddr"`
 	NodeName      string   `yaml:"nodename"`
 	Members       []string `yaml:"members"`
+	//节点身份私钥文件，不存在时生成，为空时节点没有身份
+	NodeKeyFile string `yaml:"nodekeyfile"`
+	//gossip加密密钥，hex编码的16、24或32字节，为空时不加密
+	SecretKey string `yaml:"secretkey"`
+	//允许连接的节点身份地址，和AllowValidators都为空时接受所有节点，不为空时需要设置SecretKey
+	AllowList []string `yaml:"allowlist"`
+	//允许bft验证者集合中的节点连接，节点身份使用共识配置中验证者的私钥，需要设置SecretKey
+	AllowValidators bool `yaml:"allowvalidators"`
+	//只从这些节点身份同步区块，raft共识没有区块签名，为空时raft节点不同步区块
+	SyncPeers []string `yaml:"syncpeers"`
 }
 
 type AddressConfigInfo struct {
@@ -50,6 +74,25 @@ type AddressConfigInfo struct {
 	DSAddress    string `yaml:"dsaddress"`
 	CMAddress    string `yaml:"cmaddress"`
 	MinerAddress string `yamil:"mineraddress"`
+	//迁移期间接受没有校验和的旧格式地址，默认开启
+	LegacyAddress bool `yaml:"legacyaddress"`
+}
+
+type GenesisConfigInfo struct {
+	ChainID    uint64      `yaml:"chainid"`
+	Timestamp  int64       `yaml:"timestamp"`
+	QTJAddress string      `yaml:"qtjaddress"`
+	DSAddress  string      `yaml:"dsaddress"`
+	CMAddress  string      `yaml:"cmaddress"`
+	Alloc      []AllocInfo `yaml:"alloc"`
+	//旧格式交易(没有链ID)只能打包在不超过该高度的块中，为0时不接受；参与创世块hash
+	LegacyTxHeight uint64 `yaml:"legacytxheight"`
+}
+
+//地址区分大小写，所以不能用map，viper会把key转成小写
+type AllocInfo struct {
+	Address string `yaml:"address"`
+	Balance uint64 `yaml:"balance"`
 }
 
 type ConsensusConfigInfo struct {
@@ -86,6 +129,9 @@ type BftConfig struct {
 	Ds               string   `json:"ds"`
 	Cm               string   `json:"cm"`
 	QTJ              string   `json:"qtg"`
+	BlockInterval    uint64   `json:"blockinterval"`
+	BlockReward      uint64   `json:"blockreward"` //出块奖励，通过区块最后一笔coinbase交易发放
+	PrivKey          string   `json:"privkey"`     //bft模式下验证者的私钥
 
 	LogDir    string `json:"logdir"`
 	SnapDir   string `json:"snapdir"`
@@ -102,6 +148,7 @@ type BftConfig struct {
 func LoadConfig() (*cfgInfo, error) {
 	viper.SetConfigName("kortho")
 	viper.AddConfigPath("./configs/")
+	viper.SetDefault("addressconfig.legacyaddress", true)
 	if err := viper.ReadInConfig(); err != nil {
 		log.Panic(err)
 	}
@@ -110,5 +157,29 @@ func LoadConfig() (*cfgInfo, error) {
 	if err := viper.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
+
+	if len(cfg.GenesisFile) == 0 {
+		return nil, errors.New("genesis file is not configured")
+	}
+	genesis, err := LoadGenesis(cfg.GenesisFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.GenesisConfig = genesis
 	return &cfg, nil
 }
+
+//加载创世配置，支持json和yaml格式
+func LoadGenesis(file string) (*GenesisConfigInfo, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var genesis GenesisConfigInfo
+	if err := v.Unmarshal(&genesis); err != nil {
+		return nil, err
+	}
+	return &genesis, nil
+}
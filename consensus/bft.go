@@ -0,0 +1,561 @@
+package consensus
+
+import (
+	"bytes"
+	"time"
+
+	"kortho/block"
+	"kortho/blockchain"
+	"kortho/config"
+	"kortho/logger"
+	"kortho/p2p/node"
+	"kortho/transaction"
+	"kortho/txpool"
+	"kortho/types"
+	"kortho/util"
+
+	"go.uber.org/zap"
+)
+
+const (
+	stepPropose uint8 = iota
+	stepPrevote
+	stepPrecommit
+	stepCommit
+)
+
+const (
+	timeoutPropose   = 3 * time.Second
+	timeoutPrevote   = time.Second
+	timeoutPrecommit = time.Second
+	timeoutDelta     = 500 * time.Millisecond
+
+	minBftNodeNum = 4
+	msgChanSize   = 1024
+	maxFutureMsgs = 1024
+)
+
+// Broadcaster 共识消息通过p2p层广播
+type Broadcaster interface {
+	Broadcast(typ uint8, payload []byte)
+}
+
+type timeoutInfo struct {
+	height uint64
+	round  uint64
+	step   uint8
+}
+
+type voteKey struct {
+	round uint64
+	typ   uint8
+}
+
+// BftNode 拜占庭容错共识，每个高度按propose/prevote/precommit三个阶段推进，
+// 收到2f+1个precommit后提交区块
+type BftNode struct {
+	bc *blockchain.Blockchain
+	tp *txpool.TxPool
+	n  Broadcaster
+
+	priv       []byte
+	self       types.Address
+	validators []types.Address
+	index      map[types.Address]int
+
+	miner types.Address
+	ds    types.Address
+	cm    types.Address
+	qtj   types.Address
+
+	interval  time.Duration
+	reward    uint64
+	msgCh     chan *BftMessage
+	timeoutCh chan timeoutInfo
+	chainCh   chan struct{}
+	stop      chan struct{}
+
+	height      uint64
+	round       uint64
+	step        uint8
+	proposals   map[uint64]*block.Block
+	votes       map[voteKey]*voteSet
+	roundVoters map[uint64]map[types.Address]bool
+	lockedRound int64
+	lockedBlock *block.Block
+	waiting     map[voteKey]bool
+	future      []*BftMessage
+	committed   bool //本节点已经提交当前高度的块，等待出块间隔
+}
+
+func NewBftNode(cfg *config.BftConfig, minerAddr string, bc *blockchain.Blockchain, tp *txpool.TxPool, n Broadcaster) (*BftNode, error) {
+	if uint64(len(cfg.Peers)) != cfg.NodeNum {
+		return nil, errValidatorNum
+	}
+
+	priv := util.Decode(cfg.PrivKey)
+	if len(priv) != 64 {
+		return nil, errPrivKey
+	}
+	self, err := types.StringToAddress(types.PublicKeyToAddress(priv[32:]))
+	if err != nil {
+		return nil, err
+	}
+
+	e := &BftNode{
+		bc:        bc,
+		tp:        tp,
+		n:         n,
+		priv:      priv,
+		self:      *self,
+		index:     make(map[types.Address]int),
+		interval:  defaultBlockInterval,
+		reward:    cfg.BlockReward,
+		msgCh:     make(chan *BftMessage, msgChanSize),
+		timeoutCh: make(chan timeoutInfo, msgChanSize),
+		chainCh:   make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+	}
+	if cfg.BlockInterval > 0 {
+		e.interval = time.Duration(cfg.BlockInterval) * time.Millisecond
+	}
+
+	for i, peer := range cfg.Peers {
+		addr, err := types.StringToAddress(peer)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := e.index[*addr]; ok {
+			return nil, errValidatorNum
+		}
+		e.index[*addr] = i
+		e.validators = append(e.validators, *addr)
+	}
+	if _, ok := e.index[e.self]; !ok {
+		return nil, errNotValidator
+	}
+
+	for addr, s := range map[*types.Address]string{&e.miner: minerAddr, &e.ds: cfg.Ds, &e.cm: cfg.Cm, &e.qtj: cfg.QTJ} {
+		a, err := types.StringToAddress(s)
+		if err != nil {
+			return nil, err
+		}
+		*addr = *a
+	}
+
+	return e, nil
+}
+
+// Validators 返回验证者集合，用于校验区块中的commit签名
+func (e *BftNode) Validators() []types.Address {
+	return e.validators
+}
+
+// VerifyBlock 检查从其他节点同步的区块是否已经由2f+1个验证者确认
+func (e *BftNode) VerifyBlock(b *block.Block) error {
+	if !VerifyCommits(b, e.validators, e.bc.ChainID()) {
+		return errCommits
+	}
+	return nil
+}
+
+// HandleMessage 由p2p层调用，把收到的共识消息交给共识协程处理
+func (e *BftNode) HandleMessage(data []byte) {
+	m, err := DeserializeMessage(data)
+	if err != nil {
+		logger.Info("Failed to deserialize bft message", zap.Error(err))
+		return
+	}
+	select {
+	case e.msgCh <- m:
+	case <-e.stop:
+	}
+}
+
+// NotifyNewBlock 链的高度在共识之外增加时调用，例如同步插入了区块
+func (e *BftNode) NotifyNewBlock() {
+	select {
+	case e.chainCh <- struct{}{}:
+	default:
+	}
+}
+
+func (e *BftNode) Run() {
+	e.newHeight()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case m := <-e.msgCh:
+			e.handle(m)
+		case ti := <-e.timeoutCh:
+			e.onTimeout(ti)
+		case <-e.chainCh:
+			e.syncHeight()
+		}
+	}
+}
+
+func (e *BftNode) Stop() error {
+	close(e.stop)
+	return nil
+}
+
+func (e *BftNode) proposer(height, round uint64) types.Address {
+	return e.validators[(height+round)%uint64(len(e.validators))]
+}
+
+func (e *BftNode) quorum() int {
+	return quorum(len(e.validators))
+}
+
+func (e *BftNode) schedule(d time.Duration, height, round uint64, step uint8) {
+	time.AfterFunc(d, func() {
+		select {
+		case e.timeoutCh <- timeoutInfo{height, round, step}:
+		case <-e.stop:
+		}
+	})
+}
+
+// 进入新的高度，重放之前缓存的该高度的消息
+func (e *BftNode) newHeight() {
+	height, err := e.bc.GetHeight()
+	if err != nil {
+		logger.Error("Failed to get height", zap.Error(err))
+		return
+	}
+
+	e.height = height + 1
+	e.proposals = make(map[uint64]*block.Block)
+	e.votes = make(map[voteKey]*voteSet)
+	e.roundVoters = make(map[uint64]map[types.Address]bool)
+	e.lockedRound = -1
+	e.lockedBlock = nil
+	e.committed = false
+	e.startRound(0)
+
+	future := e.future
+	e.future = nil
+	for _, m := range future {
+		e.handle(m)
+	}
+}
+
+// 错过提交或者同步插入区块后链已经超过当前高度，直接进入新的高度；
+// 本节点刚提交的块等到出块间隔之后再进入下一个高度
+func (e *BftNode) syncHeight() {
+	if e.committed {
+		return
+	}
+	height, err := e.bc.GetHeight()
+	if err != nil {
+		logger.Error("Failed to get height", zap.Error(err))
+		return
+	}
+	if height >= e.height {
+		logger.Info("Chain advanced outside consensus", zap.Uint64("height", height), zap.Uint64("consensus height", e.height))
+		e.newHeight()
+	}
+}
+
+func (e *BftNode) startRound(round uint64) {
+	e.round = round
+	e.step = stepPropose
+	e.waiting = make(map[voteKey]bool)
+	e.schedule(timeoutPropose+time.Duration(round)*timeoutDelta, e.height, round, stepPropose)
+
+	if e.proposer(e.height, round) == e.self {
+		e.propose()
+	} else if b, ok := e.proposals[round]; ok {
+		e.prevote(b)
+	}
+	e.checkPrevotes()
+}
+
+func (e *BftNode) propose() {
+	b := e.lockedBlock
+	if b == nil {
+		var err error
+		if b, err = e.newBlock(); err != nil {
+			logger.Error("Failed to new block", zap.Error(err), zap.Uint64("height", e.height))
+			return
+		}
+	}
+
+	m := &BftMessage{Type: msgProposal, Height: e.height, Round: e.round, BlockHash: b.Hash, Block: b, Validator: e.self}
+	e.broadcast(m)
+}
+
+// 最后一笔交易是出块者的coinbase交易，金额是配置的出块奖励
+func (e *BftNode) newBlock() (*block.Block, error) {
+	txs := e.tp.Pending(e.bc)
+	txs = append(txs, transaction.NewCoinBaseTransaction(e.miner, e.reward))
+	return e.bc.NewBlock(txs, e.miner, e.ds, e.cm, e.qtj)
+}
+
+func (e *BftNode) broadcast(m *BftMessage) {
+	m.sign(e.priv, e.bc.ChainID())
+	e.n.Broadcast(node.MsgConsensus, m.Serialize())
+	e.handle(m)
+}
+
+func (e *BftNode) vote(typ uint8, hash []byte) {
+	e.broadcast(&BftMessage{Type: typ, Height: e.height, Round: e.round, BlockHash: hash, Validator: e.self})
+}
+
+func (e *BftNode) handle(m *BftMessage) {
+	if m.Height < e.height {
+		return
+	}
+	if m.Height > e.height {
+		//落后的节点需要等同步追上，这里只缓存下一个高度的消息
+		if m.Height == e.height+1 && len(e.future) < maxFutureMsgs {
+			e.future = append(e.future, m)
+		}
+		return
+	}
+
+	if _, ok := e.index[m.Validator]; !ok {
+		logger.Info("Message from unknown validator", zap.String("validator", m.Validator.String()))
+		return
+	}
+	if !m.verify(e.bc.ChainID()) {
+		logger.Info("Failed to verify bft message", zap.String("validator", m.Validator.String()))
+		return
+	}
+
+	switch m.Type {
+	case msgProposal:
+		e.onProposal(m)
+	case msgPrevote, msgPrecommit:
+		e.onVote(m)
+	}
+}
+
+func (e *BftNode) onProposal(m *BftMessage) {
+	b := m.Block
+	if b == nil || m.Validator != e.proposer(m.Height, m.Round) || !bytes.Equal(b.Hash, m.BlockHash) {
+		logger.Info("Invalid proposal", zap.Uint64("height", m.Height), zap.Uint64("round", m.Round))
+		return
+	}
+	if _, ok := e.proposals[m.Round]; ok {
+		return
+	}
+	e.proposals[m.Round] = b
+
+	if m.Round == e.round && e.step == stepPropose {
+		e.prevote(b)
+	}
+	//提案可能晚于投票到达
+	e.checkPrevotes()
+	e.checkPrecommits(m.Round)
+}
+
+func (e *BftNode) prevote(b *block.Block) {
+	e.step = stepPrevote
+	if e.lockedBlock != nil {
+		for r := uint64(e.lockedRound + 1); r <= e.round; r++ {
+			e.checkUnlock(r)
+		}
+	}
+	if e.lockedBlock != nil && !bytes.Equal(e.lockedBlock.Hash, b.Hash) {
+		e.vote(msgPrevote, nil)
+		return
+	}
+	if !e.validate(b) {
+		e.vote(msgPrevote, nil)
+		return
+	}
+	e.vote(msgPrevote, b.Hash)
+}
+
+func (e *BftNode) validate(b *block.Block) bool {
+	if b.Height != e.height {
+		return false
+	}
+	prevHash, err := e.bc.GetHash(b.Height - 1)
+	if err != nil || !bytes.Equal(prevHash, b.PrevHash) {
+		logger.Info("Proposal does not follow the current block", zap.Uint64("height", b.Height))
+		return false
+	}
+	if !checkCoinbase(b, e.reward) {
+		logger.Info("Invalid coin base transaction", zap.Uint64("height", b.Height))
+		return false
+	}
+	if err := e.bc.CheckBlock(b); err != nil {
+		logger.Info("Failed to check proposal", zap.Error(err), zap.Uint64("height", b.Height))
+		return false
+	}
+	if !txpool.VerifyBlcok(*b, e.bc) {
+		logger.Info("Failed to verify proposal", zap.Uint64("height", b.Height))
+		return false
+	}
+	return true
+}
+
+// 只有最后一笔交易是coinbase交易，发给出块者，金额等于出块奖励
+func checkCoinbase(b *block.Block, reward uint64) bool {
+	n := len(b.Transactions)
+	if n == 0 {
+		return false
+	}
+	for _, tx := range b.Transactions[:n-1] {
+		if tx.IsCoinBaseTransaction() {
+			return false
+		}
+	}
+	coinbase := b.Transactions[n-1]
+	return coinbase.IsCoinBaseTransaction() && coinbase.To == b.Miner && coinbase.Amount == reward
+}
+
+func (e *BftNode) onVote(m *BftMessage) {
+	key := voteKey{m.Round, m.Type}
+	vs, ok := e.votes[key]
+	if !ok {
+		vs = newVoteSet()
+		e.votes[key] = vs
+	}
+	if !vs.add(m) {
+		return
+	}
+
+	//f+1个验证者已经进入更高的轮次，说明至少有一个诚实节点在那一轮
+	if m.Round > e.round {
+		voters, ok := e.roundVoters[m.Round]
+		if !ok {
+			voters = make(map[types.Address]bool)
+			e.roundVoters[m.Round] = voters
+		}
+		voters[m.Validator] = true
+		if len(voters) > len(e.validators)-e.quorum() {
+			e.startRound(m.Round)
+		}
+	}
+
+	switch m.Type {
+	case msgPrevote:
+		e.checkUnlock(m.Round)
+		e.checkPrevotes()
+	case msgPrecommit:
+		e.checkPrecommits(m.Round)
+	}
+}
+
+func (e *BftNode) checkPrevotes() {
+	if e.step > stepPrevote {
+		return
+	}
+	key := voteKey{e.round, msgPrevote}
+	vs, ok := e.votes[key]
+	if !ok {
+		return
+	}
+
+	hash, ok := vs.majority(e.quorum())
+	switch {
+	case ok && hash == nil:
+		e.step = stepPrecommit
+		e.vote(msgPrecommit, nil)
+	case ok:
+		b, ok := e.proposals[e.round]
+		if !ok || !bytes.Equal(b.Hash, hash) {
+			return
+		}
+		e.lockedRound = int64(e.round)
+		e.lockedBlock = b
+		e.step = stepPrecommit
+		e.vote(msgPrecommit, hash)
+	case vs.size() >= e.quorum() && !e.waiting[key]:
+		e.waiting[key] = true
+		e.schedule(timeoutPrevote+time.Duration(e.round)*timeoutDelta, e.height, e.round, stepPrevote)
+	}
+}
+
+// 在锁定轮次之后、当前轮次之前(含)的某一轮看到2f+1个prevote给了其他块或nil(POL)，
+// 说明锁定的块不会再被提交，解除锁定
+func (e *BftNode) checkUnlock(round uint64) {
+	if e.lockedBlock == nil || int64(round) <= e.lockedRound || round > e.round {
+		return
+	}
+	vs, ok := e.votes[voteKey{round, msgPrevote}]
+	if !ok {
+		return
+	}
+	hash, ok := vs.majority(e.quorum())
+	if !ok || bytes.Equal(hash, e.lockedBlock.Hash) {
+		return
+	}
+	logger.Info("Unlock block", zap.Uint64("height", e.height), zap.Int64("locked round", e.lockedRound), zap.Uint64("round", round))
+	e.lockedRound = -1
+	e.lockedBlock = nil
+}
+
+func (e *BftNode) checkPrecommits(round uint64) {
+	if e.step == stepCommit {
+		return
+	}
+	key := voteKey{round, msgPrecommit}
+	vs, ok := e.votes[key]
+	if !ok {
+		return
+	}
+
+	hash, ok := vs.majority(e.quorum())
+	switch {
+	case ok && hash != nil:
+		if b, ok := e.proposals[round]; ok && bytes.Equal(b.Hash, hash) {
+			e.commit(b, vs.commits(hash))
+		}
+	case ok && round == e.round:
+		e.startRound(round + 1)
+	case round == e.round && vs.size() >= e.quorum() && !e.waiting[key]:
+		e.waiting[key] = true
+		e.schedule(timeoutPrecommit+time.Duration(round)*timeoutDelta, e.height, round, stepPrecommit)
+	}
+}
+
+// 提交失败时不再为这个高度投票，也不进入下一个高度，等同步插入这个块之后由syncHeight继续
+func (e *BftNode) commit(b *block.Block, commits []*block.CommitSig) {
+	e.step = stepCommit
+	b.Commits = commits
+	if err := e.bc.AddBlock(b, b.Miner.Bytes()); err != nil {
+		logger.Error("Failed to add block", zap.Error(err), zap.Uint64("height", b.Height))
+		return
+	}
+	evictions := e.tp.Filter(*b, e.bc)
+	logger.Info("Commit block", zap.Uint64("height", b.Height), zap.Uint64("round", e.round),
+		zap.Int("txs", len(b.Transactions)), zap.Int("commits", len(commits)), zap.Int("evicted", txpool.Evicted(evictions)))
+
+	e.committed = true
+	e.schedule(e.interval, e.height, e.round, stepCommit)
+}
+
+func (e *BftNode) onTimeout(ti timeoutInfo) {
+	//每一轮都有超时，错过的提交最多在一次超时之后发现
+	if ti.step != stepCommit {
+		e.syncHeight()
+	}
+	if ti.height != e.height {
+		return
+	}
+
+	switch ti.step {
+	case stepPropose:
+		if ti.round == e.round && e.step == stepPropose {
+			e.step = stepPrevote
+			e.vote(msgPrevote, nil)
+		}
+	case stepPrevote:
+		if ti.round == e.round && e.step == stepPrevote {
+			e.step = stepPrecommit
+			e.vote(msgPrecommit, nil)
+		}
+	case stepPrecommit:
+		if ti.round == e.round && e.step != stepCommit {
+			e.startRound(e.round + 1)
+		}
+	case stepCommit:
+		e.newHeight()
+	}
+}
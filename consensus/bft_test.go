@@ -0,0 +1,182 @@
+package consensus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kortho/block"
+	"kortho/blockchain"
+	"kortho/config"
+	"kortho/logger"
+	"kortho/transaction"
+	"kortho/types"
+)
+
+func testValidators(t *testing.T, n int) []types.Address {
+	var validators []types.Address
+	for i := 0; i < n; i++ {
+		addr, err := types.StringToAddress(types.NewWallet().Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validators = append(validators, *addr)
+	}
+	return validators
+}
+
+func TestUnlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger.InitLogger(&config.LogConfigInfo{Level: "INFO", FileName: filepath.Join(dir, "bft.log")})
+
+	validators := testValidators(t, 4)
+	locked := &block.Block{BlockHeader: block.BlockHeader{Height: 2}}
+	locked.SetHash()
+	e := &BftNode{validators: validators, height: 2, round: 2, lockedRound: 0, lockedBlock: locked, votes: make(map[voteKey]*voteSet)}
+	prevote := func(round uint64, hash []byte, voters int) {
+		vs := newVoteSet()
+		for _, v := range validators[:voters] {
+			vs.add(&BftMessage{Type: msgPrevote, Height: 2, Round: round, BlockHash: hash, Validator: v})
+		}
+		e.votes[voteKey{round, msgPrevote}] = vs
+	}
+
+	//锁定块本身的POL和不足2f+1的nil票都不解锁
+	prevote(1, locked.Hash, 3)
+	e.checkUnlock(1)
+	prevote(2, nil, 2)
+	e.checkUnlock(2)
+	if e.lockedBlock == nil {
+		t.Fatal("unlocked without a POL")
+	}
+
+	//还没有进入的轮次不解锁
+	prevote(3, nil, 3)
+	e.checkUnlock(3)
+	if e.lockedBlock == nil {
+		t.Fatal("unlocked by a future round")
+	}
+
+	prevote(2, nil, 3)
+	e.checkUnlock(2)
+	if e.lockedBlock != nil || e.lockedRound != -1 {
+		t.Fatal("still locked after a nil POL")
+	}
+}
+
+func TestCheckCoinbase(t *testing.T) {
+	miner := testValidators(t, 1)[0]
+	tx := &transaction.Transaction{From: testValidators(t, 1)[0], To: miner, Amount: 1}
+	newBlock := func(txs ...*transaction.Transaction) *block.Block {
+		return &block.Block{BlockHeader: block.BlockHeader{Miner: miner}, Transactions: txs}
+	}
+
+	for _, c := range []struct {
+		b    *block.Block
+		want bool
+	}{
+		{newBlock(tx, transaction.NewCoinBaseTransaction(miner, 10)), true},
+		{newBlock(), false},
+		{newBlock(transaction.NewCoinBaseTransaction(miner, 10), tx), false},
+		{newBlock(transaction.NewCoinBaseTransaction(miner, 11)), false},
+		{newBlock(transaction.NewCoinBaseTransaction(tx.From, 10)), false},
+		{newBlock(transaction.NewCoinBaseTransaction(miner, 10), transaction.NewCoinBaseTransaction(miner, 10)), false},
+	} {
+		if got := checkCoinbase(c.b, 10); got != c.want {
+			t.Fatalf("checkCoinbase = %v, want %v", got, c.want)
+		}
+	}
+}
+
+//共识之外插入的块让引擎进入新的高度；本节点提交失败时停在当前高度
+func TestSyncHeight(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger.InitLogger(&config.LogConfigInfo{Level: "INFO", FileName: filepath.Join(dir, "bft.log")})
+
+	qtj := types.NewWallet().Address
+	bc := blockchain.NewWithDir(dir)
+	if _, err := bc.SetupGenesis(&config.GenesisConfigInfo{ChainID: 1, Timestamp: 1600000000, QTJAddress: qtj, DSAddress: qtj, CMAddress: qtj}); err != nil {
+		t.Fatal(err)
+	}
+	miner := testValidators(t, 1)[0]
+	addBlock := func() *block.Block {
+		b, err := bc.NewBlock([]*transaction.Transaction{transaction.NewCoinBaseTransaction(miner, 0)}, miner, miner, miner, miner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.AddBlock(b, miner.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	//本节点不是验证者，不会提案
+	e := &BftNode{bc: bc, validators: testValidators(t, 4), timeoutCh: make(chan timeoutInfo, msgChanSize), stop: make(chan struct{})}
+	defer close(e.stop)
+	e.newHeight()
+	if e.height != 2 {
+		t.Fatalf("height %d, want 2", e.height)
+	}
+
+	addBlock()
+	e.onTimeout(timeoutInfo{height: 2, round: 0, step: stepPropose})
+	if e.height != 3 {
+		t.Fatalf("height %d after a synced block, want 3", e.height)
+	}
+
+	//已经提交的块不能再次加入，提交失败后不进入下一个高度
+	b := addBlock()
+	e.height = 3
+	e.commit(b, nil)
+	if e.committed || e.step != stepCommit {
+		t.Fatal("continued after a failed commit")
+	}
+	e.NotifyNewBlock()
+	e.syncHeight()
+	if e.height != 4 || e.committed {
+		t.Fatalf("height %d after the block is synced, want 4", e.height)
+	}
+
+	e.committed = true
+	addBlock()
+	e.syncHeight()
+	if e.height != 4 {
+		t.Fatal("skipped the block interval after an own commit")
+	}
+}
+
+//投票签名绑定链ID
+func TestVoteChainID(t *testing.T) {
+	_, priv, err := types.GenKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := types.StringToAddress(types.PublicKeyToAddress(priv[32:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &BftMessage{Type: msgPrecommit, Height: 2, Round: 0, BlockHash: []byte{1}, Validator: *v}
+	m.sign(priv, 1)
+	if !m.verify(1) {
+		t.Fatal("vote does not verify on its chain")
+	}
+	if m.verify(2) {
+		t.Fatal("vote verifies on another chain")
+	}
+
+	b := &block.Block{BlockHeader: block.BlockHeader{Height: 2}}
+	b.Hash = m.BlockHash
+	b.Commits = []*block.CommitSig{{Round: 0, Validator: *v, Signature: m.Signature}}
+	if !VerifyCommits(b, []types.Address{*v}, 1) || VerifyCommits(b, []types.Address{*v}, 2) {
+		t.Fatal("commit signatures are not bound to the chain id")
+	}
+}
@@ -0,0 +1,32 @@
+package consensus
+
+import (
+	"kortho/blockchain"
+	"kortho/config"
+	"kortho/txpool"
+)
+
+type Engine interface {
+	Run()
+	Stop() error
+}
+
+// Network 共识消息的收发
+type Network interface {
+	Broadcaster
+	SetConsensusHandler(func([]byte))
+}
+
+// New 验证者数量足够容忍拜占庭节点(NodeNum >= 4)时使用bft，否则使用raft
+func New(cfg *config.BftConfig, minerAddr string, bc *blockchain.Blockchain, tp *txpool.TxPool, n Network) (Engine, error) {
+	if cfg.NodeNum < minBftNodeNum {
+		return NewRaftNode(cfg, minerAddr, bc, tp)
+	}
+
+	e, err := NewBftNode(cfg, minerAddr, bc, tp, n)
+	if err != nil {
+		return nil, err
+	}
+	n.SetConsensusHandler(e.HandleMessage)
+	return e, nil
+}
@@ -0,0 +1,11 @@
+package consensus
+
+import "errors"
+
+var (
+	errNotLeader    = errors.New("node is not the raft leader")
+	errValidatorNum = errors.New("peers do not match the number of validators")
+	errNotValidator = errors.New("this node is not in the validator set")
+	errPrivKey      = errors.New("validator private key is error")
+	errCommits      = errors.New("block does not carry a quorum of precommit signatures")
+)
@@ -0,0 +1,67 @@
+package consensus
+
+import (
+	"bytes"
+	"io"
+
+	"kortho/block"
+	"kortho/blockchain"
+	"kortho/logger"
+	"kortho/txpool"
+
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+)
+
+// fsm 把raft日志中已提交的块写入区块链
+type fsm struct {
+	bc *blockchain.Blockchain
+	tp *txpool.TxPool
+}
+
+type fsmSnapshot struct {
+	bc *blockchain.Blockchain
+}
+
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	b, err := block.Deserialize(l.Data)
+	if err != nil {
+		logger.Error("Failed to deserialize block", zap.Error(err), zap.Uint64("index", l.Index))
+		return err
+	}
+
+	//快照可能已经包含了这个块，恢复后重放日志时跳过
+	if hash, err := f.bc.GetHash(b.Height); err == nil && bytes.Equal(hash, b.Hash) {
+		return nil
+	}
+
+	if err := f.bc.AddBlock(b, b.Miner.Bytes()); err != nil {
+		logger.Error("Failed to add block", zap.Error(err), zap.Uint64("height", b.Height))
+		return err
+	}
+
+	evictions := f.tp.Filter(*b, f.bc)
+
+	logger.Info("Commit block", zap.Uint64("height", b.Height), zap.Int("txs", len(b.Transactions)),
+		zap.Int("evicted", txpool.Evicted(evictions)))
+	return nil
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return &fsmSnapshot{f.bc}, nil
+}
+
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	return f.bc.Restore(rc)
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := s.bc.Snapshot(sink); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
@@ -0,0 +1,217 @@
+package consensus
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"kortho/blockchain"
+	"kortho/config"
+	"kortho/logger"
+	"kortho/transaction"
+	"kortho/txpool"
+	"kortho/types"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBlockInterval = time.Second
+	applyTimeout         = 10 * time.Second
+	transportTimeout     = 10 * time.Second
+	maxPool              = 3
+	retainSnapshotCount  = 2
+)
+
+type RaftNode struct {
+	raft   *raft.Raft
+	trans  *raft.NetworkTransport
+	logs   *raftboltdb.BoltStore
+	stable *raftboltdb.BoltStore
+
+	bc    *blockchain.Blockchain
+	tp    *txpool.TxPool
+	miner types.Address
+	ds    types.Address
+	cm    types.Address
+	qtj   types.Address
+
+	interval time.Duration
+	reward   uint64
+	stop     chan struct{}
+}
+
+func NewRaftNode(cfg *config.BftConfig, minerAddr string, bc *blockchain.Blockchain, tp *txpool.TxPool) (*RaftNode, error) {
+	miner, err := types.StringToAddress(minerAddr)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := types.StringToAddress(cfg.Ds)
+	if err != nil {
+		return nil, err
+	}
+	cm, err := types.StringToAddress(cfg.Cm)
+	if err != nil {
+		return nil, err
+	}
+	qtj, err := types.StringToAddress(cfg.QTJ)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &RaftNode{
+		bc:       bc,
+		tp:       tp,
+		miner:    *miner,
+		ds:       *ds,
+		cm:       *cm,
+		qtj:      *qtj,
+		interval: defaultBlockInterval,
+		reward:   cfg.BlockReward,
+		stop:     make(chan struct{}),
+	}
+	if cfg.BlockInterval > 0 {
+		n.interval = time.Duration(cfg.BlockInterval) * time.Millisecond
+	}
+
+	if err := n.newRaft(cfg, &fsm{bc, tp}); err != nil {
+		n.close()
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *RaftNode) newRaft(cfg *config.BftConfig, f raft.FSM) error {
+	for _, dir := range []string{cfg.LogDir, cfg.SnapDir, cfg.StableDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	rc := raft.DefaultConfig()
+	rc.LocalID = raft.ServerID(cfg.NodeAddr)
+	rc.Logger = hclog.New(&hclog.LoggerOptions{Name: "raft", Level: hclog.Info})
+	if cfg.SnapshotCount > 0 {
+		rc.SnapshotThreshold = cfg.SnapshotCount
+	}
+	if cfg.SnapshotInterval > 0 {
+		rc.SnapshotInterval = time.Duration(cfg.SnapshotInterval) * time.Second
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", cfg.NodeAddr)
+	if err != nil {
+		return err
+	}
+	if n.trans, err = raft.NewTCPTransportWithLogger(cfg.NodeAddr, addr, maxPool, transportTimeout, rc.Logger); err != nil {
+		return err
+	}
+	if n.logs, err = raftboltdb.NewBoltStore(filepath.Join(cfg.LogDir, "raft-log.db")); err != nil {
+		return err
+	}
+	if n.stable, err = raftboltdb.NewBoltStore(filepath.Join(cfg.StableDir, "raft-stable.db")); err != nil {
+		return err
+	}
+	snaps, err := raft.NewFileSnapshotStoreWithLogger(cfg.SnapDir, retainSnapshotCount, rc.Logger)
+	if err != nil {
+		return err
+	}
+
+	exist, err := raft.HasExistingState(n.logs, n.stable, snaps)
+	if err != nil {
+		return err
+	}
+	if n.raft, err = raft.NewRaft(rc, f, n.logs, n.stable, snaps, n.trans); err != nil {
+		return err
+	}
+
+	//新加入的节点等待leader通过AddVoter把自己加入集群
+	if !exist && !cfg.Join {
+		servers := []raft.Server{{ID: rc.LocalID, Address: n.trans.LocalAddr()}}
+		for _, peer := range cfg.Peers {
+			if peer != cfg.NodeAddr {
+				servers = append(servers, raft.Server{ID: raft.ServerID(peer), Address: raft.ServerAddress(peer)})
+			}
+		}
+		if err := n.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run leader定时从交易池取交易打包，通过raft日志复制给其他节点
+func (n *RaftNode) Run() {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+			if n.raft.State() != raft.Leader {
+				continue
+			}
+			if err := n.produce(); err != nil {
+				logger.Error("Failed to produce block", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (n *RaftNode) produce() error {
+	txs := n.tp.Pending(n.bc)
+	if len(txs) == 0 {
+		return nil
+	}
+
+	if n.reward > 0 {
+		txs = append(txs, transaction.NewCoinBaseTransaction(n.miner, n.reward))
+	}
+
+	//交易在区块提交后才从交易池中移除，失败时不需要放回
+	b, err := n.bc.NewBlock(txs, n.miner, n.ds, n.cm, n.qtj)
+	if err != nil {
+		return err
+	}
+
+	future := n.raft.Apply(b.Serialize(), applyTimeout)
+	if err := future.Error(); err != nil {
+		return err
+	}
+	if err, ok := future.Response().(error); ok && err != nil {
+		return err
+	}
+	return nil
+}
+
+func (n *RaftNode) AddVoter(id, addr string) error {
+	if n.raft.State() != raft.Leader {
+		return errNotLeader
+	}
+	return n.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(addr), 0, applyTimeout).Error()
+}
+
+func (n *RaftNode) Stop() error {
+	close(n.stop)
+	err := n.raft.Shutdown().Error()
+	n.close()
+	return err
+}
+
+func (n *RaftNode) close() {
+	if n.trans != nil {
+		n.trans.Close()
+	}
+	if n.logs != nil {
+		n.logs.Close()
+	}
+	if n.stable != nil {
+		n.stable.Close()
+	}
+}
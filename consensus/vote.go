@@ -0,0 +1,164 @@
+package consensus
+
+import (
+	"bytes"
+	"sort"
+
+	"kortho/block"
+	"kortho/types"
+	"kortho/util/codec"
+	"kortho/util/mixed"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	msgProposal uint8 = iota
+	msgPrevote
+	msgPrecommit
+)
+
+// BftMessage bft共识中的提案和投票消息，BlockHash为空表示投nil
+type BftMessage struct {
+	Type      uint8         `json:"type"`
+	Height    uint64        `json:"height"`
+	Round     uint64        `json:"round"`
+	BlockHash []byte        `json:"blockhash"`
+	Block     *block.Block  `json:"block,omitempty"`
+	Validator types.Address `json:"validator"`
+	Signature []byte        `json:"signature"`
+}
+
+// Serialize bft消息的二进制编码，区块使用block.Serialize的编码
+func (m *BftMessage) Serialize() []byte {
+	w := codec.NewWriter()
+	w.WriteUint8(m.Type)
+	w.WriteUint64(m.Height)
+	w.WriteUint64(m.Round)
+	w.WriteBytes(m.BlockHash)
+	if m.Block != nil {
+		w.WriteBytes(m.Block.Serialize())
+	} else {
+		w.WriteBytes(nil)
+	}
+	w.WriteFixed(m.Validator[:])
+	w.WriteBytes(m.Signature)
+	return w.Bytes()
+}
+
+func DeserializeMessage(data []byte) (*BftMessage, error) {
+	var m BftMessage
+	r := codec.NewReader(data)
+	m.Type = r.ReadUint8()
+	m.Height = r.ReadUint64()
+	m.Round = r.ReadUint64()
+	m.BlockHash = r.ReadBytes()
+	blockData := r.ReadBytes()
+	r.ReadFixed(m.Validator[:])
+	m.Signature = r.ReadBytes()
+	if err := r.Finish(); err != nil {
+		return nil, err
+	}
+
+	if blockData != nil {
+		b, err := block.Deserialize(blockData)
+		if err != nil {
+			return nil, err
+		}
+		m.Block = b
+	}
+	return &m, nil
+}
+
+var voteDomain = []byte("kortho bft vote")
+
+// 签名内容不包含区块本身，区块通过BlockHash间接覆盖；带有域前缀和链ID，投票不能在其他链上重放
+func signBytes(chainID uint64, typ uint8, height, round uint64, hash []byte) []byte {
+	data := bytes.Join([][]byte{voteDomain, mixed.E64func(chainID), mixed.E8func(typ), mixed.E64func(height), mixed.E64func(round), hash}, []byte{})
+	sum := sha3.Sum256(data)
+	return sum[:]
+}
+
+func (m *BftMessage) sign(priv []byte, chainID uint64) {
+	m.Signature = ed25519.Sign(ed25519.PrivateKey(priv), signBytes(chainID, m.Type, m.Height, m.Round, m.BlockHash))
+}
+
+func (m *BftMessage) verify(chainID uint64) bool {
+	return ed25519.Verify(m.Validator.ToPublicKey(), signBytes(chainID, m.Type, m.Height, m.Round, m.BlockHash), m.Signature)
+}
+
+// VerifyCommits 检查区块中的precommit签名是否达到2f+1，用于证明区块已经最终确认
+func VerifyCommits(b *block.Block, validators []types.Address, chainID uint64) bool {
+	set := make(map[types.Address]bool, len(validators))
+	for _, v := range validators {
+		set[v] = true
+	}
+
+	signed := make(map[types.Address]bool)
+	for _, c := range b.Commits {
+		if !set[c.Validator] || signed[c.Validator] {
+			continue
+		}
+		if ed25519.Verify(c.Validator.ToPublicKey(), signBytes(chainID, msgPrecommit, b.Height, c.Round, b.Hash), c.Signature) {
+			signed[c.Validator] = true
+		}
+	}
+
+	return len(signed) >= quorum(len(validators))
+}
+
+// 最多容忍f个拜占庭节点，n >= 3f+1
+func quorum(n int) int {
+	return n - (n-1)/3
+}
+
+type voteSet struct {
+	votes map[types.Address]*BftMessage
+	count map[string]int
+}
+
+func newVoteSet() *voteSet {
+	return &voteSet{
+		votes: make(map[types.Address]*BftMessage),
+		count: make(map[string]int),
+	}
+}
+
+// 同一个验证者在同一轮只能投一票
+func (vs *voteSet) add(m *BftMessage) bool {
+	if _, ok := vs.votes[m.Validator]; ok {
+		return false
+	}
+	vs.votes[m.Validator] = m
+	vs.count[string(m.BlockHash)]++
+	return true
+}
+
+func (vs *voteSet) size() int {
+	return len(vs.votes)
+}
+
+// 返回票数达到quorum的hash，nil投票返回空hash
+func (vs *voteSet) majority(quorum int) ([]byte, bool) {
+	for hash, count := range vs.count {
+		if count >= quorum {
+			if len(hash) == 0 {
+				return nil, true
+			}
+			return []byte(hash), true
+		}
+	}
+	return nil, false
+}
+
+func (vs *voteSet) commits(hash []byte) []*block.CommitSig {
+	var sigs []*block.CommitSig
+	for _, m := range vs.votes {
+		if bytes.Equal(m.BlockHash, hash) {
+			sigs = append(sigs, &block.CommitSig{Round: m.Round, Validator: m.Validator, Signature: m.Signature})
+		}
+	}
+	sort.Slice(sigs, func(i, j int) bool { return bytes.Compare(sigs[i].Validator[:], sigs[j].Validator[:]) < 0 })
+	return sigs
+}
@@ -24,6 +24,7 @@ require (
 	github.com/siddontang/go-log v0.0.0-20190221022429-1e957dd83bed
 	github.com/spf13/viper v1.3.2
 	github.com/tjfoc/gmsm v1.3.2
+	github.com/tyler-smith/go-bip39 v1.0.2
 	github.com/valyala/fasthttp v1.5.0
 	go.uber.org/zap v1.15.0
 	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59
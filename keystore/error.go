@@ -0,0 +1,14 @@
+package keystore
+
+import "errors"
+
+var (
+	ErrDecrypt    = errors.New("could not decrypt key with given password")
+	ErrVersion    = errors.New("unsupported key file version")
+	ErrCipher     = errors.New("unsupported cipher or kdf")
+	ErrKDFParams  = errors.New("scrypt parameters exceed the keystore limits")
+	ErrInvalidKey = errors.New("invalid private key")
+	ErrNoMatch    = errors.New("no key for given address")
+	ErrLocked     = errors.New("account is locked")
+	ErrExists     = errors.New("key already exists")
+)
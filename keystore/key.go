@@ -0,0 +1,168 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+
+	"kortho/types"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// Version 密钥文件格式的版本
+	Version = 1
+
+	// StandardScryptN、StandardScryptP 用于节点和钱包的参数，解密一次约需要1秒
+	StandardScryptN = 1 << 18
+	StandardScryptP = 1
+
+	// LightScryptN、LightScryptP 内存和时间开销较小，用于测试或者性能较差的设备
+	LightScryptN = 1 << 12
+	LightScryptP = 6
+
+	scryptR     = 8
+	scryptDKLen = 32
+
+	cipherName = "aes-256-gcm"
+	kdfName    = "scrypt"
+)
+
+// keyFile 密钥文件的json格式，私钥种子用口令派生的密钥经AES-GCM加密，地址作为附加数据
+type keyFile struct {
+	Version int        `json:"version"`
+	Address string     `json:"address"`
+	Crypto  cryptoJSON `json:"crypto"`
+}
+
+type cryptoJSON struct {
+	Cipher     string     `json:"cipher"`
+	CipherText string     `json:"ciphertext"`
+	Nonce      string     `json:"nonce"`
+	KDF        string     `json:"kdf"`
+	KDFParams  scryptJSON `json:"kdfparams"`
+}
+
+type scryptJSON struct {
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+}
+
+// EncryptKey 用口令加密私钥，返回密钥文件的内容
+func EncryptKey(privateKey ed25519.PrivateKey, password string, scryptN, scryptP int) ([]byte, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, ErrInvalidKey
+	}
+	address := types.PublicKeyToAddress(privateKey.Public().(ed25519.PublicKey))
+
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	derived, err := scrypt.Key([]byte(password), salt, scryptN, scryptR, scryptP, scryptDKLen)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(derived)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	ciphertext := gcm.Seal(nil, nonce, privateKey.Seed(), []byte(address))
+
+	return json.MarshalIndent(keyFile{
+		Version: Version,
+		Address: address,
+		Crypto: cryptoJSON{
+			Cipher:     cipherName,
+			CipherText: hex.EncodeToString(ciphertext),
+			Nonce:      hex.EncodeToString(nonce),
+			KDF:        kdfName,
+			KDFParams: scryptJSON{
+				N:     scryptN,
+				R:     scryptR,
+				P:     scryptP,
+				DKLen: scryptDKLen,
+				Salt:  hex.EncodeToString(salt),
+			},
+		},
+	}, "", "  ")
+}
+
+// DecryptKey 用口令解密密钥文件，返回私钥和地址；
+// 文件中的scrypt参数不能超过scryptN、scryptP，避免构造的文件消耗大量内存和时间
+func DecryptKey(data []byte, password string, scryptN, scryptP int) (ed25519.PrivateKey, *types.Address, error) {
+	var kf keyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, nil, err
+	}
+	if kf.Version != Version {
+		return nil, nil, ErrVersion
+	}
+	if kf.Crypto.Cipher != cipherName || kf.Crypto.KDF != kdfName {
+		return nil, nil, ErrCipher
+	}
+	address, err := types.StringToAddress(kf.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params := kf.Crypto.KDFParams
+	if params.N > scryptN || params.R > scryptR || params.P > scryptP || params.DKLen != scryptDKLen {
+		return nil, nil, ErrKDFParams
+	}
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := hex.DecodeString(kf.Crypto.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err := hex.DecodeString(kf.Crypto.CipherText)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	derived, err := scrypt.Key([]byte(password), salt, params.N, params.R, params.P, params.DKLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := newGCM(derived)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, nil, ErrDecrypt
+	}
+	seed, err := gcm.Open(nil, nonce, ciphertext, []byte(kf.Address))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, nil, ErrDecrypt
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	owner, err := types.StringToAddress(types.PublicKeyToAddress(privateKey.Public().(ed25519.PublicKey)))
+	if err != nil || *owner != *address {
+		return nil, nil, ErrDecrypt
+	}
+	return privateKey, address, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,318 @@
+// Package keystore 在目录中保存口令加密的私钥，解锁后可以按地址签名，调用者不需要接触私钥
+package keystore
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"kortho/transaction"
+	"kortho/types"
+)
+
+const keyFileExt = ".json"
+
+type KeyStore struct {
+	dir     string
+	scryptN int
+	scryptP int
+
+	mu       sync.Mutex
+	unlocked map[types.Address]*unlocked
+}
+
+type unlocked struct {
+	key   ed25519.PrivateKey
+	abort chan struct{}
+}
+
+// New 打开保存密钥文件的目录，目录不存在时创建，旧格式地址命名的密钥文件改用新格式命名
+func New(dir string, scryptN, scryptP int) (*KeyStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	ks := &KeyStore{
+		dir:      dir,
+		scryptN:  scryptN,
+		scryptP:  scryptP,
+		unlocked: make(map[types.Address]*unlocked),
+	}
+	if err := ks.migrate(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+//带校验和的地址格式之前创建的密钥文件以旧格式地址命名
+func (ks *KeyStore) migrate() error {
+	files, err := ioutil.ReadDir(ks.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), keyFileExt)
+		if file.IsDir() || name == file.Name() || len(name) != types.AddressSize {
+			continue
+		}
+		addr, err := types.BytesToAddress([]byte(name))
+		if err != nil {
+			continue
+		}
+		path := ks.path(*addr)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := os.Rename(filepath.Join(ks.dir, file.Name()), path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Accounts 目录中所有密钥的地址
+func (ks *KeyStore) Accounts() ([]types.Address, error) {
+	files, err := ioutil.ReadDir(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []types.Address
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, keyFileExt) {
+			continue
+		}
+		addr, err := types.StringToAddress(strings.TrimSuffix(name, keyFileExt))
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, *addr)
+	}
+	return addrs, nil
+}
+
+func (ks *KeyStore) HasAddress(addr types.Address) bool {
+	_, err := os.Stat(ks.path(addr))
+	return err == nil
+}
+
+// NewAccount 生成新的私钥并用口令加密保存
+func (ks *KeyStore) NewAccount(password string) (types.Address, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return types.Address{}, err
+	}
+	return ks.ImportKey(privateKey, password)
+}
+
+// ImportKey 导入私钥，用口令加密保存
+func (ks *KeyStore) ImportKey(privateKey ed25519.PrivateKey, password string) (types.Address, error) {
+	data, err := EncryptKey(privateKey, password, ks.scryptN, ks.scryptP)
+	if err != nil {
+		return types.Address{}, err
+	}
+	addr, err := types.StringToAddress(types.PublicKeyToAddress(privateKey.Public().(ed25519.PublicKey)))
+	if err != nil {
+		return types.Address{}, err
+	}
+	return *addr, ks.write(*addr, data)
+}
+
+// Import 导入其他地方导出的密钥文件，用password解密后以newPassword重新加密保存
+func (ks *KeyStore) Import(data []byte, password, newPassword string) (types.Address, error) {
+	privateKey, _, err := DecryptKey(data, password, ks.scryptN, ks.scryptP)
+	if err != nil {
+		return types.Address{}, err
+	}
+	defer zeroKey(privateKey)
+	return ks.ImportKey(privateKey, newPassword)
+}
+
+// Export 导出用newPassword重新加密的密钥文件
+func (ks *KeyStore) Export(addr types.Address, password, newPassword string) ([]byte, error) {
+	privateKey, err := ks.decrypt(addr, password)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(privateKey)
+	return EncryptKey(privateKey, newPassword, ks.scryptN, ks.scryptP)
+}
+
+// Delete 验证口令后删除密钥文件
+func (ks *KeyStore) Delete(addr types.Address, password string) error {
+	privateKey, err := ks.decrypt(addr, password)
+	if err != nil {
+		return err
+	}
+	zeroKey(privateKey)
+	ks.Lock(addr)
+	return os.Remove(ks.path(addr))
+}
+
+// Unlock 解锁账户，timeout为0时一直保持解锁直到调用Lock
+func (ks *KeyStore) Unlock(addr types.Address, password string, timeout time.Duration) error {
+	privateKey, err := ks.decrypt(addr, password)
+	if err != nil {
+		return err
+	}
+
+	u := &unlocked{key: privateKey, abort: make(chan struct{})}
+	ks.mu.Lock()
+	if old, ok := ks.unlocked[addr]; ok {
+		close(old.abort)
+		zeroKey(old.key)
+	}
+	ks.unlocked[addr] = u
+	ks.mu.Unlock()
+
+	if timeout > 0 {
+		go ks.expire(addr, u, timeout)
+	}
+	return nil
+}
+
+func (ks *KeyStore) Lock(addr types.Address) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if u, ok := ks.unlocked[addr]; ok {
+		close(u.abort)
+		zeroKey(u.key)
+		delete(ks.unlocked, addr)
+	}
+}
+
+func (ks *KeyStore) expire(addr types.Address, u *unlocked, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-u.abort:
+	case <-timer.C:
+		ks.mu.Lock()
+		//期间可能被重新解锁，只清除自己的这一次
+		if ks.unlocked[addr] == u {
+			zeroKey(u.key)
+			delete(ks.unlocked, addr)
+		}
+		ks.mu.Unlock()
+	}
+}
+
+// Sign 用已解锁的账户签名
+func (ks *KeyStore) Sign(addr types.Address, data []byte) ([]byte, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	u, ok := ks.unlocked[addr]
+	if !ok {
+		return nil, ErrLocked
+	}
+	return ed25519.Sign(u.key, data), nil
+}
+
+// SignTx 用已解锁的账户签名交易，交易的发送者必须是addr，多签交易则addr必须是账户成员
+func (ks *KeyStore) SignTx(addr types.Address, tx *transaction.Transaction) error {
+	if err := checkSigner(addr, tx); err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	u, ok := ks.unlocked[addr]
+	if !ok {
+		return ErrLocked
+	}
+	return signTx(u.key, tx)
+}
+
+// SignTxWithPassword 不解锁账户，用口令临时解密私钥签名交易
+func (ks *KeyStore) SignTxWithPassword(addr types.Address, password string, tx *transaction.Transaction) error {
+	if err := checkSigner(addr, tx); err != nil {
+		return err
+	}
+	privateKey, err := ks.decrypt(addr, password)
+	if err != nil {
+		return err
+	}
+	defer zeroKey(privateKey)
+	return signTx(privateKey, tx)
+}
+
+func checkSigner(addr types.Address, tx *transaction.Transaction) error {
+	if tx.MultiSig != nil {
+		if tx.MultiSig.Index(addr.ToPublicKey()) < 0 {
+			return ErrNoMatch
+		}
+		return nil
+	}
+	if tx.From != addr {
+		return ErrNoMatch
+	}
+	return nil
+}
+
+//多签交易只填入该成员的签名
+func signTx(privateKey ed25519.PrivateKey, tx *transaction.Transaction) error {
+	if tx.MultiSig != nil {
+		_, err := tx.SignMultiSig(privateKey)
+		return err
+	}
+	tx.Sgin(privateKey)
+	return nil
+}
+
+func (ks *KeyStore) decrypt(addr types.Address, password string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(ks.path(addr))
+	if os.IsNotExist(err) {
+		return nil, ErrNoMatch
+	}
+	if err != nil {
+		return nil, err
+	}
+	privateKey, keyAddr, err := DecryptKey(data, password, ks.scryptN, ks.scryptP)
+	if err != nil {
+		return nil, err
+	}
+	if *keyAddr != addr {
+		zeroKey(privateKey)
+		return nil, ErrNoMatch
+	}
+	return privateKey, nil
+}
+
+//先写临时文件再重命名，避免留下不完整的密钥文件
+func (ks *KeyStore) write(addr types.Address, data []byte) error {
+	path := ks.path(addr)
+	if _, err := os.Stat(path); err == nil {
+		return ErrExists
+	}
+	tmp, err := ioutil.TempFile(ks.dir, "."+addr.String()+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (ks *KeyStore) path(addr types.Address) string {
+	return filepath.Join(ks.dir, addr.String()+keyFileExt)
+}
+
+func zeroKey(key []byte) {
+	for i := range key {
+		key[i] = 0
+	}
+}
@@ -0,0 +1,212 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kortho/transaction"
+	"kortho/types"
+)
+
+func newTestKeyStore(t *testing.T) *KeyStore {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := New(dir, LightScryptN, LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	wallet := types.NewWallet()
+	data, err := EncryptKey(wallet.PrivateKey, "password", LightScryptN, LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, wallet.PrivateKey[:ed25519.SeedSize]) {
+		t.Fatal("key file contains the raw private key")
+	}
+
+	privateKey, addr, err := DecryptKey(data, "password", LightScryptN, LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(privateKey, wallet.PrivateKey) || addr.String() != wallet.Address {
+		t.Fatalf("decrypted %s, want %s", addr.String(), wallet.Address)
+	}
+	if _, _, err := DecryptKey(data, "wrong", LightScryptN, LightScryptP); err != ErrDecrypt {
+		t.Fatalf("wrong password: %v", err)
+	}
+
+	//篡改地址后认证失败
+	other := types.NewWallet()
+	tampered := bytes.Replace(data, []byte(wallet.Address), []byte(other.Address), 1)
+	if _, _, err := DecryptKey(tampered, "password", LightScryptN, LightScryptP); err != ErrDecrypt {
+		t.Fatalf("tampered address: %v", err)
+	}
+
+	//参数超过keystore的设置时不执行scrypt
+	if _, _, err := DecryptKey(data, "password", LightScryptN/2, LightScryptP); err != ErrKDFParams {
+		t.Fatalf("scrypt n over the limit: %v", err)
+	}
+	if _, _, err := DecryptKey(data, "password", LightScryptN, LightScryptP-1); err != ErrKDFParams {
+		t.Fatalf("scrypt p over the limit: %v", err)
+	}
+	for _, edit := range [][2]string{{`"r": 8`, `"r": 16`}, {`"dklen": 32`, `"dklen": 16`}} {
+		edited := bytes.Replace(data, []byte(edit[0]), []byte(edit[1]), 1)
+		if bytes.Equal(edited, data) {
+			t.Fatalf("key file has no %s", edit[0])
+		}
+		if _, _, err := DecryptKey(edited, "password", LightScryptN, LightScryptP); err != ErrKDFParams {
+			t.Fatalf("edited %s: %v", edit[1], err)
+		}
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	ks := newTestKeyStore(t)
+	defer os.RemoveAll(ks.dir)
+	addr, err := ks.NewAccount("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := ks.Accounts()
+	if err != nil || len(accounts) != 1 || accounts[0] != addr {
+		t.Fatalf("accounts %v, %v", accounts, err)
+	}
+
+	data, err := ks.Export(addr, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Export(addr, "b", "c"); err != ErrDecrypt {
+		t.Fatalf("export with wrong password: %v", err)
+	}
+
+	other := newTestKeyStore(t)
+	defer os.RemoveAll(other.dir)
+	imported, err := other.Import(data, "b", "c")
+	if err != nil || imported != addr {
+		t.Fatalf("import %s, %v", imported.String(), err)
+	}
+	if _, err := other.Import(data, "b", "c"); err != ErrExists {
+		t.Fatalf("import twice: %v", err)
+	}
+	if err := other.Unlock(addr, "c", 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnlockSign(t *testing.T) {
+	ks := newTestKeyStore(t)
+	defer os.RemoveAll(ks.dir)
+	wallet := types.NewWallet()
+	addr, err := ks.ImportKey(wallet.PrivateKey, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := types.NewWallet()
+	toAddr, _ := types.StringToAddress(to.Address)
+	tx := transaction.NewTransaction(1, 600000, addr, *toAddr)
+
+	if err := ks.SignTx(addr, tx); err != ErrLocked {
+		t.Fatalf("sign while locked: %v", err)
+	}
+	if err := ks.Unlock(addr, "wrong", 0); err != ErrDecrypt {
+		t.Fatalf("unlock with wrong password: %v", err)
+	}
+	if err := ks.Unlock(addr, "password", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.SignTx(addr, tx); err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Verify() {
+		t.Fatal("signature does not verify")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if _, err := ks.Sign(addr, tx.Hash); err != ErrLocked {
+		t.Fatalf("sign after timeout: %v", err)
+	}
+
+	if err := ks.SignTxWithPassword(addr, "password", tx); err != nil || !tx.Verify() {
+		t.Fatalf("sign with password: %v", err)
+	}
+	if err := ks.SignTxWithPassword(*toAddr, "password", tx); err != ErrNoMatch {
+		t.Fatalf("sign for another sender: %v", err)
+	}
+}
+
+func TestSignMultiSigTx(t *testing.T) {
+	ks := newTestKeyStore(t)
+	defer os.RemoveAll(ks.dir)
+	a, err := ks.NewAccount("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ks.NewAccount("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outsider, _ := types.StringToAddress(types.NewWallet().Address)
+	account, err := types.NewMultiSigAccount(2, [][]byte{a.ToPublicKey(), b.ToPublicKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := transaction.NewTransaction(1, 600000, account.Address(), *outsider, transaction.WithMultiSig(account))
+
+	//每个成员只填入自己的签名
+	if err := ks.SignTxWithPassword(a, "a", tx); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Verify() {
+		t.Fatal("verified with one of two signatures")
+	}
+	if err := ks.SignTxWithPassword(b, "b", tx); err != nil || !tx.Verify() {
+		t.Fatalf("sign with second member: %v", err)
+	}
+	if err := ks.SignTxWithPassword(*outsider, "a", tx); err != ErrNoMatch {
+		t.Fatalf("sign by outsider: %v", err)
+	}
+}
+
+//旧格式地址命名的密钥文件在打开时改名，仍然可以解锁
+func TestLegacyKeyFile(t *testing.T) {
+	ks := newTestKeyStore(t)
+	defer os.RemoveAll(ks.dir)
+
+	addr, err := ks.NewAccount("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := filepath.Join(ks.dir, addr.LegacyString()+keyFileExt)
+	if err := os.Rename(ks.path(addr), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err = New(ks.dir, LightScryptN, LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ks.HasAddress(addr) {
+		t.Fatal("legacy key file is not migrated")
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatalf("legacy key file is left: %v", err)
+	}
+	if accounts, err := ks.Accounts(); err != nil || len(accounts) != 1 || accounts[0] != addr {
+		t.Fatalf("accounts %v: %v", accounts, err)
+	}
+	if err := ks.Unlock(addr, "password", 0); err != nil {
+		t.Fatal(err)
+	}
+}
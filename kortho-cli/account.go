@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"kortho/keystore"
+	"kortho/types"
+	"kortho/util"
+	"kortho/util/codec"
+	"kortho/util/hd"
+)
+
+const defaultKeystore = "./keystore"
+
+var errArgs = errors.New("wrong number of arguments")
+
+func openKeystore(dir string) (*keystore.KeyStore, error) {
+	return keystore.New(dir, keystore.StandardScryptN, keystore.StandardScryptP)
+}
+
+func accountNew(args []string) error {
+	fs := flag.NewFlagSet("account new", flag.ExitOnError)
+	dir := fs.String("keystore", defaultKeystore, "keystore directory")
+	passfile := fs.String("passfile", "", "file containing the password")
+	fs.Parse(args)
+
+	ks, err := openKeystore(*dir)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword(*passfile, "Password: ", true)
+	if err != nil {
+		return err
+	}
+	addr, err := ks.NewAccount(password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(addr.String())
+	return nil
+}
+
+func accountList(args []string) error {
+	fs := flag.NewFlagSet("account list", flag.ExitOnError)
+	dir := fs.String("keystore", defaultKeystore, "keystore directory")
+	fs.Parse(args)
+
+	ks, err := openKeystore(*dir)
+	if err != nil {
+		return err
+	}
+	accounts, err := ks.Accounts()
+	if err != nil {
+		return err
+	}
+	for _, addr := range accounts {
+		fmt.Println(addr.String())
+	}
+	return nil
+}
+
+// accountImport 导入base58编码的私钥，或者用其他口令加密的密钥文件
+func accountImport(args []string) error {
+	fs := flag.NewFlagSet("account import", flag.ExitOnError)
+	dir := fs.String("keystore", defaultKeystore, "keystore directory")
+	passfile := fs.String("passfile", "", "file containing the new password")
+	oldPassfile := fs.String("oldpassfile", "", "file containing the password of the key file")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errArgs
+	}
+
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	ks, err := openKeystore(*dir)
+	if err != nil {
+		return err
+	}
+
+	var addr types.Address
+	if codec.IsJSON(data) {
+		old, err := readPassword(*oldPassfile, "Password of the key file: ", false)
+		if err != nil {
+			return err
+		}
+		password, err := readPassword(*passfile, "New password: ", true)
+		if err != nil {
+			return err
+		}
+		if addr, err = ks.Import(data, old, password); err != nil {
+			return err
+		}
+	} else {
+		privateKey := util.Decode(string(bytes.TrimSpace(data)))
+		if len(privateKey) != ed25519.PrivateKeySize {
+			return keystore.ErrInvalidKey
+		}
+		password, err := readPassword(*passfile, "Password: ", true)
+		if err != nil {
+			return err
+		}
+		if addr, err = ks.ImportKey(privateKey, password); err != nil {
+			return err
+		}
+	}
+	fmt.Println(addr.String())
+	return nil
+}
+
+// accountExport 导出用新口令加密的密钥文件
+func accountExport(args []string) error {
+	fs := flag.NewFlagSet("account export", flag.ExitOnError)
+	dir := fs.String("keystore", defaultKeystore, "keystore directory")
+	passfile := fs.String("passfile", "", "file containing the password")
+	newPassfile := fs.String("newpassfile", "", "file containing the password of the exported file")
+	out := fs.String("out", "", "output key file")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		return errArgs
+	}
+
+	addr, err := types.StringToAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	ks, err := openKeystore(*dir)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword(*passfile, "Password: ", false)
+	if err != nil {
+		return err
+	}
+	newPassword, err := readPassword(*newPassfile, "Password of the exported file: ", true)
+	if err != nil {
+		return err
+	}
+	data, err := ks.Export(*addr, password, newPassword)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, data)
+}
+
+func mnemonicNew(args []string) error {
+	fs := flag.NewFlagSet("mnemonic new", flag.ExitOnError)
+	bits := fs.Int("bits", hd.DefaultEntropyBits, "entropy bits, 128 to 256")
+	fs.Parse(args)
+
+	mnemonic, err := hd.NewMnemonic(*bits)
+	if err != nil {
+		return err
+	}
+	fmt.Println(mnemonic)
+	return nil
+}
+
+// mnemonicDerive 按BasePath派生地址，-import时把私钥加密保存到keystore
+func mnemonicDerive(args []string) error {
+	fs := flag.NewFlagSet("mnemonic derive", flag.ExitOnError)
+	in := fs.String("in", "", "file containing the mnemonic")
+	start := fs.Uint("start", 0, "first address index")
+	count := fs.Uint("count", 1, "number of addresses")
+	doImport := fs.Bool("import", false, "import the derived keys into the keystore")
+	dir := fs.String("keystore", defaultKeystore, "keystore directory")
+	passfile := fs.String("passfile", "", "file containing the keystore password")
+	passphraseFile := fs.String("passphrasefile", "", "file containing the optional mnemonic passphrase")
+	fs.Parse(args)
+
+	mnemonic, err := readLine(*in, "Mnemonic: ")
+	if err != nil {
+		return err
+	}
+	var passphrase string
+	if *passphraseFile != "" {
+		if passphrase, err = readPassword(*passphraseFile, "", false); err != nil {
+			return err
+		}
+	}
+	seed, err := hd.MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return err
+	}
+	wallets, err := hd.DeriveWallets(seed, uint32(*start), uint32(*count))
+	if err != nil {
+		return err
+	}
+
+	var ks *keystore.KeyStore
+	var password string
+	if *doImport {
+		if ks, err = openKeystore(*dir); err != nil {
+			return err
+		}
+		if password, err = readPassword(*passfile, "Keystore password: ", true); err != nil {
+			return err
+		}
+	}
+	for i, wallet := range wallets {
+		if ks != nil {
+			if _, err := ks.ImportKey(wallet.PrivateKey, password); err != nil && err != keystore.ErrExists {
+				return err
+			}
+		}
+		fmt.Println(hd.AddressPath(uint32(*start)+uint32(i)), wallet.Address)
+	}
+	return nil
+}
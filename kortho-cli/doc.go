@@ -0,0 +1,53 @@
+// kortho-cli 钱包和离线签名工具，私钥只保存在加密的keystore中，不需要发送到节点。
+//
+// 冷钱包转账分三步，各步骤之间通过交易文件交换数据，只有build和submit需要连接节点：
+//
+//	kortho-cli tx build -node 127.0.0.1:9501 -cert server.crt -chainid 1 -from kto... -to kto... -amount 600000 -out unsigned.json
+//	kortho-cli tx sign -keystore ./keystore -in unsigned.json -out signed.json      (离线机器)
+//	kortho-cli tx submit -node 127.0.0.1:9501 -cert server.crt -in signed.json
+//
+// 一个助记词按BIP39和SLIP-0010派生任意数量的地址，只需要备份助记词：
+//
+//	kortho-cli mnemonic new > mnemonic.txt
+//	kortho-cli mnemonic derive -in mnemonic.txt -start 0 -count 1000 -import -keystore ./keystore
+//
+// 派生路径是hd.BasePath下的第i个账户，同一个助记词和口令总是得到相同的地址。
+//
+// 多签账户的交易由各成员分别签名同一个未签名文件，再合并签名后提交：
+//
+//	kortho-cli multisig new -threshold 2 -out treasury.json kto1... kto2... kto3...
+//	kortho-cli tx build -multisig treasury.json ... -out unsigned.json
+//	kortho-cli tx sign -signer kto1... -in unsigned.json -out a.json
+//	kortho-cli tx sign -signer kto2... -in unsigned.json -out b.json
+//	kortho-cli tx merge -out signed.json a.json b.json
+//
+// 交易文件是json格式，版本1：
+//
+//	{
+//	  "version": 1,
+//	  "chainid": 1,
+//	  "hash": "交易hash，hex编码",
+//	  "from": "kto...",
+//	  "to": "kto...",
+//	  "amount": 600000,
+//	  "fee": 0,
+//	  "nonce": 3,
+//	  "threshold": 2,
+//	  "signed": 1,
+//	  "raw": "transaction.Transaction.Serialize()的hex编码"
+//	}
+//
+// raw是唯一用于签名和提交的数据，其余字段方便在离线机器上核对，读取时必须与raw一致。
+// threshold只出现在多签交易中，signed是已有的有效签名数量。
+//
+// 多签账户文件是json格式，版本1：
+//
+//	{
+//	  "version": 1,
+//	  "address": "kto...",
+//	  "threshold": 2,
+//	  "members": ["kto...", "kto...", "kto..."]
+//	}
+//
+// 口令默认从终端读取，-passfile指定时读取文件的第一行。
+package main
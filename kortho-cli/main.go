@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]map[string]command{
+	"account": {
+		"new":    {"[-keystore dir] [-passfile file]", accountNew},
+		"list":   {"[-keystore dir]", accountList},
+		"import": {"[-keystore dir] [-passfile file] [-oldpassfile file] <key file>", accountImport},
+		"export": {"[-keystore dir] [-passfile file] [-newpassfile file] -out file <address>", accountExport},
+	},
+	"mnemonic": {
+		"new":    {"[-bits 256]", mnemonicNew},
+		"derive": {"[-in file] [-passphrasefile file] [-start 0] [-count 1] [-import] [-keystore dir] [-passfile file]", mnemonicDerive},
+	},
+	"multisig": {
+		"new":  {"-threshold m [-out file] <address>...", multisigNew},
+		"show": {"-in file", multisigShow},
+	},
+	"tx": {
+		"build":  {"-chainid id -to address -amount n [-fee n] [-nonce n] (-from address | -multisig file) [-node host:port] [-cert file] [-servername name] [-out file]", txBuild},
+		"sign":   {"-in file [-out file] [-signer address] [-keystore dir] [-passfile file]", txSign},
+		"merge":  {"[-out file] <file>...", txMerge},
+		"show":   {"-in file", txShow},
+		"submit": {"-in file [-node host:port] [-cert file] [-servername name]", txSubmit},
+	},
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]][os.Args[2]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[3:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: kortho-cli <command> <subcommand> [flags]")
+	groups := make([]string, 0, len(commands))
+	for group := range commands {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		names := make([]string, 0, len(commands[group]))
+		for name := range commands[group] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %s %s %s\n", group, name, commands[group][name].usage)
+		}
+	}
+}
+
+var errPasswordMismatch = errors.New("passwords do not match")
+
+//口令从文件的第一行读取，没有指定文件时从终端读取
+func readPassword(file, prompt string, confirm bool) (string, error) {
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(strings.SplitN(string(data), "\n", 2)[0], "\r"), nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat password: ")
+		again, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(again) != string(password) {
+			return "", errPasswordMismatch
+		}
+	}
+	return string(password), nil
+}
+
+//没有指定文件时从标准输入读取一行
+func readLine(file, prompt string) (string, error) {
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+//没有指定文件时写到标准输出
+func writeOutput(file string, data []byte) error {
+	if file == "" {
+		_, err := os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	return ioutil.WriteFile(file, append(data, '\n'), 0600)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"kortho/types"
+)
+
+const multisigFileVersion = 1
+
+var errMultisigFile = errors.New("multisig file does not match its address")
+
+// multisigFile 多签账户文件，成员用地址表示，地址中包含公钥
+type multisigFile struct {
+	Version   int      `json:"version"`
+	Address   string   `json:"address"`
+	Threshold uint32   `json:"threshold"`
+	Members   []string `json:"members"`
+}
+
+func newMultisigFile(account *types.MultiSigAccount) *multisigFile {
+	address := account.Address()
+	f := &multisigFile{
+		Version:   multisigFileVersion,
+		Address:   address.String(),
+		Threshold: account.Threshold,
+	}
+	for _, key := range account.PublicKeys {
+		f.Members = append(f.Members, types.PublicKeyToAddress(key))
+	}
+	return f
+}
+
+func loadMultisig(file string) (*types.MultiSigAccount, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var f multisigFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Version != multisigFileVersion {
+		return nil, fmt.Errorf("unsupported multisig file version %d", f.Version)
+	}
+	account, err := multisigAccount(f.Threshold, f.Members)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := types.StringToAddress(f.Address)
+	if err != nil {
+		return nil, err
+	}
+	if account.Address() != *addr {
+		return nil, errMultisigFile
+	}
+	return account, nil
+}
+
+func multisigAccount(threshold uint32, members []string) (*types.MultiSigAccount, error) {
+	keys := make([][]byte, 0, len(members))
+	for _, member := range members {
+		addr, err := types.StringToAddress(member)
+		if err != nil {
+			return nil, fmt.Errorf("member %s: %v", member, err)
+		}
+		keys = append(keys, addr.ToPublicKey())
+	}
+	return types.NewMultiSigAccount(threshold, keys)
+}
+
+func multisigNew(args []string) error {
+	fs := flag.NewFlagSet("multisig new", flag.ExitOnError)
+	threshold := fs.Uint("threshold", 0, "number of signatures required")
+	out := fs.String("out", "", "output multisig file")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errArgs
+	}
+
+	account, err := multisigAccount(uint32(*threshold), fs.Args())
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(newMultisigFile(account), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, data)
+}
+
+func multisigShow(args []string) error {
+	fs := flag.NewFlagSet("multisig show", flag.ExitOnError)
+	in := fs.String("in", "", "multisig file")
+	fs.Parse(args)
+
+	account, err := loadMultisig(*in)
+	if err != nil {
+		return err
+	}
+	f := newMultisigFile(account)
+	fmt.Printf("address:   %s\nthreshold: %d of %d\n", f.Address, f.Threshold, len(f.Members))
+	for _, member := range f.Members {
+		fmt.Println("member:   ", member)
+	}
+	return nil
+}
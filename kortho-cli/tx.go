@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"kortho/api/message"
+	"kortho/transaction"
+	"kortho/types"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	defaultNode = "127.0.0.1:9501"
+	rpcTimeout  = 10 * time.Second
+)
+
+var (
+	errChainID    = errors.New("-chainid is required")
+	errSender     = errors.New("exactly one of -from and -multisig is required")
+	errSigner     = errors.New("-signer is required for multisig transactions")
+	errNotSigned  = errors.New("transaction is not fully signed")
+	errNoTxFiles  = errors.New("no transaction files to merge")
+	errRejectedTx = errors.New("transaction rejected")
+)
+
+type rpcFlags struct {
+	node       *string
+	cert       *string
+	serverName *string
+}
+
+func addRPCFlags(fs *flag.FlagSet) *rpcFlags {
+	return &rpcFlags{
+		node:       fs.String("node", defaultNode, "gRPC address of the node"),
+		cert:       fs.String("cert", "", "TLS certificate of the node, system roots if empty"),
+		serverName: fs.String("servername", "", "server name in the node certificate"),
+	}
+}
+
+//节点的gRPC服务使用TLS
+func (f *rpcFlags) dial(ctx context.Context) (*grpc.ClientConn, error) {
+	creds := credentials.NewTLS(&tls.Config{ServerName: *f.serverName})
+	if *f.cert != "" {
+		var err error
+		if creds, err = credentials.NewClientTLSFromFile(*f.cert, *f.serverName); err != nil {
+			return nil, err
+		}
+	}
+	return grpc.DialContext(ctx, *f.node, grpc.WithTransportCredentials(creds), grpc.WithBlock())
+}
+
+// txBuild 构造未签名的交易，没有指定-nonce时从节点查询发送者的nonce
+func txBuild(args []string) error {
+	fs := flag.NewFlagSet("tx build", flag.ExitOnError)
+	rpc := addRPCFlags(fs)
+	chainID := fs.Uint64("chainid", 0, "chain id of the target network")
+	from := fs.String("from", "", "sender address")
+	multisig := fs.String("multisig", "", "multisig file of the sender account")
+	to := fs.String("to", "", "recipient address")
+	amount := fs.Uint64("amount", 0, "amount to transfer")
+	fee := fs.Uint64("fee", 0, "transaction fee")
+	nonce := fs.Int64("nonce", -1, "sender nonce, queried from the node if negative")
+	out := fs.String("out", "", "output transaction file")
+	fs.Parse(args)
+
+	if *chainID == 0 {
+		return errChainID
+	}
+	if (*from == "") == (*multisig == "") {
+		return errSender
+	}
+	toAddr, err := types.StringToAddress(*to)
+	if err != nil {
+		return fmt.Errorf("to %s: %v", *to, err)
+	}
+
+	var options []transaction.ModOption
+	var fromAddr types.Address
+	if *multisig != "" {
+		account, err := loadMultisig(*multisig)
+		if err != nil {
+			return err
+		}
+		fromAddr = account.Address()
+		options = append(options, transaction.WithMultiSig(account))
+	} else {
+		addr, err := types.StringToAddress(*from)
+		if err != nil {
+			return fmt.Errorf("from %s: %v", *from, err)
+		}
+		fromAddr = *addr
+	}
+
+	//链上的nonce不包括交易池中还没有打包的交易，连续发送时需要手动指定
+	if *nonce < 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		defer cancel()
+		conn, err := rpc.dial(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		resp, err := message.NewGreeterClient(conn).GetAddressNonceAt(ctx, &message.ReqNonce{Address: fromAddr.String()})
+		if err != nil {
+			return err
+		}
+		*nonce = int64(resp.Nonce)
+	}
+
+	options = append(options, transaction.WithChainID(*chainID))
+	tx := transaction.NewTransaction(uint64(*nonce), *amount, fromAddr, *toAddr, options...)
+	tx.Fee = *fee
+	tx.HashTransaction()
+	return writeTx(*out, tx)
+}
+
+// txSign 用keystore中的私钥离线签名，不访问网络
+func txSign(args []string) error {
+	fs := flag.NewFlagSet("tx sign", flag.ExitOnError)
+	in := fs.String("in", "", "unsigned transaction file")
+	out := fs.String("out", "", "output transaction file")
+	signer := fs.String("signer", "", "signing address, the sender by default")
+	dir := fs.String("keystore", defaultKeystore, "keystore directory")
+	passfile := fs.String("passfile", "", "file containing the password")
+	fs.Parse(args)
+
+	tx, err := readTx(*in)
+	if err != nil {
+		return err
+	}
+	addr := tx.From
+	if *signer != "" {
+		a, err := types.StringToAddress(*signer)
+		if err != nil {
+			return fmt.Errorf("signer %s: %v", *signer, err)
+		}
+		addr = *a
+	} else if tx.MultiSig != nil {
+		return errSigner
+	}
+
+	//签名前显示交易内容，方便在离线机器上核对
+	printTx(os.Stderr, tx)
+	ks, err := openKeystore(*dir)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword(*passfile, fmt.Sprintf("Password of %s: ", addr.String()), false)
+	if err != nil {
+		return err
+	}
+	if err := ks.SignTxWithPassword(addr, password, tx); err != nil {
+		return err
+	}
+	return writeTx(*out, tx)
+}
+
+// txMerge 合并各成员分别签名的多签交易
+func txMerge(args []string) error {
+	fs := flag.NewFlagSet("tx merge", flag.ExitOnError)
+	out := fs.String("out", "", "output transaction file")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errNoTxFiles
+	}
+
+	tx, err := readTx(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, file := range fs.Args()[1:] {
+		other, err := readTx(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		if err := tx.MergeSignatures(other); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	printTx(os.Stderr, tx)
+	return writeTx(*out, tx)
+}
+
+func txShow(args []string) error {
+	fs := flag.NewFlagSet("tx show", flag.ExitOnError)
+	in := fs.String("in", "", "transaction file")
+	fs.Parse(args)
+
+	tx, err := readTx(*in)
+	if err != nil {
+		return err
+	}
+	printTx(os.Stdout, tx)
+	return nil
+}
+
+// txSubmit 把签名后的交易通过SendRawTransaction发送到节点
+func txSubmit(args []string) error {
+	fs := flag.NewFlagSet("tx submit", flag.ExitOnError)
+	rpc := addRPCFlags(fs)
+	in := fs.String("in", "", "signed transaction file")
+	fs.Parse(args)
+
+	tx, err := readTx(*in)
+	if err != nil {
+		return err
+	}
+	if !tx.Verify() {
+		if tx.MultiSig != nil {
+			return fmt.Errorf("%v: %d of %d signatures", errNotSigned, tx.MultiSig.Signed(tx.Hash), tx.MultiSig.Threshold)
+		}
+		return errNotSigned
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	conn, err := rpc.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	resp, err := message.NewGreeterClient(conn).SendRawTransaction(ctx, &message.ReqRawTransaction{Tx: tx.Serialize()})
+	if err != nil {
+		return err
+	}
+	if resp.Code != message.TxErrorCode_TX_OK {
+		return fmt.Errorf("%v: %s %s", errRejectedTx, resp.Code, resp.Message)
+	}
+	fmt.Println(resp.Hash)
+	return nil
+}
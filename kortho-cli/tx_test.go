@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"kortho/api/message"
+	"kortho/keystore"
+	"kortho/transaction"
+	"kortho/types"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+//只实现build和submit用到的两个接口
+type stubNode struct {
+	message.UnimplementedGreeterServer
+	nonce     uint64
+	submitted chan []byte
+}
+
+func (s *stubNode) GetAddressNonceAt(ctx context.Context, in *message.ReqNonce) (*message.ResposeNonce, error) {
+	return &message.ResposeNonce{Nonce: s.nonce}, nil
+}
+
+func (s *stubNode) SendRawTransaction(ctx context.Context, in *message.ReqRawTransaction) (*message.ResRawTransaction, error) {
+	s.submitted <- in.Tx
+	tx, err := transaction.Deserialize(in.Tx)
+	if err != nil {
+		return &message.ResRawTransaction{Code: message.TxErrorCode_TX_REJECTED, Message: err.Error()}, nil
+	}
+	return &message.ResRawTransaction{Hash: hex.EncodeToString(tx.Hash), Code: message.TxErrorCode_TX_OK}, nil
+}
+
+//节点的gRPC服务使用TLS，测试时用自签名证书，返回节点地址和证书文件
+func startStubNode(t *testing.T, dir string, s *stubNode) (string, string, func()) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "node.crt")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+	message.RegisterGreeterServer(server, s)
+	go server.Serve(l)
+	return l.Addr().String(), certFile, server.Stop
+}
+
+func newTestKeys(t *testing.T, dir string, n int) []string {
+	//命令行用标准参数打开keystore，测试的密钥文件参数不能超过它
+	ks, err := keystore.New(filepath.Join(dir, "keystore"), keystore.LightScryptN, keystore.StandardScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var addrs []string
+	for i := 0; i < n; i++ {
+		addr, err := ks.NewAccount("password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, addr.String())
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "password"), []byte("password\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return addrs
+}
+
+//多签交易的完整流程：build -> 各成员sign -> merge -> submit
+func TestMultisigTxRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kortho-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	node := &stubNode{nonce: 7, submitted: make(chan []byte, 1)}
+	addr, cert, stop := startStubNode(t, dir, node)
+	defer stop()
+	rpcArgs := []string{"-node", addr, "-cert", cert, "-servername", "localhost"}
+
+	members := newTestKeys(t, dir, 3)
+	path := func(name string) string { return filepath.Join(dir, name) }
+	keystoreArgs := []string{"-keystore", path("keystore"), "-passfile", path("password")}
+
+	if err := multisigNew(append([]string{"-threshold", "2", "-out", path("multisig.json")}, members...)); err != nil {
+		t.Fatal(err)
+	}
+	account, err := loadMultisig(path("multisig.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	to := types.NewWallet().Address
+	build := append([]string{"-chainid", "3", "-multisig", path("multisig.json"), "-to", to, "-amount", "600000", "-out", path("unsigned.json")}, rpcArgs...)
+	if err := txBuild(build); err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := readTx(path("unsigned.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unsigned.Nonce != node.nonce || unsigned.ChainID != 3 || unsigned.From != account.Address() {
+		t.Fatalf("built nonce %d chainid %d from %s", unsigned.Nonce, unsigned.ChainID, unsigned.From.String())
+	}
+
+	for i, member := range members[:2] {
+		sign := append([]string{"-in", path("unsigned.json"), "-out", path("signed" + strconv.Itoa(i) + ".json"), "-signer", member}, keystoreArgs...)
+		if err := txSign(sign); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := txSubmit(append([]string{"-in", path("signed0.json")}, rpcArgs...)); err == nil {
+		t.Fatal("submitted a transaction below the threshold")
+	}
+
+	if err := txMerge([]string{"-out", path("merged.json"), path("signed0.json"), path("signed1.json")}); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := readTx(path("merged.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !merged.Verify() {
+		t.Fatalf("merged transaction: %v", merged.VerifyMultiSig())
+	}
+
+	if err := txSubmit(append([]string{"-in", path("merged.json")}, rpcArgs...)); err != nil {
+		t.Fatal(err)
+	}
+	if raw := <-node.submitted; !bytes.Equal(raw, merged.Serialize()) {
+		t.Fatal("node received a different transaction")
+	}
+}
+
+//摘要字段和原始交易不一致、或者hash与内容不一致的文件都被拒绝
+func TestReadTxFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kortho-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	from, _ := types.StringToAddress(types.NewWallet().Address)
+	to, _ := types.StringToAddress(types.NewWallet().Address)
+	tx := transaction.NewTransaction(1, 600000, *from, *to, transaction.WithChainID(1))
+	file := filepath.Join(dir, "tx.json")
+	if err := writeTx(file, tx); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readTx(file); err != nil || !bytes.Equal(got.Hash, tx.Hash) {
+		t.Fatalf("round trip: %v", err)
+	}
+
+	for _, c := range []struct {
+		edit func(f *txFile)
+		want error
+	}{
+		{func(f *txFile) { f.Amount = 1 }, errTxFile},
+		{func(f *txFile) { f.To = from.String() }, errTxFile},
+		{func(f *txFile) {
+			other := *tx
+			other.Amount = 1
+			f.Raw = hex.EncodeToString(other.Serialize())
+		}, errTxHash},
+	} {
+		f := newTxFile(tx)
+		c.edit(f)
+		data, _ := json.Marshal(f)
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readTx(file); err != c.want {
+			t.Fatalf("read edited file: %v, want %v", err, c.want)
+		}
+	}
+}
+
+func TestLoadMultisig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kortho-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	members := []string{types.NewWallet().Address, types.NewWallet().Address}
+	account, err := multisigAccount(1, members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "multisig.json")
+	write := func(f *multisigFile) {
+		data, _ := json.Marshal(f)
+		if err := ioutil.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(newMultisigFile(account))
+	if loaded, err := loadMultisig(file); err != nil || loaded.Address() != account.Address() {
+		t.Fatalf("load: %v", err)
+	}
+
+	//改了阈值但没有改地址
+	f := newMultisigFile(account)
+	f.Threshold = 2
+	write(f)
+	if _, err := loadMultisig(file); err != errMultisigFile {
+		t.Fatalf("threshold mismatch: %v", err)
+	}
+}
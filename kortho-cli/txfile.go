@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"kortho/transaction"
+)
+
+const txFileVersion = 1
+
+var (
+	errTxHash = errors.New("transaction hash does not match its content")
+	errTxFile = errors.New("transaction file summary does not match the raw transaction")
+)
+
+// txFile 离线签名各步骤之间交换的交易文件，格式见doc.go
+type txFile struct {
+	Version   int    `json:"version"`
+	ChainID   uint64 `json:"chainid"`
+	Hash      string `json:"hash"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Amount    uint64 `json:"amount"`
+	Fee       uint64 `json:"fee"`
+	Nonce     uint64 `json:"nonce"`
+	Threshold uint32 `json:"threshold,omitempty"`
+	Signed    int    `json:"signed"`
+	Raw       string `json:"raw"`
+}
+
+func newTxFile(tx *transaction.Transaction) *txFile {
+	f := &txFile{
+		Version: txFileVersion,
+		ChainID: tx.ChainID,
+		Hash:    hex.EncodeToString(tx.Hash),
+		From:    tx.From.String(),
+		To:      tx.To.String(),
+		Amount:  tx.Amount,
+		Fee:     tx.Fee,
+		Nonce:   tx.Nonce,
+		Raw:     hex.EncodeToString(tx.Serialize()),
+	}
+	if tx.MultiSig != nil {
+		f.Threshold = tx.MultiSig.Threshold
+		f.Signed = tx.MultiSig.Signed(tx.Hash)
+	} else if len(tx.Signature) != 0 && tx.Verify() {
+		f.Signed = 1
+	}
+	return f
+}
+
+func writeTx(file string, tx *transaction.Transaction) error {
+	data, err := json.MarshalIndent(newTxFile(tx), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(file, data)
+}
+
+//读取交易文件，交易hash必须与内容一致，否则签名的不是文件中显示的交易
+func readTx(file string) (*transaction.Transaction, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var f txFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Version != txFileVersion {
+		return nil, fmt.Errorf("unsupported transaction file version %d", f.Version)
+	}
+	raw, err := hex.DecodeString(f.Raw)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := transaction.Deserialize(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	txCopy := tx.TrimmedCopy()
+	txCopy.HashTransaction()
+	if !bytes.Equal(txCopy.Hash, tx.Hash) {
+		return nil, errTxHash
+	}
+	g := newTxFile(tx)
+	if f.ChainID != g.ChainID || f.Hash != g.Hash || f.From != g.From || f.To != g.To ||
+		f.Amount != g.Amount || f.Fee != g.Fee || f.Nonce != g.Nonce || f.Threshold != g.Threshold {
+		return nil, errTxFile
+	}
+	return tx, nil
+}
+
+func printTx(w io.Writer, tx *transaction.Transaction) {
+	f := newTxFile(tx)
+	fmt.Fprintf(w, "hash:    %s\nchainid: %d\nfrom:    %s\nto:      %s\namount:  %d\nfee:     %d\nnonce:   %d\n",
+		f.Hash, f.ChainID, f.From, f.To, f.Amount, f.Fee, f.Nonce)
+	if tx.MultiSig != nil {
+		fmt.Fprintf(w, "signed:  %d of %d\n", f.Signed, f.Threshold)
+	} else {
+		fmt.Fprintf(w, "signed:  %v\n", f.Signed == 1)
+	}
+}
@@ -3,13 +3,20 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"kortho/api"
+	"kortho/block"
 	"kortho/blockchain"
 	"kortho/config"
+	"kortho/consensus"
 	"kortho/logger"
 	"kortho/p2p/node"
+	"kortho/transaction"
 	"kortho/txpool"
+	"kortho/types"
+	"kortho/util"
 	_ "net/http/pprof"
 
 	"go.uber.org/zap"
@@ -27,24 +34,97 @@ func main() {
 		os.Exit(-1)
 	}
 
-	tp, err := txpool.New(cfg.ConsensusConfig.QTJ)
+	types.AllowLegacyAddress = cfg.AddressConfig.LegacyAddress
+
+	bc := blockchain.New()
+	if _, err := bc.MigrateEncoding(); err != nil {
+		logger.Error("Failed to migrate storage encoding", zap.Error(err))
+		os.Exit(-1)
+	}
+	if _, err := bc.SetupGenesis(cfg.GenesisConfig); err != nil {
+		logger.Error("Failed to setup genesis", zap.Error(err))
+		os.Exit(-1)
+	}
+
+	tp, err := txpool.New(cfg.GenesisConfig.QTJAddress, cfg.TxPoolConfig)
 	if err != nil {
 		logger.Error("Failed to new txpool", zap.Error(err))
 		os.Exit(-1)
 	}
+	if err := tp.LoadJournal(bc); err != nil {
+		logger.Error("Failed to load txpool journal", zap.Error(err))
+		os.Exit(-1)
+	}
+	//链重组后被丢弃的交易放回交易池
+	bc.SetOrphanHandler(func(txs []*transaction.Transaction) {
+		for _, tx := range txs {
+			if err := tp.Add(tx, bc); err != nil {
+				logger.Info("Failed to readd orphan transaction", zap.Error(err), zap.Uint64("nonce", tx.Nonce))
+			}
+		}
+	})
 
-	bc := blockchain.New()
-
-	n, err := node.New(cfg.P2PConfig, tp, bc)
+	//验证者白名单下节点身份就是验证者私钥，其他验证者才能认出本节点
+	var opts []node.ModOption
+	if cfg.P2PConfig.AllowValidators {
+		priv := util.Decode(cfg.ConsensusConfig.PrivKey)
+		if len(priv) != 64 {
+			logger.Error("Validator allow-list requires the validator private key")
+			os.Exit(-1)
+		}
+		opts = append(opts, node.WithIdentity(priv))
+	}
+	n, err := node.New(cfg.P2PConfig, tp, bc, opts...)
 	if err != nil {
 		logger.Error("failed to new p2p node", zap.Error(err))
+		os.Exit(-1)
+	}
+
+	engine, err := consensus.New(cfg.ConsensusConfig, cfg.AddressConfig.MinerAddress, bc, tp, n)
+	if err != nil {
+		logger.Error("Failed to new consensus engine", zap.Error(err))
+		os.Exit(-1)
+	}
+	//bft链上同步的区块必须带有足够的commit签名
+	if bft, ok := engine.(*consensus.BftNode); ok {
+		n.SetBlockVerifier(bft.VerifyBlock)
+		bc.SetBlockVerifier(bft.VerifyBlock)
+		n.SetBlockHandler(func(*block.Block) { bft.NotifyNewBlock() })
+		if cfg.P2PConfig.AllowValidators {
+			n.Allow(bft.Validators()...)
+		}
+	} else {
+		if cfg.P2PConfig.AllowValidators {
+			logger.Warn("Validator allow-list requires bft consensus")
+		}
+		//raft的区块没有签名，只能信任配置的raft节点
+		if len(cfg.P2PConfig.SyncPeers) == 0 {
+			logger.Warn("Block sync disabled, set syncpeers to the identities of the raft nodes")
+		}
 	}
+
 	go n.Run()
 	for _, member := range cfg.P2PConfig.Members {
 		if err := n.Join([]string{member}); err != nil {
 			logger.Info("Failed to join p2p", zap.Error(err), zap.String("node id", member))
 		}
 	}
-	//go bftNode.NewBftNode(cfg.ConsensusConfig, bc, n, tp)
+	go engine.Run()
+
+	//退出前停止出块和p2p，交易日志写入磁盘
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		if err := engine.Stop(); err != nil {
+			logger.Error("Failed to stop consensus engine", zap.Error(err))
+		}
+		n.Stop()
+		if err := tp.Close(); err != nil {
+			logger.Error("Failed to close txpool journal", zap.Error(err))
+		}
+		os.Exit(0)
+	}()
+
 	api.Start(cfg.APIConfig, bc, tp, n)
 }
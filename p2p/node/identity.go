@@ -0,0 +1,57 @@
+package node
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"kortho/types"
+	"kortho/util"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	errNodeKey         = errors.New("invalid node key file")
+	errNodeKeyRequired = errors.New("node key file is required when peers are authorized")
+	errValidatorKey    = errors.New("validator private key is required as node identity when validators are allowed")
+)
+
+// loadNodeKey 读取base58编码的节点私钥，文件不存在时生成新的私钥
+func loadNodeKey(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		_, priv, err := types.GenKeyPair()
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(file, []byte(util.Encode(priv)), 0600); err != nil {
+			return nil, err
+		}
+		return priv, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	priv := util.Decode(strings.TrimSpace(string(data)))
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, errNodeKey
+	}
+	return priv, nil
+}
+
+// Allow 允许这些地址对应的节点连接，只在配置了AllowList或AllowValidators时生效
+func (n *node) Allow(addrs ...types.Address) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, addr := range addrs {
+		n.allowed[string(addr.ToPublicKey())] = true
+	}
+}
+
+func (n *node) authorized(pub []byte) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.allowed[string(pub)]
+}
@@ -0,0 +1,53 @@
+package node
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kortho/config"
+	"kortho/logger"
+	"kortho/types"
+)
+
+//允许验证者连接时节点身份必须由调用者传入，不能使用生成的私钥
+func TestValidatorIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "identity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger.InitLogger(&config.LogConfigInfo{Level: "INFO", FileName: filepath.Join(dir, "identity.log")})
+
+	cfg := &config.P2PConfigInfo{
+		BindPort:        freePort(t),
+		BindAddr:        "127.0.0.1",
+		AdvertiseAddr:   "127.0.0.1",
+		NodeName:        "v",
+		NodeKeyFile:     filepath.Join(dir, "nodekey"),
+		SecretKey:       "0101010101010101010101010101010101010101010101010101010101010101",
+		AllowValidators: true,
+	}
+	if _, err := New(cfg, nil, nil); err != errValidatorKey {
+		t.Fatalf("allow validators without identity: %v", err)
+	}
+	if _, err := os.Stat(cfg.NodeKeyFile); !os.IsNotExist(err) {
+		t.Fatalf("node key is generated: %v", err)
+	}
+
+	_, priv, err := types.GenKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := New(cfg, nil, nil, WithIdentity(priv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go n.Run()
+	defer n.Stop()
+	if !bytes.Equal(n.priv, priv) {
+		t.Fatal("identity is not the validator key")
+	}
+}
@@ -0,0 +1,98 @@
+package node
+
+import (
+	"errors"
+
+	"kortho/util/codec"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// ProtocolVersion 消息封装的协议版本，不同版本的节点之间不交换消息
+const ProtocolVersion uint8 = 1
+
+// 消息类型，新的类型只能追加在后面
+const (
+	MsgTx uint8 = iota + 1
+	MsgConsensus
+	MsgCheckData
+	MsgSync
+)
+
+var (
+	errMessageVersion   = errors.New("unsupported protocol version")
+	errMessageSignature = errors.New("invalid message signature")
+)
+
+// Message p2p层传输的消息封装，Sender和Signature可以为空
+type Message struct {
+	Version   uint8
+	Type      uint8
+	Payload   []byte
+	Sender    []byte
+	Signature []byte
+}
+
+// NewMessage 当前协议版本的消息
+func NewMessage(typ uint8, payload []byte) *Message {
+	return &Message{Version: ProtocolVersion, Type: typ, Payload: payload}
+}
+
+func (m *Message) Serialize() []byte {
+	w := codec.NewWriter()
+	w.WriteUint8(m.Version)
+	w.WriteUint8(m.Type)
+	w.WriteBytes(m.Payload)
+	w.WriteBytes(m.Sender)
+	w.WriteBytes(m.Signature)
+	return w.Bytes()
+}
+
+// DeserializeMessage 只检查编码和协议版本，签名由Verify检查
+func DeserializeMessage(data []byte) (*Message, error) {
+	var m Message
+	r := codec.NewReader(data)
+	if m.Version = r.ReadUint8(); r.Err() == nil && m.Version != ProtocolVersion {
+		return nil, errMessageVersion
+	}
+	m.Type = r.ReadUint8()
+	m.Payload = r.ReadBytes()
+	m.Sender = r.ReadBytes()
+	m.Signature = r.ReadBytes()
+	if err := r.Finish(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+//签名覆盖版本、类型和内容
+func (m *Message) signBytes() []byte {
+	w := codec.NewWriter()
+	w.WriteUint8(m.Version)
+	w.WriteUint8(m.Type)
+	w.WriteBytes(m.Payload)
+	return w.Bytes()
+}
+
+// Sign 使用发送者的ed25519私钥签名
+func (m *Message) Sign(priv []byte) {
+	key := ed25519.PrivateKey(priv)
+	m.Sender = []byte(key.Public().(ed25519.PublicKey))
+	m.Signature = ed25519.Sign(key, m.signBytes())
+}
+
+// Verify 没有签名的消息直接通过，有签名的必须能用Sender验证
+func (m *Message) Verify() error {
+	if len(m.Sender) == 0 && len(m.Signature) == 0 {
+		return nil
+	}
+	if len(m.Sender) != ed25519.PublicKeySize || !ed25519.Verify(m.Sender, m.signBytes(), m.Signature) {
+		return errMessageSignature
+	}
+	return nil
+}
+
+// Signed 消息是否带有发送者签名
+func (m *Message) Signed() bool {
+	return len(m.Signature) > 0
+}
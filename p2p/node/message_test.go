@@ -0,0 +1,106 @@
+package node
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kortho/config"
+	"kortho/logger"
+	"kortho/types"
+)
+
+func TestMessage(t *testing.T) {
+	_, priv, err := types.GenKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMessage(MsgTx, []byte("payload"))
+	if err := m.Verify(); err != nil {
+		t.Fatalf("unsigned message: %v", err)
+	}
+	m.Sign(priv)
+	decoded, err := DeserializeMessage(m.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Serialize(), m.Serialize()) || !decoded.Signed() {
+		t.Fatal("round trip")
+	}
+	if err := decoded.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded.Type = MsgConsensus
+	if err := decoded.Verify(); err != errMessageSignature {
+		t.Fatalf("changed type: %v", err)
+	}
+
+	old := NewMessage(MsgTx, nil)
+	old.Version = ProtocolVersion + 1
+	if _, err := DeserializeMessage(old.Serialize()); err != errMessageVersion {
+		t.Fatalf("version: %v", err)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dispatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger.InitLogger(&config.LogConfigInfo{Level: "INFO", FileName: filepath.Join(dir, "dispatch.log")})
+
+	n := &node{handlers: make(map[uint8]Handler)}
+	var got []*Message
+	n.Handle(MsgTx, func(from string, m *Message) { got = append(got, m) })
+
+	_, priv, err := types.GenKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := NewMessage(MsgTx, []byte{1})
+	signed.Sign(priv)
+	forged := NewMessage(MsgTx, []byte{2})
+	forged.Sign(priv)
+	forged.Payload = []byte{3}
+	future := NewMessage(MsgTx, nil)
+	future.Version = ProtocolVersion + 1
+
+	n.dispatch("a", NewMessage(MsgTx, []byte{0}).Serialize())
+	n.dispatch("a", signed.Serialize())
+	n.dispatch("a", forged.Serialize())
+	n.dispatch("a", future.Serialize())
+	n.dispatch("a", NewMessage(200, nil).Serialize())
+	n.dispatch("a", []byte{ProtocolVersion})
+
+	if len(got) != 2 {
+		t.Fatalf("handled %d messages, want 2", len(got))
+	}
+	if want := (DropStats{Malformed: 1, Version: 1, Signature: 1, Unknown: 1}); n.DropStats() != want {
+		t.Fatalf("drops %+v, want %+v", n.DropStats(), want)
+	}
+
+	//配置了允许列表后只接受允许的节点签名的消息
+	got = nil
+	n.allowed = make(map[string]bool)
+	pub, _, _ := types.GenKeyPair()
+	n.allowed[string(pub)] = true
+	n.dispatch("a", NewMessage(MsgTx, []byte{0}).Serialize())
+	n.dispatch("a", signed.Serialize())
+	if len(got) != 0 || n.DropStats().Unauthorized != 2 {
+		t.Fatalf("handled %d messages, drops %+v", len(got), n.DropStats())
+	}
+	addr, err := types.StringToAddress(types.PublicKeyToAddress(signed.Sender))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Allow(*addr)
+	n.dispatch("a", signed.Serialize())
+	if len(got) != 1 {
+		t.Fatal("message from allowed sender dropped")
+	}
+}
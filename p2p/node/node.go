@@ -1,86 +1,260 @@
 package node
 
 import (
-	"encoding/gob"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+
+	"kortho/block"
 	"kortho/blockchain"
 	"kortho/config"
+	"kortho/logger"
 	"kortho/p2p"
 	"kortho/transaction"
 	"kortho/txpool"
 	"kortho/types"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ed25519"
 )
 
 type Node interface {
 	Run()
 	Stop()
 	Join([]string) error
-	//Broadcast(*transaction.Transaction)
-	Broadcast(v interface{})
+	Broadcast(typ uint8, payload []byte)
+}
+
+// Handler 处理一种类型的消息，from是发送节点的名字
+type Handler func(from string, m *Message)
+
+// DropStats 各种原因丢弃的消息数量
+type DropStats struct {
+	Malformed    uint64
+	Version      uint64
+	Signature    uint64
+	Unauthorized uint64
+	Unknown      uint64
 }
 
 type node struct {
 	p    p2p.P2P
 	pool *txpool.TxPool
 	bc   *blockchain.Blockchain
+	sync *syncer
+	priv []byte
+
+	mu       sync.RWMutex
+	handlers map[uint8]Handler
+	allowed  map[string]bool //允许的节点公钥，为空时不检查
+	drops    DropStats
 }
 
-func init() {
-	gob.Register(types.Address{})
-	gob.Register(transaction.Transaction{})
+// ModOption 创建节点时的可选参数
+type ModOption func(n *node)
+
+// WithIdentity 使用这个私钥作为节点身份，不读取NodeKeyFile
+func WithIdentity(priv []byte) ModOption {
+	return func(n *node) {
+		n.priv = priv
+	}
 }
 
-func New(cfg *config.P2PConfigInfo, pool *txpool.TxPool, bc *blockchain.Blockchain) (*node, error) {
-	n := &node{pool: pool, bc: bc}
-	p, err := p2p.New(p2p.Config{cfg.BindPort, cfg.NodeName, cfg.BindAddr, cfg.AdvertiseAddr}, n, recv)
+// New AllowValidators时节点身份必须是验证者私钥，需要通过WithIdentity传入
+func New(cfg *config.P2PConfigInfo, pool *txpool.TxPool, bc *blockchain.Blockchain, opts ...ModOption) (*node, error) {
+	n := &node{pool: pool, bc: bc, sync: newSyncer(bc, pool), handlers: make(map[uint8]Handler)}
+	n.Handle(MsgTx, n.handleTx)
+	n.Handle(MsgCheckData, n.handleCheckData)
+	n.Handle(MsgSync, n.handleSync)
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	pcfg := p2p.Config{Port: cfg.BindPort, Name: cfg.NodeName, BindAddr: cfg.BindAddr, AdvertiseAddr: cfg.AdvertiseAddr}
+	if cfg.AllowValidators && n.priv == nil {
+		return nil, errValidatorKey
+	}
+	if n.priv == nil && len(cfg.NodeKeyFile) > 0 {
+		priv, err := loadNodeKey(cfg.NodeKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		n.priv = priv
+	}
+	if n.priv != nil {
+		if len(n.priv) != ed25519.PrivateKeySize {
+			return nil, errNodeKey
+		}
+		pcfg.Key = n.priv
+		logger.Info("P2P node identity", zap.String("address", types.PublicKeyToAddress(ed25519.PrivateKey(n.priv).Public().(ed25519.PublicKey))))
+	}
+	if len(cfg.SecretKey) > 0 {
+		secret, err := hex.DecodeString(cfg.SecretKey)
+		if err != nil {
+			return nil, err
+		}
+		pcfg.SecretKey = secret
+	}
+	if len(cfg.AllowList) > 0 || cfg.AllowValidators {
+		if n.priv == nil {
+			return nil, errNodeKeyRequired
+		}
+		n.allowed = make(map[string]bool)
+		for _, s := range cfg.AllowList {
+			addr, err := types.StringToAddress(s)
+			if err != nil {
+				return nil, err
+			}
+			n.Allow(*addr)
+		}
+		pcfg.Authorize = n.authorized
+	}
+	if len(cfg.SyncPeers) > 0 {
+		n.sync.trusted = make(map[string]bool)
+		for _, s := range cfg.SyncPeers {
+			addr, err := types.StringToAddress(s)
+			if err != nil {
+				return nil, err
+			}
+			n.sync.trusted[string(addr.ToPublicKey())] = true
+		}
+	}
+	p, err := p2p.New(pcfg, n, recv)
 	if err != nil {
 		return nil, err
 	}
 	n.p = p
+	n.sync.send = n.sendSync
+	n.sync.members = p.Members
 	return n, nil
 }
 
-// func (n *node) Broadcast(tx *transaction.Transaction) {
-// 	data, _ := p2p.Encode(*tx)
-// 	n.p.Broadcast(data)
-// }
-func (n *node) Broadcast(v interface{}) {
-	data, _ := p2p.Encode(v)
-	n.p.Broadcast(data)
+// Handle 注册一种消息类型的处理函数，重复注册会替换原来的处理函数
+func (n *node) Handle(typ uint8, h Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers[typ] = h
+}
+
+// SetSigner 设置后发出的消息都带有签名，需要在Run之前调用，默认使用节点身份私钥
+func (n *node) SetSigner(priv []byte) {
+	n.priv = priv
+}
+
+// DropStats 返回丢弃消息的计数
+func (n *node) DropStats() DropStats {
+	return DropStats{
+		Malformed:    atomic.LoadUint64(&n.drops.Malformed),
+		Version:      atomic.LoadUint64(&n.drops.Version),
+		Signature:    atomic.LoadUint64(&n.drops.Signature),
+		Unauthorized: atomic.LoadUint64(&n.drops.Unauthorized),
+		Unknown:      atomic.LoadUint64(&n.drops.Unknown),
+	}
+}
+
+func (n *node) newMessage(typ uint8, payload []byte) []byte {
+	m := NewMessage(typ, payload)
+	if n.priv != nil {
+		m.Sign(n.priv)
+	}
+	return m.Serialize()
+}
+
+func (n *node) Broadcast(typ uint8, payload []byte) {
+	n.p.Broadcast(n.newMessage(typ, payload))
+}
+
+// SetConsensusHandler 设置共识消息的处理函数，需要在Run之前调用
+func (n *node) SetConsensusHandler(handler func([]byte)) {
+	n.Handle(MsgConsensus, func(from string, m *Message) { handler(m.Payload) })
+}
+
+// SetBlockVerifier 设置同步区块的校验，例如bft的commit签名，需要在Run之前调用；
+// 没有校验也没有配置SyncPeers时不从其他节点同步区块
+func (n *node) SetBlockVerifier(verify func(*block.Block) error) {
+	n.sync.verify = verify
+}
+
+// SetBlockHandler 同步的区块插入主链后调用，例如通知共识引擎链的高度变化，需要在Run之前调用
+func (n *node) SetBlockHandler(handler func(*block.Block)) {
+	n.sync.inserted = handler
+}
+
+//同步消息直接发送给一个节点
+func (n *node) sendSync(peer string, m *SyncMessage) error {
+	return n.p.Send(peer, n.newMessage(MsgSync, m.Serialize()))
 }
 
 func (n *node) Run() {
+	go n.sync.run()
 	n.p.Run()
 }
 
 func (n *node) Stop() {
+	n.sync.close()
 	n.p.Stop()
 }
 
+//加入后立即交换状态，不用等到下一次定时广播
 func (n *node) Join(ns []string) error {
-	return n.p.Join(ns)
-}
-
-// func recv(u interface{}, data []byte) {
-// 	var tx transaction.Transaction
-
-// 	n := u.(*node)
-// 	if err := p2p.Decode(data, &tx); err == nil {
-// 		n.pool.Add(&tx, n.bc)
-// 	}
-// }
-
-func recv(u interface{}, data []byte) {
-	var tx transaction.Transaction
-	n := u.(*node)
-	var dt []byte
-	if err := p2p.Decode(data, &dt); err == nil {
-		if dt[0] == 'c' {
-			n.pool.SetCheckData(dt[1:])
-			return
-		}
+	if err := n.p.Join(ns); err != nil {
+		return err
+	}
+	n.sync.broadcastStatus()
+	return nil
+}
+
+func recv(u interface{}, from string, data []byte) {
+	u.(*node).dispatch(from, data)
+}
+
+//无法解析、版本不同、签名错误、发送者未被允许和未知类型的消息都丢弃并计数
+func (n *node) dispatch(from string, data []byte) {
+	m, err := DeserializeMessage(data)
+	if err == nil {
+		err = m.Verify()
+	}
+	switch err {
+	case nil:
+	case errMessageVersion:
+		atomic.AddUint64(&n.drops.Version, 1)
+	case errMessageSignature:
+		atomic.AddUint64(&n.drops.Signature, 1)
+	default:
+		atomic.AddUint64(&n.drops.Malformed, 1)
+	}
+	if err != nil {
+		logger.Debug("Drop message", zap.String("peer", from), zap.Error(err))
+		return
+	}
+	//转发的消息来自其他节点，所以检查签名者而不是发送节点
+	if n.allowed != nil && (!m.Signed() || !n.authorized(m.Sender)) {
+		atomic.AddUint64(&n.drops.Unauthorized, 1)
+		logger.Debug("Drop message from unauthorized sender", zap.String("peer", from))
+		return
 	}
 
-	if err := p2p.Decode(data, &tx); err == nil {
-		n.pool.Add(&tx, n.bc)
+	n.mu.RLock()
+	h, ok := n.handlers[m.Type]
+	n.mu.RUnlock()
+	if !ok {
+		atomic.AddUint64(&n.drops.Unknown, 1)
+		logger.Debug("Drop message of unknown type", zap.String("peer", from), zap.Uint8("type", m.Type))
+		return
 	}
+	h(from, m)
+}
+
+func (n *node) handleTx(from string, m *Message) {
+	if tx, err := transaction.Deserialize(m.Payload); err == nil {
+		n.pool.Add(tx, n.bc)
+	}
+}
+
+func (n *node) handleCheckData(from string, m *Message) {
+	n.pool.SetCheckData(m.Payload)
+}
+
+func (n *node) handleSync(from string, m *Message) {
+	n.sync.handle(from, m.Sender, m.Payload)
 }
@@ -0,0 +1,588 @@
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"kortho/block"
+	"kortho/blockchain"
+	"kortho/logger"
+	"kortho/txpool"
+
+	"go.uber.org/zap"
+)
+
+const (
+	statusInterval = 5 * time.Second
+	requestTimeout = 5 * time.Second
+	peerTimeout    = 3 * statusInterval
+
+	maxHeaders     = 192     //每次请求的区块头数量
+	maxBlocks      = 16      //每次请求的区块体数量
+	maxBlocksBytes = 8 << 20 //一次应答中区块数据的上限
+
+	minBackoff = statusInterval   //同步超时或者没有进展后第一次暂停的时间
+	maxBackoff = 16 * time.Minute //连续失败时暂停时间加倍的上限
+	banTime    = time.Hour        //返回无效数据的节点在这段时间内不再使用
+)
+
+var (
+	errSyncTimeout  = errors.New("sync request timeout")
+	errSyncStopped  = errors.New("sync stopped")
+	errSyncHeaders  = errors.New("peer returned invalid headers")
+	errSyncBlocks   = errors.New("peer returned invalid blocks")
+	errSyncProgress = errors.New("sync made no progress")
+	errSyncDisabled = errors.New("sync disabled without block verifier or trusted peers")
+)
+
+type peerStatus struct {
+	height uint64
+	head   []byte
+	seen   time.Time
+}
+
+// 同步失败的节点在until之前不会被选中
+type peerPenalty struct {
+	until    time.Time
+	failures uint
+}
+
+type syncRequest struct {
+	peer string
+	ch   chan *SyncMessage
+}
+
+// syncer 区块同步：定期和其他节点交换状态，发现更高的链后先下载区块头，
+// 校验区块头的链接关系，再从多个节点并行下载区块体，按顺序插入本地链。
+// 同步的区块必须通过verify校验或者来自trusted中的节点，两者都没有时不同步
+type syncer struct {
+	send     func(peer string, m *SyncMessage) error
+	members  func() []string
+	bc       *blockchain.Blockchain
+	pool     *txpool.TxPool
+	verify   func(*block.Block) error
+	inserted func(*block.Block) //同步的区块成为主链的块之后调用
+	trusted  map[string]bool    //只接受这些公钥签名的同步消息，为空时接受所有节点
+
+	mu        sync.Mutex
+	peers     map[string]*peerStatus
+	penalties map[string]*peerPenalty
+	pending   map[uint64]*syncRequest
+	nextID    uint64
+	syncing   bool
+	stop      chan struct{}
+}
+
+func newSyncer(bc *blockchain.Blockchain, pool *txpool.TxPool) *syncer {
+	return &syncer{
+		bc:        bc,
+		pool:      pool,
+		peers:     make(map[string]*peerStatus),
+		penalties: make(map[string]*peerPenalty),
+		pending:   make(map[uint64]*syncRequest),
+		stop:      make(chan struct{}),
+	}
+}
+
+func (s *syncer) run() {
+	if !s.enabled() {
+		logger.Warn("Block sync disabled", zap.Error(errSyncDisabled))
+	}
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.expirePeers()
+			s.broadcastStatus()
+			s.trigger()
+		}
+	}
+}
+
+func (s *syncer) close() {
+	close(s.stop)
+}
+
+// 没有校验时任何节点都能用一条更长的链让本地重组
+func (s *syncer) enabled() bool {
+	return s.verify != nil || s.trusted != nil
+}
+
+func (s *syncer) status() (*SyncMessage, error) {
+	genesis, err := s.bc.GetGenesisHash()
+	if err != nil {
+		return nil, err
+	}
+	height, err := s.bc.GetHeight()
+	if err != nil {
+		return nil, err
+	}
+	head, err := s.bc.GetHash(height)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncMessage{Type: msgStatus, Genesis: genesis, Height: height, Head: head}, nil
+}
+
+func (s *syncer) broadcastStatus() {
+	m, err := s.status()
+	if err != nil {
+		logger.Error("Failed to get sync status", zap.Error(err))
+		return
+	}
+	for _, peer := range s.members() {
+		s.send(peer, m)
+	}
+}
+
+func (s *syncer) expirePeers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for peer, st := range s.peers {
+		if time.Since(st.seen) > peerTimeout {
+			delete(s.peers, peer)
+		}
+	}
+	for peer, p := range s.penalties {
+		if time.Now().After(p.until) && s.peers[peer] == nil {
+			delete(s.penalties, peer)
+		}
+	}
+}
+
+// sender是消息的签名公钥，没有签名时为空
+func (s *syncer) handle(from string, sender []byte, data []byte) {
+	m, err := DeserializeSyncMessage(data)
+	if err != nil {
+		logger.Info("Failed to deserialize sync message", zap.Error(err), zap.String("peer", from))
+		return
+	}
+
+	switch m.Type {
+	case msgGetHeaders:
+		s.serveHeaders(from, m)
+	case msgGetBlocks:
+		s.serveBlocks(from, m)
+	case msgStatus, msgHeaders, msgBlocks:
+		//不可信的节点不能作为同步来源，但仍然可以从本节点同步
+		if s.trusted != nil && !s.trusted[string(sender)] {
+			logger.Debug("Ignore sync message from untrusted peer", zap.String("peer", from))
+			return
+		}
+		if m.Type == msgStatus {
+			s.handleStatus(from, m)
+		} else {
+			s.deliver(from, m)
+		}
+	}
+}
+
+// 创世块不同的节点不在同一条链上，忽略；第一次收到某个节点的状态时回复自己的状态
+func (s *syncer) handleStatus(from string, m *SyncMessage) {
+	local, err := s.status()
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(local.Genesis, m.Genesis) {
+		logger.Info("Ignore peer with different genesis", zap.String("peer", from),
+			zap.String("genesis", hex.EncodeToString(m.Genesis)))
+		return
+	}
+
+	s.mu.Lock()
+	_, known := s.peers[from]
+	s.peers[from] = &peerStatus{height: m.Height, head: m.Head, seen: time.Now()}
+	s.mu.Unlock()
+
+	if !known {
+		s.send(from, local)
+	}
+	if m.Height > local.Height {
+		s.trigger()
+	}
+}
+
+func (s *syncer) serveHeaders(from string, m *SyncMessage) {
+	count := uint64(m.Count)
+	if count > maxHeaders {
+		count = maxHeaders
+	}
+	resp := &SyncMessage{Type: msgHeaders, ID: m.ID}
+	for h := m.From; h < m.From+count; h++ {
+		header, err := s.bc.GetHeaderByHeight(h)
+		if err != nil {
+			break
+		}
+		resp.Headers = append(resp.Headers, header)
+	}
+	s.send(from, resp)
+}
+
+// 只返回连续找到的区块，请求方按顺序和hash校验
+func (s *syncer) serveBlocks(from string, m *SyncMessage) {
+	resp := &SyncMessage{Type: msgBlocks, ID: m.ID}
+	size := 0
+	for i, hash := range m.Hashes {
+		if i == maxBlocks {
+			break
+		}
+		b, err := s.bc.GetBlockByHash(hash)
+		if err != nil {
+			break
+		}
+		if size += len(b.Serialize()); size > maxBlocksBytes && len(resp.Blocks) > 0 {
+			break
+		}
+		resp.Blocks = append(resp.Blocks, b)
+	}
+	s.send(from, resp)
+}
+
+// 应答必须来自被请求的节点
+func (s *syncer) deliver(from string, m *SyncMessage) {
+	s.mu.Lock()
+	req, ok := s.pending[m.ID]
+	if ok && req.peer == from {
+		delete(s.pending, m.ID)
+	}
+	s.mu.Unlock()
+
+	if ok && req.peer == from {
+		req.ch <- m
+	}
+}
+
+func (s *syncer) request(peer string, m *SyncMessage) (*SyncMessage, error) {
+	req := &syncRequest{peer: peer, ch: make(chan *SyncMessage, 1)}
+	s.mu.Lock()
+	s.nextID++
+	m.ID = s.nextID
+	s.pending[m.ID] = req
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, m.ID)
+		s.mu.Unlock()
+	}()
+
+	if err := s.send(peer, m); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(requestTimeout)
+	defer timer.Stop()
+	select {
+	case resp := <-req.ch:
+		return resp, nil
+	case <-timer.C:
+		return nil, errSyncTimeout
+	case <-s.stop:
+		return nil, errSyncStopped
+	}
+}
+
+// 选择最高的节点开始同步，同一时间只有一个同步任务；失败时处罚该节点，换下一个节点继续
+func (s *syncer) trigger() {
+	if !s.enabled() {
+		return
+	}
+	height, err := s.bc.GetHeight()
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.syncing {
+		return
+	}
+	best := s.bestPeer(height)
+	if best == "" {
+		return
+	}
+	s.syncing = true
+
+	go func() {
+		err := s.synchronise(best)
+		if err != nil {
+			logger.Info("Failed to synchronise", zap.Error(err), zap.String("peer", best))
+		}
+		s.mu.Lock()
+		s.syncing = false
+		retry := s.penalise(best, err)
+		s.mu.Unlock()
+		if retry {
+			s.trigger()
+		}
+	}()
+}
+
+// 比本地高且没有被处罚的节点中最高的一个，调用时持有s.mu
+func (s *syncer) bestPeer(height uint64) string {
+	var best string
+	for peer, st := range s.peers {
+		if st.height > height && !s.penalised(peer) {
+			best, height = peer, st.height
+		}
+	}
+	return best
+}
+
+func (s *syncer) penalised(peer string) bool {
+	p, ok := s.penalties[peer]
+	return ok && time.Now().Before(p.until)
+}
+
+// penalise 返回无效数据的节点被移除并在banTime内忽略，超时或者没有进展的节点暂停一段时间，
+// 连续失败时暂停时间加倍；同步成功时清除处罚。返回true时应该换一个节点重新同步。调用时持有s.mu
+func (s *syncer) penalise(peer string, err error) bool {
+	p := s.penalties[peer]
+	switch err {
+	case nil:
+		delete(s.penalties, peer)
+		return false
+	case errSyncHeaders, errSyncBlocks:
+		delete(s.peers, peer)
+		s.penalties[peer] = &peerPenalty{until: time.Now().Add(banTime)}
+		return true
+	case errSyncTimeout, errSyncProgress:
+		if p == nil {
+			p = &peerPenalty{}
+			s.penalties[peer] = p
+		}
+		backoff := maxBackoff
+		if p.failures < 8 && minBackoff<<p.failures < maxBackoff {
+			backoff = minBackoff << p.failures
+		}
+		p.failures++
+		p.until = time.Now().Add(backoff)
+		return true
+	}
+	return false
+}
+
+func (s *syncer) peerHeight(peer string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.peers[peer]; ok {
+		return st.height
+	}
+	return 0
+}
+
+// 同步期间对方的链可能继续增长，直到追上对方最近一次报告的高度
+func (s *syncer) synchronise(peer string) error {
+	for {
+		height, err := s.bc.GetHeight()
+		if err != nil {
+			return err
+		}
+		target := s.peerHeight(peer)
+		if target <= height {
+			return nil
+		}
+
+		ancestor, err := s.findAncestor(peer, height)
+		if err != nil {
+			return err
+		}
+		logger.Info("Start synchronising", zap.String("peer", peer), zap.Uint64("height", height),
+			zap.Uint64("ancestor", ancestor), zap.Uint64("target", target))
+		if err := s.fetch(peer, ancestor, target); err != nil {
+			return err
+		}
+
+		if now, _ := s.bc.GetHeight(); now <= height {
+			return errSyncProgress
+		}
+	}
+}
+
+// 从本地最高块向下查找与对方相同的块，步长逐次加倍；创世块相同，最低到高度1
+func (s *syncer) findAncestor(peer string, height uint64) (uint64, error) {
+	if target := s.peerHeight(peer); target < height {
+		height = target
+	}
+	for step := uint64(1); height > 1; step *= 2 {
+		resp, err := s.request(peer, &SyncMessage{Type: msgGetHeaders, From: height, Count: 1})
+		if err != nil {
+			return 0, err
+		}
+		if len(resp.Headers) == 1 {
+			local, err := s.bc.GetHash(height)
+			if err == nil && bytes.Equal(local, resp.Headers[0].Hash()) {
+				return height, nil
+			}
+		}
+		if height <= step+1 {
+			height = 1
+		} else {
+			height -= step
+		}
+	}
+	return 1, nil
+}
+
+// 按批下载区块头，校验高度和prevhash的链接关系后再下载区块体
+func (s *syncer) fetch(peer string, ancestor, target uint64) error {
+	prev, err := s.bc.GetHash(ancestor)
+	if err != nil {
+		return err
+	}
+
+	for from := ancestor + 1; from <= target; {
+		count := target - from + 1
+		if count > maxHeaders {
+			count = maxHeaders
+		}
+		resp, err := s.request(peer, &SyncMessage{Type: msgGetHeaders, From: from, Count: uint32(count)})
+		if err != nil {
+			return err
+		}
+		if len(resp.Headers) == 0 || uint64(len(resp.Headers)) > count {
+			return errSyncHeaders
+		}
+
+		//本地已经有的块(例如之前收到的侧链块)不需要下载
+		var hashes [][]byte
+		var heights []uint64
+		for i, h := range resp.Headers {
+			if h.Height != from+uint64(i) || !bytes.Equal(h.PrevHash, prev) {
+				return errSyncHeaders
+			}
+			prev = h.Hash()
+			if _, err := s.bc.GetHeaderByHash(prev); err != nil {
+				hashes = append(hashes, prev)
+				heights = append(heights, h.Height)
+			}
+		}
+
+		blocks, err := s.fetchBlocks(peer, hashes, heights)
+		if err != nil {
+			return err
+		}
+		for _, b := range blocks {
+			if err := s.insert(b); err != nil {
+				return err
+			}
+		}
+		from += uint64(len(resp.Headers))
+	}
+	return nil
+}
+
+// 区块体分成多段，从高度足够的节点并行下载，失败的段再从同步的节点下载一次
+func (s *syncer) fetchBlocks(peer string, hashes [][]byte, heights []uint64) ([]*block.Block, error) {
+	type chunk struct {
+		start  int
+		blocks []*block.Block
+		err    error
+	}
+
+	var chunks []*chunk
+	for start := 0; start < len(hashes); start += maxBlocks {
+		chunks = append(chunks, &chunk{start: start})
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range chunks {
+		end := c.start + maxBlocks
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		peers := s.peersAbove(heights[end-1])
+		if len(peers) == 0 {
+			peers = []string{peer}
+		}
+		wg.Add(1)
+		go func(c *chunk, from string, end int) {
+			defer wg.Done()
+			c.blocks, c.err = s.requestBlocks(from, hashes[c.start:end])
+			if c.err != nil && from != peer {
+				c.blocks, c.err = s.requestBlocks(peer, hashes[c.start:end])
+			}
+		}(c, peers[i%len(peers)], end)
+	}
+	wg.Wait()
+
+	blocks := make([]*block.Block, 0, len(hashes))
+	for _, c := range chunks {
+		if c.err != nil {
+			return nil, c.err
+		}
+		blocks = append(blocks, c.blocks...)
+	}
+	return blocks, nil
+}
+
+// 区块头的hash必须与请求的一致，交易由区块头中的默克尔根覆盖，插入时校验
+func (s *syncer) requestBlocks(peer string, hashes [][]byte) ([]*block.Block, error) {
+	var blocks []*block.Block
+	for len(blocks) < len(hashes) {
+		resp, err := s.request(peer, &SyncMessage{Type: msgGetBlocks, Hashes: hashes[len(blocks):]})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Blocks) == 0 || len(resp.Blocks) > len(hashes)-len(blocks) {
+			return nil, errSyncBlocks
+		}
+		for _, b := range resp.Blocks {
+			hash := hashes[len(blocks)]
+			if !bytes.Equal(b.BlockHeader.Hash(), hash) || !bytes.Equal(b.Hash, hash) {
+				return nil, errSyncBlocks
+			}
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks, nil
+}
+
+func (s *syncer) peersAbove(height uint64) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var peers []string
+	for peer, st := range s.peers {
+		if st.height >= height && !s.penalised(peer) {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+func (s *syncer) insert(b *block.Block) error {
+	if s.verify != nil {
+		if err := s.verify(b); err != nil {
+			logger.Info("Failed to verify synced block", zap.Error(err), zap.Uint64("height", b.Height))
+			return errSyncBlocks
+		}
+	}
+	if err := s.bc.InsertBlock(b); err != nil {
+		logger.Info("Failed to insert synced block", zap.Error(err), zap.Uint64("height", b.Height))
+		if blockchain.IsInvalidBlock(err) {
+			return errSyncBlocks
+		}
+		return err
+	}
+	//侧链上的块没有改变账户状态，不影响交易池
+	if hash, err := s.bc.GetHash(b.Height); err != nil || !bytes.Equal(hash, b.Hash) {
+		return nil
+	}
+	if s.pool != nil {
+		if n := txpool.Evicted(s.pool.Filter(*b, s.bc)); n > 0 {
+			logger.Info("Evict transactions after synced block", zap.Uint64("height", b.Height), zap.Int("evicted", n))
+		}
+	}
+	if s.inserted != nil {
+		s.inserted(b)
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package node
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kortho/block"
+	"kortho/blockchain"
+	"kortho/config"
+	"kortho/logger"
+	"kortho/transaction"
+	"kortho/txpool"
+	"kortho/types"
+)
+
+type testChain struct {
+	bc   *blockchain.Blockchain
+	pool *txpool.TxPool
+}
+
+func newTestChain(t *testing.T, dir string, genesis *config.GenesisConfigInfo) *testChain {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	bc := blockchain.NewWithDir(dir)
+	if _, err := bc.SetupGenesis(genesis); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := txpool.New(genesis.QTJAddress, &config.TxPoolConfigInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testChain{bc: bc, pool: pool}
+}
+
+//只包含出块者coinbase交易的块，不同的出块者产生不同的分支
+func (c *testChain) mine(t *testing.T, n int, miner types.Address) {
+	for i := 0; i < n; i++ {
+		txs := []*transaction.Transaction{transaction.NewCoinBaseTransaction(miner, 5)}
+		b, err := c.bc.NewBlock(txs, miner, miner, miner, miner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.bc.AddBlock(b, miner.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (c *testChain) copyFrom(t *testing.T, other *testChain, from, to uint64) {
+	blocks, err := other.bc.GetBlockSection(to, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range blocks {
+		if err := c.bc.InsertBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (c *testChain) head(t *testing.T) (uint64, []byte) {
+	height, err := c.bc.GetHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := c.bc.GetHash(height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return height, hash
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func newTestNode(t *testing.T, name string, c *testChain) (*node, string) {
+	port := freePort(t)
+	n, err := New(&config.P2PConfigInfo{BindPort: port, BindAddr: "127.0.0.1", AdvertiseAddr: "127.0.0.1", NodeName: name}, c.pool, c.bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//测试链的区块没有签名，全部接受
+	n.SetBlockVerifier(func(*block.Block) error { return nil })
+	go n.Run()
+	return n, net.JoinHostPort("127.0.0.1", fmt.Sprint(port))
+}
+
+func miner(t *testing.T) types.Address {
+	addr, err := types.StringToAddress(types.NewWallet().Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *addr
+}
+
+// a有250个块；b有前100个块和自己的5个分叉块，同步后重组到a的链；c只有创世块
+func TestSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger.InitLogger(&config.LogConfigInfo{Level: "INFO", FileName: filepath.Join(dir, "sync.log")})
+
+	qtj := types.NewWallet().Address
+	genesis := &config.GenesisConfigInfo{ChainID: 1, Timestamp: 1600000000, QTJAddress: qtj, DSAddress: qtj, CMAddress: qtj}
+	a := newTestChain(t, filepath.Join(dir, "a"), genesis)
+	b := newTestChain(t, filepath.Join(dir, "b"), genesis)
+	c := newTestChain(t, filepath.Join(dir, "c"), genesis)
+
+	a.mine(t, 250, miner(t))
+	b.copyFrom(t, a, 2, 101)
+	b.mine(t, 5, miner(t))
+
+	na, addrA := newTestNode(t, "a", a)
+	defer na.Stop()
+	nb, _ := newTestNode(t, "b", b)
+	defer nb.Stop()
+	nc, _ := newTestNode(t, "c", c)
+	defer nc.Stop()
+	if err := nb.Join([]string{addrA}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Join([]string{addrA}); err != nil {
+		t.Fatal(err)
+	}
+
+	height, hash := a.head(t)
+	deadline := time.Now().Add(30 * time.Second)
+	for _, chain := range []*testChain{b, c} {
+		for {
+			h, head := chain.head(t)
+			if h == height && bytes.Equal(head, hash) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("synced to %d, want %d", h, height)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+//同步失败的节点被跳过，换成次高的节点；返回无效数据的节点被移除
+func TestSyncPenalty(t *testing.T) {
+	s := newSyncer(nil, nil)
+	s.peers["a"] = &peerStatus{height: 30, seen: time.Now()}
+	s.peers["b"] = &peerStatus{height: 20, seen: time.Now()}
+	s.peers["c"] = &peerStatus{height: 10, seen: time.Now()}
+
+	if best := s.bestPeer(5); best != "a" {
+		t.Fatalf("best peer %q, want a", best)
+	}
+	if !s.penalise("a", errSyncTimeout) {
+		t.Fatal("no retry after timeout")
+	}
+	if best := s.bestPeer(5); best != "b" {
+		t.Fatalf("best peer %q after timeout, want b", best)
+	}
+	first := s.penalties["a"].until
+	s.penalise("a", errSyncProgress)
+	if !s.penalties["a"].until.After(first) {
+		t.Fatal("backoff is not increased")
+	}
+
+	s.penalise("b", errSyncHeaders)
+	if _, ok := s.peers["b"]; ok {
+		t.Fatal("peer with invalid headers is not dropped")
+	}
+	if best := s.bestPeer(5); best != "c" {
+		t.Fatalf("best peer %q, want c", best)
+	}
+	if peers := s.peersAbove(10); len(peers) != 1 || peers[0] != "c" {
+		t.Fatalf("peers above %v, want c", peers)
+	}
+	//重新报告状态的节点仍然被处罚
+	s.peers["b"] = &peerStatus{height: 40, seen: time.Now()}
+	if best := s.bestPeer(5); best != "c" {
+		t.Fatalf("best peer %q, want c", best)
+	}
+
+	s.penalise("a", nil)
+	if best := s.bestPeer(5); best != "a" {
+		t.Fatalf("best peer %q after success, want a", best)
+	}
+}
+
+//没有校验时不同步；配置了可信节点时忽略其他节点的状态
+func TestSyncTrusted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger.InitLogger(&config.LogConfigInfo{Level: "INFO", FileName: filepath.Join(dir, "sync.log")})
+
+	qtj := types.NewWallet().Address
+	genesis := &config.GenesisConfigInfo{ChainID: 1, Timestamp: 1600000000, QTJAddress: qtj, DSAddress: qtj, CMAddress: qtj}
+	c := newTestChain(t, dir, genesis)
+	s := newSyncer(c.bc, c.pool)
+	s.send = func(string, *SyncMessage) error { return nil }
+	if s.enabled() {
+		t.Fatal("sync enabled without verifier or trusted peers")
+	}
+
+	status, err := s.status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status.Height = 10
+	trusted, untrusted := types.NewWallet(), types.NewWallet()
+	s.trusted = map[string]bool{string(types.AddressToPublicKey(trusted.Address)): true}
+	//只检查状态的处理，不启动同步
+	s.syncing = true
+	m := NewMessage(MsgSync, status.Serialize())
+	m.Sign(untrusted.PrivateKey)
+	s.handle("untrusted", m.Sender, m.Payload)
+	s.handle("unsigned", nil, status.Serialize())
+	if len(s.peers) != 0 {
+		t.Fatalf("accepted status from untrusted peers: %v", s.peers)
+	}
+
+	m = NewMessage(MsgSync, status.Serialize())
+	m.Sign(trusted.PrivateKey)
+	s.handle("trusted", m.Sender, m.Payload)
+	if s.peerHeight("trusted") != 10 {
+		t.Fatal("ignored status from trusted peer")
+	}
+}
+
+func TestSyncMessage(t *testing.T) {
+	header := &block.BlockHeader{Version: 1, Height: 7, PrevHash: []byte{1, 2}, Root: []byte{3}, StateRoot: []byte{4}, Timestamp: 5}
+	b := &block.Block{BlockHeader: *header}
+	b.SetHash()
+
+	for _, m := range []*SyncMessage{
+		{Type: msgStatus, Genesis: []byte{9}, Height: 7, Head: b.Hash},
+		{Type: msgGetHeaders, ID: 1, From: 3, Count: 4},
+		{Type: msgHeaders, ID: 2, Headers: []*block.BlockHeader{header, header}},
+		{Type: msgGetBlocks, ID: 3, Hashes: [][]byte{b.Hash, {1}}},
+		{Type: msgBlocks, ID: 4, Blocks: []*block.Block{b}},
+	} {
+		data := m.Serialize()
+		decoded, err := DeserializeSyncMessage(data)
+		if err != nil {
+			t.Fatalf("type %d: %v", m.Type, err)
+		}
+		if !bytes.Equal(decoded.Serialize(), data) {
+			t.Fatalf("type %d round trip", m.Type)
+		}
+	}
+
+	if _, err := DeserializeSyncMessage([]byte{99, 0, 0, 0, 0, 0, 0, 0, 0}); err != errSyncMessage {
+		t.Fatalf("unknown type: %v", err)
+	}
+	//声明的数量超过数据长度
+	bad := (&SyncMessage{Type: msgGetBlocks}).Serialize()
+	bad[len(bad)-1] = 200
+	if _, err := DeserializeSyncMessage(bad); err == nil {
+		t.Fatal("accepted truncated message")
+	}
+}
+
+//执行结果与区块不一致的块被当作无效数据；插入主链的块通知共识引擎
+func TestSyncInsert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logger.InitLogger(&config.LogConfigInfo{Level: "INFO", FileName: filepath.Join(dir, "sync.log")})
+
+	qtj := types.NewWallet().Address
+	genesis := &config.GenesisConfigInfo{ChainID: 1, Timestamp: 1600000000, QTJAddress: qtj, DSAddress: qtj, CMAddress: qtj}
+	a := newTestChain(t, filepath.Join(dir, "a"), genesis)
+	c := newTestChain(t, filepath.Join(dir, "c"), genesis)
+	a.mine(t, 1, miner(t))
+	blocks, err := a.bc.GetBlockSection(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inserted []uint64
+	s := newSyncer(c.bc, c.pool)
+	s.verify = func(*block.Block) error { return nil }
+	s.inserted = func(b *block.Block) { inserted = append(inserted, b.Height) }
+
+	bad := *blocks[0]
+	bad.StateRoot = bytes.Repeat([]byte{1}, len(bad.StateRoot))
+	bad.Hash = bad.BlockHeader.Hash()
+	if err := s.insert(&bad); err != errSyncBlocks {
+		t.Fatalf("insert block with a wrong state root: %v, want %v", err, errSyncBlocks)
+	}
+	if err := s.insert(blocks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(inserted) != 1 || inserted[0] != 2 {
+		t.Fatalf("inserted %v, want height 2", inserted)
+	}
+}
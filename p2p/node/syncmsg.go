@@ -0,0 +1,118 @@
+package node
+
+import (
+	"errors"
+
+	"kortho/block"
+	"kortho/util/codec"
+)
+
+const (
+	msgStatus uint8 = iota
+	msgGetHeaders
+	msgHeaders
+	msgGetBlocks
+	msgBlocks
+)
+
+var errSyncMessage = errors.New("unknown sync message type")
+
+// SyncMessage 同步协议的消息，不同类型使用不同的字段：
+// status带Genesis、Height和Head；getheaders带From和Count，与GetBlockSection的区间对应；
+// getblocks按hash请求区块体；headers和blocks用ID对应请求
+type SyncMessage struct {
+	Type    uint8
+	ID      uint64
+	Genesis []byte
+	Height  uint64
+	Head    []byte
+	From    uint64
+	Count   uint32
+	Hashes  [][]byte
+	Headers []*block.BlockHeader
+	Blocks  []*block.Block
+}
+
+// Serialize 同步消息的二进制编码，区块头和区块分别使用BlockHeader.Encode和Block.Serialize的编码
+func (m *SyncMessage) Serialize() []byte {
+	w := codec.NewWriter()
+	w.WriteUint8(m.Type)
+	w.WriteUint64(m.ID)
+	switch m.Type {
+	case msgStatus:
+		w.WriteBytes(m.Genesis)
+		w.WriteUint64(m.Height)
+		w.WriteBytes(m.Head)
+	case msgGetHeaders:
+		w.WriteUint64(m.From)
+		w.WriteUint32(m.Count)
+	case msgHeaders:
+		w.WriteUint32(uint32(len(m.Headers)))
+		for _, h := range m.Headers {
+			w.WriteBytes(h.Encode())
+		}
+	case msgGetBlocks:
+		w.WriteUint32(uint32(len(m.Hashes)))
+		for _, hash := range m.Hashes {
+			w.WriteBytes(hash)
+		}
+	case msgBlocks:
+		w.WriteUint32(uint32(len(m.Blocks)))
+		for _, b := range m.Blocks {
+			w.WriteBytes(b.Serialize())
+		}
+	}
+	return w.Bytes()
+}
+
+func DeserializeSyncMessage(data []byte) (*SyncMessage, error) {
+	var m SyncMessage
+	r := codec.NewReader(data)
+	m.Type = r.ReadUint8()
+	m.ID = r.ReadUint64()
+
+	var items [][]byte
+	switch m.Type {
+	case msgStatus:
+		m.Genesis = r.ReadBytes()
+		m.Height = r.ReadUint64()
+		m.Head = r.ReadBytes()
+	case msgGetHeaders:
+		m.From = r.ReadUint64()
+		m.Count = r.ReadUint32()
+	case msgHeaders, msgGetBlocks, msgBlocks:
+		//每一项至少有4字节的长度前缀
+		n := r.ReadUint32()
+		if uint64(n)*4 > uint64(r.Len()) {
+			return nil, codec.ErrLength
+		}
+		for i := uint32(0); i < n; i++ {
+			items = append(items, r.ReadBytes())
+		}
+	default:
+		return nil, errSyncMessage
+	}
+	if err := r.Finish(); err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		switch m.Type {
+		case msgHeaders:
+			h, err := block.DecodeHeader(item)
+			if err != nil {
+				return nil, err
+			}
+			m.Headers = append(m.Headers, h)
+		case msgGetBlocks:
+			m.Hashes = append(m.Hashes, item)
+		case msgBlocks:
+			b, err := block.Deserialize(item)
+			if err != nil {
+				return nil, err
+			}
+			m.Blocks = append(m.Blocks, b)
+		}
+	}
+	return &m, nil
+}
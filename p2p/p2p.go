@@ -2,17 +2,32 @@ package p2p
 
 import (
 	"bytes"
+	"container/list"
 	"encoding/binary"
 	"encoding/gob"
+	"errors"
 	"fmt"
-	"hash"
-	"hash/crc64"
-	"kortho/p2p/sum"
+	"math/rand"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/memberlist"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	fanout         = 3                //收到新消息后直接推送的节点数
+	seenTTL        = 2 * time.Minute  //已收到的消息在这段时间内不会重复处理，并可以应答请求
+	requestTimeout = 2 * time.Second  //请求的消息没有收到时，超过这个时间可以向其他节点再次请求
+	expireInterval = 10 * time.Second //清理过期消息的间隔
+	retransmitMult = 3                //通告的重发次数是retransmitMult*log(N+1)
+	maxOutstanding = 1024             //等待通告的消息数量上限，超过时丢弃最早的
+	maxSeen        = 8192             //记录的消息数量上限，超过时丢弃最早的
+	maxStateIDs    = 256              //push/pull同步状态时携带的最近消息数量，也是一次请求的消息数量上限
+	maxPeerRequest = 512              //向一个节点请求了但还没有收到的消息数量上限
 )
 
 func init() {
@@ -24,6 +39,8 @@ type P2P interface {
 	Run()
 	Stop()
 	Broadcast([]byte)
+	Send(string, []byte) error
+	Members() []string
 	Join([]string) error
 }
 
@@ -32,15 +49,36 @@ type Config struct {
 	Name          string
 	BindAddr      string
 	AdvertiseAddr string
+	Key           []byte            //节点身份的ed25519私钥，为空时不带身份
+	SecretKey     []byte            //gossip加密的AES密钥，16、24或32字节，为空时不加密
+	Authorize     func([]byte) bool //检查节点身份的公钥，为空时接受所有节点，不为空时必须设置SecretKey
 }
 
-type NotifyFunc (func(interface{}, []byte))
+// NotifyFunc 收到消息时调用，from是发送节点的名字
+type NotifyFunc (func(u interface{}, from string, data []byte))
 
+var (
+	errUnknownMember = errors.New("unknown member")
+	errIdentity      = errors.New("invalid node identity")
+	errUnauthorized  = errors.New("node is not authorized")
+	errSecretKey     = errors.New("secret key is required when nodes are authorized")
+)
+
+//不加密时任何能连接的节点都可以伪造消息头中的发送者，身份检查没有意义
 func New(config Config, u interface{}, notify NotifyFunc) (*p2p, error) {
-	p := &p2p{u: u, nf: notify}
+	if config.Authorize != nil && len(config.SecretKey) == 0 {
+		return nil, errSecretKey
+	}
+	p := &p2p{u: u, nf: notify, name: config.Name, authorize: config.Authorize, seen: make(map[msgID]*seenMsg), order: list.New(),
+		requests: make(map[string]int)}
+	//队列在有通告之前不会调用NumNodes
+	p.q = &memberlist.TransmitLimitedQueue{NumNodes: func() int { return p.ml.NumMembers() }, RetransmitMult: retransmitMult}
 	cfg := memberlist.DefaultWANConfig()
 	cfg.Events = p
 	cfg.Delegate = p
+	cfg.Alive = p
+	cfg.Merge = p
+	cfg.SecretKey = config.SecretKey
 	cfg.Name = config.Name
 	cfg.BindPort = config.Port
 	cfg.BindAddr = config.BindAddr
@@ -51,8 +89,15 @@ func New(config Config, u interface{}, notify NotifyFunc) (*p2p, error) {
 		return nil, err
 	}
 	p.ml = ml
-	p.mp = make(map[uint64][]byte)
-	p.h = crc64.New(crc64.MakeTable(crc64.ECMA))
+	p.ch = make(chan struct{})
+	//身份签名包含memberlist确定的通告地址，所以创建之后再设置并更新本节点
+	if config.Key != nil {
+		p.meta = identity(config.Key, ml.LocalNode())
+		if err := ml.UpdateNode(0); err != nil {
+			ml.Shutdown()
+			return nil, err
+		}
+	}
 	return p, nil
 }
 
@@ -61,28 +106,46 @@ func (p *p2p) Join(ids []string) error {
 	return err
 }
 
+// Broadcast 推送给随机的几个节点，并通过memberlist的gossip通告其他节点来请求
 func (p *p2p) Broadcast(data []byte) {
-	p.Lock()
-	defer p.Unlock()
-	p.mp[sum.Sum(p.h, data)] = data
+	p.gossip("", data)
+}
+
+// Send 直接发送给一个节点，不会重发，用于请求和应答
+func (p *p2p) Send(name string, data []byte) error {
+	return p.sendTo(name, "send", data)
+}
+
+func (p *p2p) sendTo(name, typ string, data []byte) error {
+	for _, n := range p.ml.Members() {
+		if n.Name == name {
+			return p.send(n, typ, data)
+		}
+	}
+	return errUnknownMember
+}
+
+// Members 除自己之外的所有节点的名字
+func (p *p2p) Members() []string {
+	var names []string
+	for _, n := range p.ml.Members() {
+		if n.Name != p.ml.LocalNode().Name {
+			names = append(names, n.Name)
+		}
+	}
+	return names
 }
 
 func (p *p2p) Run() {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-p.ch:
 			p.ch <- struct{}{}
 			return
-		case <-time.After(time.Second):
-			if ns := p.ml.Members(); len(ns) > 0 {
-				p.Lock()
-				for _, v := range p.mp {
-					for _, n := range ns {
-						p.broadcast(n, v)
-					}
-				}
-				p.Unlock()
-			}
+		case <-ticker.C:
+			p.expire()
 		}
 	}
 }
@@ -93,19 +156,180 @@ func (p *p2p) Stop() {
 	p.ml.Shutdown()
 }
 
-func (p *p2p) broadcast(n *memberlist.Node, data []byte) {
-	if n.Name == p.ml.LocalNode().Name {
+//记录新消息，已经收到过的返回false
+func (p *p2p) markSeen(id msgID, data []byte) bool {
+	p.Lock()
+	defer p.Unlock()
+	m, ok := p.seen[id]
+	if ok && m.data != nil {
+		return false
+	}
+	if !ok {
+		m = p.addSeen(id)
+	}
+	//只收到过通告的消息移到最新的位置
+	p.release(m)
+	m.data, m.expire = data, time.Now().Add(seenTTL)
+	p.order.MoveToBack(m.elem)
+	return true
+}
+
+//按收到的顺序记录，超过maxSeen时丢弃最早的，调用时持有锁
+func (p *p2p) addSeen(id msgID) *seenMsg {
+	m := &seenMsg{expire: time.Now().Add(seenTTL)}
+	m.elem = p.order.PushBack(id)
+	p.seen[id] = m
+	for len(p.seen) > maxSeen {
+		p.removeSeen(p.order.Front().Value.(msgID))
+	}
+	return m
+}
+
+func (p *p2p) removeSeen(id msgID) {
+	if m, ok := p.seen[id]; ok {
+		p.release(m)
+		p.order.Remove(m.elem)
+		delete(p.seen, id)
+	}
+}
+
+//第一次收到的消息推送给除来源之外的fanout个随机节点，并加入通告队列
+func (p *p2p) gossip(from string, data []byte) bool {
+	id := msgID(sha3.Sum256(data))
+	if !p.markSeen(id, data) {
+		return false
+	}
+	var ns []*memberlist.Node
+	for _, n := range p.ml.Members() {
+		if n.Name != from && n.Name != p.ml.LocalNode().Name {
+			ns = append(ns, n)
+		}
+	}
+	rand.Shuffle(len(ns), func(i, j int) { ns[i], ns[j] = ns[j], ns[i] })
+	if len(ns) > fanout {
+		ns = ns[:fanout]
+	}
+	for _, n := range ns {
+		p.send(n, "push", data)
+	}
+	p.q.QueueBroadcast(&announce{msg: p.announceMsg(id)})
+	p.q.Prune(maxOutstanding)
+	return true
+}
+
+//通告的格式是2字节的名字长度、本节点的名字和消息的hash
+func (p *p2p) announceMsg(id msgID) []byte {
+	name := p.ml.LocalNode().Name
+	buf := make([]byte, 2)
+	binary.LittleEndian.PutUint16(buf, uint16(len(name)))
+	buf = append([]byte("ihav"), buf...)
+	buf = append(buf, name...)
+	return append(buf, id[:]...)
+}
+
+//没有的消息向通告的节点请求，同一个消息在requestTimeout内只请求一次
+func (p *p2p) recvAnnounce(data []byte) {
+	if len(data) < 2 {
+		return
+	}
+	l := int(binary.LittleEndian.Uint16(data))
+	if len(data) != 2+l+len(msgID{}) {
+		return
+	}
+	name := string(data[2 : 2+l])
+	var id msgID
+	copy(id[:], data[2+l:])
+	p.request(name, []msgID{id})
+}
+
+//没有的消息合并成一个请求发给name，需要身份检查时只向成员请求；
+//发送失败时清除请求时间，下一次通告可以马上再请求
+func (p *p2p) request(name string, ids []msgID) {
+	if p.authorize != nil && !p.isMember(name) {
+		return
+	}
+	p.Lock()
+	ms := p.pick(name, ids)
+	p.Unlock()
+	if len(ms) == 0 {
+		return
+	}
+
+	data := make([]byte, 0, len(ms)*len(msgID{}))
+	for _, m := range ms {
+		id := m.elem.Value.(msgID)
+		data = append(data, id[:]...)
+	}
+	if err := p.sendTo(name, "iwnt", data); err != nil {
+		p.Lock()
+		for _, m := range ms {
+			p.release(m)
+			m.requested = time.Time{}
+		}
+		p.Unlock()
+	}
+}
+
+//选出需要向name请求的消息并记录请求，同一个消息在requestTimeout内只请求一次，
+//向一个节点请求了还没有收到的消息不超过maxPeerRequest，调用时持有锁
+func (p *p2p) pick(name string, ids []msgID) []*seenMsg {
+	var ms []*seenMsg
+	for _, id := range ids {
+		if len(ms) >= maxStateIDs || p.requests[name] >= maxPeerRequest {
+			break
+		}
+		m, ok := p.seen[id]
+		if ok && (m.data != nil || time.Since(m.requested) < requestTimeout) {
+			continue
+		}
+		if !ok {
+			m = p.addSeen(id)
+		}
+		//超时之后换成向name请求
+		p.release(m)
+		m.requested, m.peer = time.Now(), name
+		p.requests[name]++
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+//消息收到、被丢弃或者请求失败时不再计入请求节点的数量，调用时持有锁
+func (p *p2p) release(m *seenMsg) {
+	if m.peer == "" {
 		return
 	}
+	if p.requests[m.peer]--; p.requests[m.peer] <= 0 {
+		delete(p.requests, m.peer)
+	}
+	m.peer = ""
+}
+
+//收到消息时会移到最后并重新计算过期时间，所以从最早的开始清理
+func (p *p2p) expire() {
+	p.Lock()
+	defer p.Unlock()
+	now := time.Now()
+	for e := p.order.Front(); e != nil; e = p.order.Front() {
+		id := e.Value.(msgID)
+		if !now.After(p.seen[id].expire) {
+			break
+		}
+		p.removeSeen(id)
+	}
+}
+
+//消息头是4字节的类型和本节点的信息
+func (p *p2p) send(n *memberlist.Node, typ string, data []byte) error {
 	nd, err := Encode(*p.ml.LocalNode())
 	if err != nil {
-		return
+		return err
 	}
 	buf := make([]byte, 8)
 	binary.LittleEndian.PutUint64(buf, uint64(len(nd)))
-	buf = append([]byte("push"), buf...)
+	buf = append([]byte(typ), buf...)
 	buf = append(buf, nd...)
-	p.ml.SendReliable(n, append(buf, data...))
+	return p.ml.SendReliable(n, append(buf, data...))
 }
 
 func (p *p2p) NotifyJoin(node *memberlist.Node) { fmt.Printf("join: %s\n", node.String()) }
@@ -115,48 +339,210 @@ func (p *p2p) NotifyLeave(node *memberlist.Node) { fmt.Printf("leave: %s\n", nod
 func (p *p2p) NotifyUpdate(node *memberlist.Node) { fmt.Printf("update: %s\n", node.String()) }
 
 func (p *p2p) NodeMeta(limit int) []byte {
-	return []byte{}
+	return p.meta
+}
+
+//节点的身份是公钥和对节点名字、通告地址的签名，放在memberlist的元数据中；
+//签名绑定地址，复制到其他地址的元数据无法通过检查
+func identity(priv []byte, n *memberlist.Node) []byte {
+	key := ed25519.PrivateKey(priv)
+	return append([]byte(key.Public().(ed25519.PublicKey)), ed25519.Sign(key, identityBytes(n))...)
+}
+
+func identityBytes(n *memberlist.Node) []byte {
+	return []byte("kortho p2p identity:" + n.Name + "@" + net.JoinHostPort(n.Addr.String(), strconv.Itoa(int(n.Port))))
+}
+
+//握手时检查节点的身份签名，并且公钥必须被允许
+func (p *p2p) verifyNode(n *memberlist.Node) error {
+	if p.authorize == nil || n.Name == p.name {
+		return nil
+	}
+	if len(n.Meta) != ed25519.PublicKeySize+ed25519.SignatureSize {
+		return errIdentity
+	}
+	pub := n.Meta[:ed25519.PublicKeySize]
+	if !ed25519.Verify(pub, identityBytes(n), n.Meta[ed25519.PublicKeySize:]) {
+		return errIdentity
+	}
+	if !p.authorize(pub) {
+		return errUnauthorized
+	}
+	return nil
+}
+
+// NotifyAlive 身份检查失败的节点不会成为成员
+func (p *p2p) NotifyAlive(n *memberlist.Node) error {
+	return p.verifyNode(n)
+}
+
+// NotifyMerge 加入时对方的成员中有身份检查失败的节点就拒绝合并
+func (p *p2p) NotifyMerge(ns []*memberlist.Node) error {
+	for _, n := range ns {
+		if err := p.verifyNode(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *p2p) member(name string) *memberlist.Node {
+	for _, n := range p.ml.Members() {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+func (p *p2p) isMember(name string) bool {
+	return p.member(name) != nil
 }
 
 func (p *p2p) NotifyMsg(data []byte) {
-	switch string(data[:4]) {
-	case "push":
+	if len(data) < 4 {
+		return
+	}
+	switch typ := string(data[:4]); typ {
+	case "push", "send", "iwnt":
 		var n memberlist.Node
 
 		data = data[4:]
-		len := binary.LittleEndian.Uint64(data)
+		if len(data) < 8 {
+			return
+		}
+		l := binary.LittleEndian.Uint64(data)
 		data = data[8:]
-		if err := Decode(data[:len], &n); err == nil {
-			p.recvMsg(&n, data[len:])
+		if l > uint64(len(data)) {
+			return
 		}
-	case "pull":
-		p.Lock()
-		defer p.Unlock()
-		delete(p.mp, binary.LittleEndian.Uint64(data[4:]))
+		if err := Decode(data[:l], &n); err != nil {
+			return
+		}
+		//需要身份检查时只接受成员发来的消息，并且使用成员列表中通过检查的节点，
+		//而不是消息头中自称的地址和身份
+		if p.authorize != nil {
+			m := p.member(n.Name)
+			if m == nil || !m.Addr.Equal(n.Addr) || m.Port != n.Port {
+				return
+			}
+			n = *m
+		}
+		switch data = data[l:]; typ {
+		case "push":
+			if p.gossip(n.Name, data) {
+				p.nf(p.u, n.Name, data)
+			}
+		case "send":
+			p.nf(p.u, n.Name, data)
+		case "iwnt":
+			p.recvRequest(&n, data)
+		}
+	case "ihav":
+		p.recvAnnounce(data[4:])
 	}
 }
 
-func (p *p2p) recvMsg(n *memberlist.Node, data []byte) {
-	buf := make([]byte, 8)
-	binary.LittleEndian.PutUint64(buf, sum.Sum(p.h, data))
-	p.ml.SendReliable(n, append([]byte("pull"), buf...))
-	p.nf(p.u, data)
+//请求的消息还在缓存中时推送给请求的节点，一个请求最多包含maxStateIDs个消息
+func (p *p2p) recvRequest(n *memberlist.Node, data []byte) {
+	size := len(msgID{})
+	if len(data) == 0 || len(data)%size != 0 || len(data)/size > maxStateIDs {
+		return
+	}
+	var msgs [][]byte
+	p.Lock()
+	for ; len(data) > 0; data = data[size:] {
+		var id msgID
+		copy(id[:], data)
+		if m, ok := p.seen[id]; ok && m.data != nil {
+			msgs = append(msgs, m.data)
+		}
+	}
+	p.Unlock()
+	for _, data := range msgs {
+		p.send(n, "push", data)
+	}
+}
+
+// GetBroadcasts 通告随memberlist的gossip发送给随机节点
+func (p *p2p) GetBroadcasts(overhead, limit int) [][]byte {
+	return p.q.GetBroadcasts(overhead, limit)
+}
+
+// LocalState 本节点的名字和最近收到的消息hash，在memberlist定期push/pull时交换，
+// 对方据此请求错过的消息，格式和通告相同只是有多个hash
+func (p *p2p) LocalState(join bool) []byte {
+	name := p.ml.LocalNode().Name
+	buf := make([]byte, 2, 2+len(name)+maxStateIDs*len(msgID{}))
+	binary.LittleEndian.PutUint16(buf, uint16(len(name)))
+	buf = append(buf, name...)
+
+	p.Lock()
+	defer p.Unlock()
+	n := 0
+	for e := p.order.Back(); e != nil && n < maxStateIDs; e = e.Prev() {
+		id := e.Value.(msgID)
+		if p.seen[id].data != nil {
+			buf = append(buf, id[:]...)
+			n++
+		}
+	}
+	return buf
 }
 
-func (p *p2p) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+func (p *p2p) MergeRemoteState(data []byte, join bool) {
+	if len(data) < 2 {
+		return
+	}
+	l := int(binary.LittleEndian.Uint16(data))
+	if len(data) < 2+l || (len(data)-2-l)%len(msgID{}) != 0 {
+		return
+	}
+	name := string(data[2 : 2+l])
+	var ids []msgID
+	for data = data[2+l:]; len(data) > 0; data = data[len(msgID{}):] {
+		var id msgID
+		copy(id[:], data)
+		ids = append(ids, id)
+	}
+	p.request(name, ids)
+}
+
+type msgID [32]byte
+
+type seenMsg struct {
+	data      []byte //只收到通告时为空
+	expire    time.Time
+	requested time.Time
+	peer      string //还没有收到时请求的节点
+	elem      *list.Element
+}
+
+type announce struct {
+	msg []byte
+}
+
+func (a *announce) Invalidates(b memberlist.Broadcast) bool { return false }
+
+func (a *announce) Message() []byte { return a.msg }
 
-func (p *p2p) LocalState(join bool) []byte { return []byte{} }
+func (a *announce) Finished() {}
 
-func (p *p2p) MergeRemoteState(data []byte, join bool) {}
+func (a *announce) UniqueBroadcast() {}
 
 type p2p struct {
 	sync.Mutex
-	nf NotifyFunc
-	h  hash.Hash64
-	u  interface{}
-	ch chan struct{}
-	mp map[uint64][]byte
-	ml *memberlist.Memberlist
+	nf        NotifyFunc
+	u         interface{}
+	ch        chan struct{}
+	ml        *memberlist.Memberlist
+	q         *memberlist.TransmitLimitedQueue
+	seen      map[msgID]*seenMsg
+	order     *list.List     //seen中的消息，最早的在前面
+	requests  map[string]int //每个节点请求了但还没有收到的消息数量
+	name      string
+	meta      []byte
+	authorize func([]byte) bool
 }
 
 func Encode(v interface{}) ([]byte, error) {
@@ -0,0 +1,312 @@
+package p2p
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"kortho/types"
+)
+
+type received struct {
+	sync.Mutex
+	msgs map[string]int
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+//每个节点收到的每条消息都只通知一次
+func TestGossip(t *testing.T) {
+	const num = 8
+
+	var ps []*p2p
+	var rs []*received
+	var addrs []string
+	for i := 0; i < num; i++ {
+		r := &received{msgs: make(map[string]int)}
+		port := freePort(t)
+		p, err := New(Config{Port: port, Name: fmt.Sprintf("n%d", i), BindAddr: "127.0.0.1", AdvertiseAddr: "127.0.0.1"}, r,
+			func(u interface{}, from string, data []byte) {
+				r := u.(*received)
+				r.Lock()
+				r.msgs[string(data)]++
+				r.Unlock()
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go p.Run()
+		defer p.Stop()
+		//和之前的每个节点都交换一次状态，不依赖gossip传播新成员
+		if i > 0 {
+			if err := p.Join(addrs); err != nil {
+				t.Fatal(err)
+			}
+		}
+		addrs = append(addrs, fmt.Sprintf("127.0.0.1:%d", port))
+		ps = append(ps, p)
+		rs = append(rs, r)
+	}
+
+	//所有节点互相知道之后再广播，否则通告可能来自还不认识的节点
+	deadline := time.Now().Add(20 * time.Second)
+	for i, p := range ps {
+		for len(p.Members()) != num-1 {
+			if time.Now().After(deadline) {
+				t.Fatalf("node %d has %d members, want %d: %v", i, len(p.Members()), num-1, p.Members())
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	msgs := []string{"a", "b", "c"}
+	for i, m := range msgs {
+		ps[i].Broadcast([]byte(m))
+		ps[i].Broadcast([]byte(m))
+	}
+
+	deadline = time.Now().Add(20 * time.Second)
+	for i, r := range rs {
+		for {
+			r.Lock()
+			n := len(r.msgs)
+			r.Unlock()
+			//广播的节点自己不会收到
+			want := len(msgs)
+			if i < len(msgs) {
+				want--
+			}
+			if n == want {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("node %d received %d messages, want %d", i, n, want)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	//等待通告发完，确认没有重复通知
+	time.Sleep(2 * time.Second)
+	for i, r := range rs {
+		r.Lock()
+		for m, c := range r.msgs {
+			if c != 1 {
+				t.Fatalf("node %d received %q %d times", i, m, c)
+			}
+		}
+		r.Unlock()
+	}
+}
+
+//后加入的节点通过push/pull交换的状态请求加入之前广播的消息
+func TestMergeRemoteState(t *testing.T) {
+	a, addrA := newTestP2P(t, Config{Name: "a"}, nil)
+	defer a.Stop()
+	msgs := []string{"x", "y", "z"}
+	for _, m := range msgs {
+		a.Broadcast([]byte(m))
+	}
+	//清空通告队列，只能通过交换状态得知这些消息
+	a.q.Reset()
+
+	r := &received{msgs: make(map[string]int)}
+	b, _ := newTestP2P(t, Config{Name: "b"}, r)
+	defer b.Stop()
+	if err := b.Join([]string{addrA}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, m := range msgs {
+		for {
+			r.Lock()
+			n := r.msgs[m]
+			r.Unlock()
+			if n == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("received %q %d times, want 1", m, n)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+//一次请求的消息和向一个节点请求了还没有收到的消息都有上限
+func TestRequestLimit(t *testing.T) {
+	p := &p2p{seen: make(map[msgID]*seenMsg), order: list.New(), requests: make(map[string]int)}
+	ids := make([]msgID, maxPeerRequest+1)
+	for i := range ids {
+		binary.LittleEndian.PutUint32(ids[i][:], uint32(i))
+	}
+
+	if ms := p.pick("a", ids); len(ms) != maxStateIDs {
+		t.Fatalf("picked %d, want %d", len(ms), maxStateIDs)
+	}
+	if ms := p.pick("a", ids); len(ms) != maxPeerRequest-maxStateIDs {
+		t.Fatalf("picked %d, want %d", len(ms), maxPeerRequest-maxStateIDs)
+	}
+	if ms := p.pick("a", ids); len(ms) != 0 {
+		t.Fatalf("picked %d over the peer limit", len(ms))
+	}
+	if ms := p.pick("b", ids); len(ms) != 1 {
+		t.Fatalf("picked %d from another peer, want the unrequested one", len(ms))
+	}
+
+	//收到的消息不再计入
+	p.markSeen(ids[0], []byte{1})
+	if p.requests["a"] != maxPeerRequest-1 {
+		t.Fatalf("requests %d, want %d", p.requests["a"], maxPeerRequest-1)
+	}
+	for _, m := range p.seen {
+		m.expire = time.Now().Add(-time.Second)
+	}
+	p.expire()
+	if len(p.requests) != 0 {
+		t.Fatalf("requests %v after expire", p.requests)
+	}
+}
+
+func TestSeenLimit(t *testing.T) {
+	p := &p2p{seen: make(map[msgID]*seenMsg), order: list.New()}
+	id := func(i int) msgID {
+		var id msgID
+		binary.LittleEndian.PutUint32(id[:], uint32(i))
+		return id
+	}
+	for i := 0; i <= maxSeen; i++ {
+		p.markSeen(id(i), []byte{1})
+	}
+	if len(p.seen) != maxSeen || p.order.Len() != maxSeen {
+		t.Fatalf("seen %d, order %d, want %d", len(p.seen), p.order.Len(), maxSeen)
+	}
+	if _, ok := p.seen[id(0)]; ok {
+		t.Fatal("the oldest message is not evicted")
+	}
+	if p.markSeen(id(1), []byte{1}) {
+		t.Fatal("message is seen again")
+	}
+
+	for _, m := range p.seen {
+		m.expire = time.Now().Add(-time.Second)
+	}
+	p.expire()
+	if len(p.seen) != 0 || p.order.Len() != 0 {
+		t.Fatalf("seen %d, order %d after expire", len(p.seen), p.order.Len())
+	}
+}
+
+//r不为空时记录收到的消息
+func newTestP2P(t *testing.T, cfg Config, r *received) (*p2p, string) {
+	cfg.Port = freePort(t)
+	cfg.BindAddr, cfg.AdvertiseAddr = "127.0.0.1", "127.0.0.1"
+	p, err := New(cfg, r, func(u interface{}, from string, data []byte) {
+		if r := u.(*received); r != nil {
+			r.Lock()
+			r.msgs[string(data)]++
+			r.Unlock()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Run()
+	return p, fmt.Sprintf("127.0.0.1:%d", cfg.Port)
+}
+
+func hasMember(p *p2p, name string) bool {
+	for _, m := range p.Members() {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+//只有身份被允许并且使用相同密钥的节点可以加入
+func TestAuth(t *testing.T) {
+	pubA, privA, _ := types.GenKeyPair()
+	pubB, privB, _ := types.GenKeyPair()
+	_, privC, _ := types.GenKeyPair()
+	authorize := func(pub []byte) bool {
+		return bytes.Equal(pub, pubA) || bytes.Equal(pub, pubB)
+	}
+	secret := bytes.Repeat([]byte{1}, 32)
+
+	a, addrA := newTestP2P(t, Config{Name: "a", Key: privA, SecretKey: secret, Authorize: authorize}, nil)
+	defer a.Stop()
+	b, _ := newTestP2P(t, Config{Name: "b", Key: privB, SecretKey: secret, Authorize: authorize}, nil)
+	defer b.Stop()
+	c, _ := newTestP2P(t, Config{Name: "c", Key: privC, SecretKey: secret, Authorize: authorize}, nil)
+	defer c.Stop()
+	d, _ := newTestP2P(t, Config{Name: "d", Key: privB, SecretKey: bytes.Repeat([]byte{2}, 32), Authorize: authorize}, nil)
+	defer d.Stop()
+	e, _ := newTestP2P(t, Config{Name: "e"}, nil)
+	defer e.Stop()
+
+	if err := b.Join([]string{addrA}); err != nil {
+		t.Fatal(err)
+	}
+	c.Join([]string{addrA})
+	d.Join([]string{addrA})
+	e.Join([]string{addrA})
+
+	time.Sleep(2 * time.Second)
+	if !hasMember(a, "b") || !hasMember(b, "a") {
+		t.Fatalf("authorized node did not join: %v", a.Members())
+	}
+	for _, name := range []string{"c", "d", "e"} {
+		if hasMember(a, name) || hasMember(b, name) {
+			t.Fatalf("node %s joined: %v", name, a.Members())
+		}
+	}
+}
+
+//复制到其他地址的身份签名无法通过检查，需要身份检查时必须加密
+func TestIdentityReplay(t *testing.T) {
+	pubA, privA, _ := types.GenKeyPair()
+	pubB, privB, _ := types.GenKeyPair()
+	_, privC, _ := types.GenKeyPair()
+	authorize := func(pub []byte) bool {
+		return bytes.Equal(pub, pubA) || bytes.Equal(pub, pubB)
+	}
+	secret := bytes.Repeat([]byte{1}, 32)
+
+	if _, err := New(Config{Name: "x", Authorize: authorize}, nil, nil); err != errSecretKey {
+		t.Fatalf("authorize without secret key: %v", err)
+	}
+
+	a, addrA := newTestP2P(t, Config{Name: "a", Key: privA, SecretKey: secret, Authorize: authorize}, nil)
+	defer a.Stop()
+	b, _ := newTestP2P(t, Config{Name: "b", Key: privB, SecretKey: secret, Authorize: authorize}, nil)
+	captured := b.meta
+	b.Stop()
+
+	//使用b的名字和截获的元数据，但是地址不同
+	c, _ := newTestP2P(t, Config{Name: "b", Key: privC, SecretKey: secret, Authorize: authorize}, nil)
+	defer c.Stop()
+	c.meta = captured
+	if err := c.ml.UpdateNode(0); err != nil {
+		t.Fatal(err)
+	}
+	c.Join([]string{addrA})
+
+	time.Sleep(time.Second)
+	if hasMember(a, "b") {
+		t.Fatal("node joined with a replayed identity")
+	}
+}
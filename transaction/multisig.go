@@ -0,0 +1,173 @@
+package transaction
+
+import (
+	"bytes"
+	"errors"
+
+	"kortho/types"
+	"kortho/util/codec"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	ErrNotMultiSig     = errors.New("transaction is not from a multisig account")
+	ErrNotSigner       = errors.New("key is not a member of the multisig account")
+	ErrMultiSigAddress = errors.New("multisig keys do not match the sender address")
+	ErrThreshold       = errors.New("not enough valid multisig signatures")
+	ErrInvalidSig      = errors.New("invalid multisig signature")
+	ErrMergeMismatch   = errors.New("cannot merge signatures of different transactions")
+)
+
+// MultiSig 多签账户的交易携带账户的阈值和公钥，Signatures与PublicKeys一一对应，
+// 没有签名的位置为空。各签名者离线签名同一个交易hash，再合并到一起
+type MultiSig struct {
+	types.MultiSigAccount
+	Signatures [][]byte
+}
+
+func newMultiSig(account *types.MultiSigAccount) *MultiSig {
+	return &MultiSig{
+		MultiSigAccount: *account,
+		Signatures:      make([][]byte, len(account.PublicKeys)),
+	}
+}
+
+// SignMultiSig 用多签账户中的一个私钥签名，返回该公钥在账户中的位置
+func (tx *Transaction) SignMultiSig(privateKey []byte) (int, error) {
+	if tx.MultiSig == nil {
+		return -1, ErrNotMultiSig
+	}
+	if err := tx.MultiSig.check(); err != nil {
+		return -1, err
+	}
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return -1, ErrNotSigner
+	}
+	publicKey := ed25519.PrivateKey(privateKey).Public().(ed25519.PublicKey)
+	i := tx.MultiSig.Index(publicKey)
+	if i < 0 {
+		return -1, ErrNotSigner
+	}
+	tx.MultiSig.Signatures[i] = ed25519.Sign(ed25519.PrivateKey(privateKey), tx.Hash)
+	return i, nil
+}
+
+// MergeSignatures 把其他签名者签过的同一笔交易中的签名合并进来
+func (tx *Transaction) MergeSignatures(other *Transaction) error {
+	if tx.MultiSig == nil || other.MultiSig == nil {
+		return ErrNotMultiSig
+	}
+	if err := tx.MultiSig.check(); err != nil {
+		return err
+	}
+	if !bytes.Equal(tx.Hash, other.Hash) || tx.From != other.From ||
+		len(tx.MultiSig.Signatures) != len(other.MultiSig.Signatures) {
+		return ErrMergeMismatch
+	}
+	for i, sig := range other.MultiSig.Signatures {
+		if len(sig) == 0 || len(tx.MultiSig.Signatures[i]) != 0 {
+			continue
+		}
+		if !ed25519.Verify(tx.MultiSig.PublicKeys[i], tx.Hash, sig) {
+			return ErrInvalidSig
+		}
+		tx.MultiSig.Signatures[i] = sig
+	}
+	return nil
+}
+
+// Signed 已经有效签名的数量，账户无效时返回0
+func (m *MultiSig) Signed(hash []byte) int {
+	if m.check() != nil {
+		return 0
+	}
+	count := 0
+	for i, sig := range m.Signatures {
+		if len(sig) != 0 && ed25519.Verify(m.PublicKeys[i], hash, sig) {
+			count++
+		}
+	}
+	return count
+}
+
+//公钥的长度和数量在使用之前检查，来自网络的畸形公钥会使ed25519.Verify panic
+func (m *MultiSig) check() error {
+	if err := m.Check(); err != nil {
+		return err
+	}
+	if len(m.Signatures) != len(m.PublicKeys) {
+		return ErrThreshold
+	}
+	return nil
+}
+
+//账户必须与发送地址一致，所有签名都有效并且数量达到阈值
+func (m *MultiSig) verify(from types.Address, hash []byte) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	if m.Address() != from {
+		return ErrMultiSigAddress
+	}
+	count := 0
+	for i, sig := range m.Signatures {
+		if len(sig) == 0 {
+			continue
+		}
+		if !ed25519.Verify(m.PublicKeys[i], hash, sig) {
+			return ErrInvalidSig
+		}
+		count++
+	}
+	if count < int(m.Threshold) {
+		return ErrThreshold
+	}
+	return nil
+}
+
+// VerifyMultiSig 检查多签交易的签名，返回具体的原因
+func (tx *Transaction) VerifyMultiSig() error {
+	if tx.MultiSig == nil {
+		return ErrNotMultiSig
+	}
+	return tx.MultiSig.verify(tx.From, tx.Hash)
+}
+
+func (m *MultiSig) encode(w *codec.Writer) {
+	if m == nil {
+		w.WriteUint8(0)
+		return
+	}
+	w.WriteUint8(1)
+	w.WriteUint32(m.Threshold)
+	w.WriteUint32(uint32(len(m.PublicKeys)))
+	for i, key := range m.PublicKeys {
+		w.WriteBytes(key)
+		var sig []byte
+		if i < len(m.Signatures) {
+			sig = m.Signatures[i]
+		}
+		w.WriteBytes(sig)
+	}
+}
+
+func decodeMultiSig(r *codec.Reader) *MultiSig {
+	if r.ReadUint8() == 0 {
+		return nil
+	}
+	m := &MultiSig{}
+	m.Threshold = r.ReadUint32()
+	n := r.ReadUint32()
+	if n > types.MaxMultiSigKeys {
+		r.Fail(codec.ErrLength)
+		return nil
+	}
+	m.PublicKeys = make([][]byte, n)
+	m.Signatures = make([][]byte, n)
+	for i := range m.PublicKeys {
+		m.PublicKeys[i] = r.ReadBytes()
+		m.Signatures[i] = r.ReadBytes()
+	}
+	return m
+}
@@ -0,0 +1,161 @@
+package transaction
+
+import (
+	"strings"
+	"testing"
+
+	"kortho/types"
+)
+
+func newMultiSigTx(t *testing.T, threshold uint32, wallets []*types.Wallet) *Transaction {
+	keys := make([][]byte, len(wallets))
+	for i, w := range wallets {
+		addr, _ := types.StringToAddress(w.Address)
+		keys[i] = addr.ToPublicKey()
+	}
+	account, err := types.NewMultiSigAccount(threshold, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, _ := types.StringToAddress(types.NewWallet().Address)
+	return NewTransaction(1, 600000, account.Address(), *to, WithChainID(1), WithMultiSig(account))
+}
+
+func TestMultiSig(t *testing.T) {
+	wallets := []*types.Wallet{types.NewWallet(), types.NewWallet(), types.NewWallet()}
+	tx := newMultiSigTx(t, 2, wallets)
+
+	i, err := tx.SignMultiSig(wallets[0].PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Verify() || tx.VerifyMultiSig() != ErrThreshold {
+		t.Fatal("verified below threshold")
+	}
+	if _, err := tx.SignMultiSig(types.NewWallet().PrivateKey); err != ErrNotSigner {
+		t.Fatalf("outsider signed: %v", err)
+	}
+
+	//另一个签名者离线签名同一笔交易后合并
+	other, err := Deserialize(tx.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.MultiSig.Signatures[i] = nil
+	if _, err := other.SignMultiSig(wallets[2].PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.MergeSignatures(other); err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Verify() {
+		t.Fatalf("multisig does not verify: %v", tx.VerifyMultiSig())
+	}
+
+	decoded, err := Deserialize(tx.Serialize())
+	if err != nil || !decoded.Verify() {
+		t.Fatalf("decoded multisig transaction: %v", err)
+	}
+
+	//公钥集合或阈值与发送地址不一致
+	decoded.MultiSig.Threshold = 1
+	if decoded.VerifyMultiSig() != ErrMultiSigAddress {
+		t.Fatal("threshold change accepted")
+	}
+	tampered, _ := Deserialize(tx.Serialize())
+	tampered.MultiSig.Signatures[i][0] ^= 1
+	if tampered.VerifyMultiSig() != ErrInvalidSig {
+		t.Fatal("tampered signature accepted")
+	}
+}
+
+func TestMultiSigAccount(t *testing.T) {
+	a, b := types.NewWallet(), types.NewWallet()
+	ka, _ := types.StringToAddress(a.Address)
+	kb, _ := types.StringToAddress(b.Address)
+
+	//地址与公钥的顺序无关，与阈值有关
+	x, _ := types.NewMultiSigAccount(1, [][]byte{ka.ToPublicKey(), kb.ToPublicKey()})
+	y, _ := types.NewMultiSigAccount(1, [][]byte{kb.ToPublicKey(), ka.ToPublicKey()})
+	z, _ := types.NewMultiSigAccount(2, [][]byte{ka.ToPublicKey(), kb.ToPublicKey()})
+	if x.Address() != y.Address() || x.Address() == z.Address() {
+		t.Fatal("multisig address derivation")
+	}
+
+	for _, test := range []struct {
+		threshold uint32
+		keys      [][]byte
+	}{
+		{0, [][]byte{ka.ToPublicKey()}},
+		{2, [][]byte{ka.ToPublicKey()}},
+		{1, [][]byte{ka.ToPublicKey(), ka.ToPublicKey()}},
+		{1, [][]byte{{1, 2, 3}}},
+	} {
+		if _, err := types.NewMultiSigAccount(test.threshold, test.keys); err == nil {
+			t.Errorf("accepted threshold %d with %d keys", test.threshold, len(test.keys))
+		}
+	}
+}
+
+func TestSerializeVersion(t *testing.T) {
+	from, _ := types.StringToAddress(types.NewWallet().Address)
+	to, _ := types.StringToAddress(types.NewWallet().Address)
+	tx := NewTransaction(1, 600000, *from, *to)
+
+	//没有多签字段的交易仍然按版本2编码
+	data := tx.Serialize()
+	if data[0] != 2 {
+		t.Fatalf("encoding version %d", data[0])
+	}
+	decoded, err := Deserialize(data)
+	if err != nil || decoded.MultiSig != nil || string(decoded.Serialize()) != string(data) {
+		t.Fatalf("round trip: %v", err)
+	}
+}
+
+//来自网络的交易可能带有长度错误的公钥，不能使节点panic
+func TestMalformedMultiSigKey(t *testing.T) {
+	wallets := []*types.Wallet{types.NewWallet(), types.NewWallet()}
+	tx := newMultiSigTx(t, 1, wallets)
+	if _, err := tx.SignMultiSig(wallets[0].PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, malform := range []func(m *MultiSig){
+		func(m *MultiSig) { m.PublicKeys[0] = []byte{1, 2, 3} },
+		func(m *MultiSig) { m.PublicKeys[1] = nil },
+		func(m *MultiSig) { m.Signatures = m.Signatures[:1] },
+	} {
+		bad, err := Deserialize(tx.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		malform(bad.MultiSig)
+
+		if n := bad.MultiSig.Signed(bad.Hash); n != 0 {
+			t.Fatalf("signed %d with a malformed account", n)
+		}
+		if bad.Verify() || bad.VerifyMultiSig() == nil {
+			t.Fatal("malformed account verified")
+		}
+		if _, err := bad.SignMultiSig(wallets[1].PrivateKey); err == nil {
+			t.Fatal("signed a malformed account")
+		}
+		other, _ := Deserialize(tx.Serialize())
+		if err := bad.MergeSignatures(other); err == nil {
+			t.Fatal("merged into a malformed account")
+		}
+	}
+
+	//普通交易的发送地址无法解码成公钥
+	var from types.Address
+	copy(from[:], types.AddrPrefix+strings.Repeat("z", types.AddressSize-types.AddrPrefixSize))
+	if from.Verify() {
+		t.Fatal("malformed address verified")
+	}
+	plain := NewTransaction(1, 600000, from, tx.To, WithChainID(1))
+	plain.Sgin(wallets[0].PrivateKey)
+	if plain.Verify() {
+		t.Fatal("transaction from a malformed address verified")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"kortho/types"
+	"kortho/util/codec"
 	miscellaneous "kortho/util/mixed"
 	"time"
 
@@ -13,9 +14,24 @@ import (
 
 const Lenthaddr = 44
 
+// EncodingVersion 交易二进制编码的版本号，版本2增加了Version和ChainID字段，版本3增加了多签字段。
+// 单独编码的交易没有多签字段时仍然使用版本2，已有交易的编码和默克尔根保持不变
+const EncodingVersion = 3
+
+const multiSigEncodingVersion = 3
+
+const (
+	// LegacyVersion 旧格式，只有nonce、amount、from、to和time被签名
+	LegacyVersion uint32 = 0
+	// TxVersion 签名覆盖交易的所有字段和链ID
+	TxVersion uint32 = 1
+)
+
 type Address [Lenthaddr]byte
 
 type Transaction struct {
+	Version     uint32        `json:"version"`
+	ChainID     uint64        `json:"chainid"`
 	Nonce       uint64        `json:"nonce"`
 	BlockNumber uint64        `json:"blocknumber"`
 	Amount      uint64        `json:"amount"`
@@ -27,12 +43,15 @@ type Transaction struct {
 	Fee         uint64        `json:"fee"`
 	Root        []byte        `json:"root"`
 	Script      string        `json:"script"`
+	MultiSig    *MultiSig     `json:"multisig,omitempty"`
 }
 
 type Option struct {
-	Fee    uint64
-	Script string
-	Root   []byte
+	Fee      uint64
+	Script   string
+	Root     []byte
+	ChainID  uint64
+	MultiSig *types.MultiSigAccount
 }
 
 type ModOption func(option *Option)
@@ -45,22 +64,41 @@ func WithToken(fee uint64, script string, root []byte) ModOption {
 	}
 }
 
+func WithChainID(chainID uint64) ModOption {
+	return func(option *Option) {
+		option.ChainID = chainID
+	}
+}
+
+// WithMultiSig 从多签账户发出的交易，From必须是账户的地址
+func WithMultiSig(account *types.MultiSigAccount) ModOption {
+	return func(option *Option) {
+		option.MultiSig = account
+	}
+}
+
 func NewTransaction(nonce, amount uint64, from, to types.Address, modOptions ...ModOption) *Transaction {
-	var option *Option
+	option := &Option{}
 	for _, modOption := range modOptions {
 		modOption(option)
 	}
 
 	tx := &Transaction{
-		Nonce:  nonce,
-		Amount: amount,
-		From:   from,
-		To:     to,
-		Time:   time.Now().Unix(),
-		Fee:    option.Fee,
-		Script: option.Script,
-		Root:   option.Root,
+		Version: TxVersion,
+		ChainID: option.ChainID,
+		Nonce:   nonce,
+		Amount:  amount,
+		From:    from,
+		To:      to,
+		Time:    time.Now().Unix(),
+		Fee:     option.Fee,
+		Script:  option.Script,
+		Root:    option.Root,
+	}
+	if option.MultiSig != nil {
+		tx.MultiSig = newMultiSig(option.MultiSig)
 	}
+	tx.HashTransaction()
 
 	return tx
 }
@@ -68,11 +106,12 @@ func NewTransaction(nonce, amount uint64, from, to types.Address, modOptions ...
 func NewCoinBaseTransaction(address types.Address, amount uint64) *Transaction {
 	from := new(types.Address)
 	transaction := Transaction{
-		From:   *from,
-		To:     address,
-		Nonce:  0,
-		Amount: amount,
-		Time:   time.Now().Unix(),
+		Version: TxVersion,
+		From:    *from,
+		To:      address,
+		Nonce:   0,
+		Amount:  amount,
+		Time:    time.Now().Unix(),
 	}
 	transaction.HashTransaction()
 	return &transaction
@@ -89,14 +128,92 @@ func (tx *Transaction) IsTokenTransaction() bool {
 	return false
 }
 
+// EffectiveFee 实际支付给出块者的手续费。新格式交易的签名覆盖Fee，所有交易都按Fee支付；
+// 旧格式交易的hash不包含Fee，只有token交易按原来的规则支付
+func (tx *Transaction) EffectiveFee() uint64 {
+	if tx.Version == LegacyVersion && !tx.IsTokenTransaction() {
+		return 0
+	}
+	return tx.Fee
+}
+
+// Cost 从发送者账户扣除的金额，溢出时返回false
+func (tx *Transaction) Cost() (uint64, bool) {
+	cost := tx.Amount + tx.EffectiveFee()
+	return cost, cost >= tx.Amount
+}
+
+// Serialize 交易的规范二进制编码，用于hash、存储和网络传输
 func (tx *Transaction) Serialize() []byte {
-	txBytes, _ := json.Marshal(tx)
-	return txBytes
+	version := uint8(EncodingVersion)
+	if tx.MultiSig == nil {
+		version = 2
+	}
+	w := codec.NewWriter()
+	w.WriteUint8(version)
+	tx.Encode(w, version)
+	return w.Bytes()
 }
 
+// Encode 按固定顺序写入指定编码版本的所有字段
+func (tx *Transaction) Encode(w *codec.Writer, version uint8) {
+	w.WriteUint32(tx.Version)
+	w.WriteUint64(tx.ChainID)
+	w.WriteUint64(tx.Nonce)
+	w.WriteUint64(tx.BlockNumber)
+	w.WriteUint64(tx.Amount)
+	w.WriteFixed(tx.From[:])
+	w.WriteFixed(tx.To[:])
+	w.WriteBytes(tx.Hash)
+	w.WriteBytes(tx.Signature)
+	w.WriteInt64(tx.Time)
+	w.WriteUint64(tx.Fee)
+	w.WriteBytes(tx.Root)
+	w.WriteString(tx.Script)
+	if version >= multiSigEncodingVersion {
+		tx.MultiSig.encode(w)
+	}
+}
+
+// Decode 读取指定编码版本写入的字段
+func (tx *Transaction) Decode(r *codec.Reader, version uint8) {
+	if version >= 2 {
+		tx.Version = r.ReadUint32()
+		tx.ChainID = r.ReadUint64()
+	}
+	tx.Nonce = r.ReadUint64()
+	tx.BlockNumber = r.ReadUint64()
+	tx.Amount = r.ReadUint64()
+	r.ReadFixed(tx.From[:])
+	r.ReadFixed(tx.To[:])
+	tx.Hash = r.ReadBytes()
+	tx.Signature = r.ReadBytes()
+	tx.Time = r.ReadInt64()
+	tx.Fee = r.ReadUint64()
+	tx.Root = r.ReadBytes()
+	tx.Script = r.ReadString()
+	if version >= multiSigEncodingVersion {
+		tx.MultiSig = decodeMultiSig(r)
+	}
+}
+
+// Deserialize 解析二进制编码的交易，兼容旧版本的json数据
 func Deserialize(data []byte) (*Transaction, error) {
 	var tx Transaction
-	if err := json.Unmarshal(data, &tx); err != nil {
+	if codec.IsJSON(data) {
+		if err := json.Unmarshal(data, &tx); err != nil {
+			return nil, err
+		}
+		return &tx, nil
+	}
+
+	r := codec.NewReader(data)
+	version := r.ReadUint8()
+	if version == 0 || version > EncodingVersion {
+		return nil, codec.ErrVersion
+	}
+	tx.Decode(r, version)
+	if err := r.Finish(); err != nil {
 		return nil, err
 	}
 	return &tx, nil
@@ -112,13 +229,14 @@ func (tx *Transaction) GetNonce() int64 {
 
 func Newtoken(nonce, amount, fee uint64, from, to types.Address, script string) *Transaction {
 	tx := &Transaction{
-		Nonce:  nonce,
-		Amount: amount,
-		From:   from,
-		To:     to,
-		Time:   time.Now().Unix(),
-		Fee:    fee,
-		Script: script,
+		Version: TxVersion,
+		Nonce:   nonce,
+		Amount:  amount,
+		From:    from,
+		To:      to,
+		Time:    time.Now().Unix(),
+		Fee:     fee,
+		Script:  script,
 	}
 	tx.HashTransaction()
 
@@ -126,23 +244,51 @@ func Newtoken(nonce, amount, fee uint64, from, to types.Address, script string)
 }
 
 func (tx *Transaction) HashTransaction() {
-	fromBytes := tx.From[:]
-	toBytes := tx.To[:]
-	nonceBytes := miscellaneous.E64func(tx.Nonce)
-	amountBytes := miscellaneous.E64func(tx.Amount)
-	timeBytes := miscellaneous.E64func(uint64(tx.Time))
-	txBytes := bytes.Join([][]byte{nonceBytes, amountBytes, fromBytes, toBytes, timeBytes}, []byte{})
-	hash := sha3.Sum256(txBytes)
+	if tx.Version == LegacyVersion {
+		fromBytes := tx.From[:]
+		toBytes := tx.To[:]
+		nonceBytes := miscellaneous.E64func(tx.Nonce)
+		amountBytes := miscellaneous.E64func(tx.Amount)
+		timeBytes := miscellaneous.E64func(uint64(tx.Time))
+		txBytes := bytes.Join([][]byte{nonceBytes, amountBytes, fromBytes, toBytes, timeBytes}, []byte{})
+		hash := sha3.Sum256(txBytes)
+		tx.Hash = hash[:]
+		return
+	}
+
+	hash := sha3.Sum256(tx.SigningPayload())
 	tx.Hash = hash[:]
 }
 
+// SigningPayload 新格式交易被签名的内容，BlockNumber在打包时才确定，不参与签名
+func (tx *Transaction) SigningPayload() []byte {
+	w := codec.NewWriter()
+	w.WriteUint32(tx.Version)
+	w.WriteUint64(tx.ChainID)
+	w.WriteUint64(tx.Nonce)
+	w.WriteUint64(tx.Amount)
+	w.WriteFixed(tx.From[:])
+	w.WriteFixed(tx.To[:])
+	w.WriteInt64(tx.Time)
+	w.WriteUint64(tx.Fee)
+	w.WriteBytes(tx.Root)
+	w.WriteString(tx.Script)
+	return w.Bytes()
+}
+
+// TrimmedCopy 去掉hash、签名和块号的拷贝
 func (tx *Transaction) TrimmedCopy() *Transaction {
 	txCopy := &Transaction{
-		Nonce:  tx.Nonce,
-		Amount: tx.Amount,
-		From:   tx.From,
-		To:     tx.To,
-		Time:   tx.Time,
+		Version: tx.Version,
+		ChainID: tx.ChainID,
+		Nonce:   tx.Nonce,
+		Amount:  tx.Amount,
+		From:    tx.From,
+		To:      tx.To,
+		Time:    tx.Time,
+		Fee:     tx.Fee,
+		Root:    tx.Root,
+		Script:  tx.Script,
 	}
 	return txCopy
 }
@@ -155,7 +301,17 @@ func (tx *Transaction) Sgin(privateKey []byte) {
 func (tx *Transaction) Verify() bool {
 	txCopy := tx.TrimmedCopy()
 	txCopy.HashTransaction()
+	//交易hash用作存储的key，必须与签名内容一致
+	if !bytes.Equal(txCopy.Hash, tx.Hash) {
+		return false
+	}
+	if tx.MultiSig != nil {
+		return tx.MultiSig.verify(tx.From, txCopy.Hash) == nil
+	}
 	publicKey := tx.From.ToPublicKey()
+	if len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
 	return ed25519.Verify(publicKey, txCopy.Hash, tx.Signature)
 }
 
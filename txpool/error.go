@@ -2,8 +2,23 @@ package txpool
 
 import "errors"
 
+// 交易被拒绝的原因，调用者可以据此返回具体的错误码
 var (
-	errtx         = errors.New("tx is error")
-	errtomuch     = errors.New("recv tx to much,so refused")
-	errtxoutrange = errors.New("txpoll tx out of range,so refused")
+	ErrTxVersion   = errors.New("unsupported transaction version")
+	ErrChainID     = errors.New("transaction chain id mismatch")
+	ErrLegacyTx    = errors.New("legacy transaction without chain id is not accepted")
+	ErrAddress     = errors.New("invalid address")
+	ErrSignature   = errors.New("invalid signature")
+	ErrMultiSig    = errors.New("multisig signatures are invalid or below the threshold")
+	ErrAmount      = errors.New("amount is too small")
+	ErrBalance     = errors.New("insufficient balance")
+	ErrFee         = errors.New("fee is too low")
+	ErrNonceTooLow = errors.New("nonce too low")
+	ErrKnownTx     = errors.New("transaction already known")
+
+	ErrAccountLimit = errors.New("recv tx to much,so refused")
+	ErrPoolFull     = errors.New("txpoll tx out of range,so refused")
+	ErrNonceGap     = errors.New("transaction nonce is too far ahead")
+	ErrQueueFull    = errors.New("too many queued transactions from the account")
+	ErrUnderpriced  = errors.New("replacement transaction underpriced")
 )
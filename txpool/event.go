@@ -0,0 +1,126 @@
+package txpool
+
+import (
+	"sync"
+
+	"kortho/transaction"
+	"kortho/types"
+)
+
+const (
+	EventAdded    = "added"
+	EventReplaced = "replaced"
+	EventEvicted  = "evicted"
+	EventIncluded = "included"
+)
+
+const (
+	//订阅者缓存的事件数，处理不及时的订阅者会丢失事件
+	eventBufferSize = 256
+	//保留最近的事件，供长轮询按序号读取
+	eventHistorySize = 1024
+)
+
+// TxEvent 交易池中交易状态的变化
+type TxEvent struct {
+	Seq         uint64
+	Type        string
+	Hash        []byte
+	From        types.Address
+	Nonce       uint64
+	Reason      string //evicted的原因
+	Height      uint64 //included所在的区块高度
+	Replacement []byte //replaced时替换它的交易哈希
+}
+
+func newTxEvent(typ string, tx *transaction.Transaction) TxEvent {
+	return TxEvent{Type: typ, Hash: tx.Hash, From: tx.From, Nonce: tx.Nonce}
+}
+
+// Subscription 通过C接收事件，不再需要时调用Unsubscribe
+type Subscription struct {
+	C    <-chan TxEvent
+	ch   chan TxEvent
+	feed *txFeed
+	once sync.Once
+}
+
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.feed.mu.Lock()
+		delete(s.feed.subs, s)
+		s.feed.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+type txFeed struct {
+	mu      sync.Mutex
+	seq     uint64
+	history []TxEvent
+	subs    map[*Subscription]struct{}
+	notify  chan struct{} //有新事件时关闭并重新创建
+}
+
+func newTxFeed() *txFeed {
+	return &txFeed{
+		subs:   make(map[*Subscription]struct{}),
+		notify: make(chan struct{}),
+	}
+}
+
+//发送时不阻塞，调用者可能持有交易池的锁
+func (f *txFeed) send(ev TxEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	ev.Seq = f.seq
+	if len(f.history) >= eventHistorySize {
+		f.history = append(f.history[:0], f.history[1:]...)
+	}
+	f.history = append(f.history, ev)
+
+	for sub := range f.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+func (f *txFeed) subscribe() *Subscription {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan TxEvent, eventBufferSize)
+	sub := &Subscription{C: ch, ch: ch, feed: f}
+	f.subs[sub] = struct{}{}
+	return sub
+}
+
+//序号大于seq的事件，没有新事件时可以等待返回的通道关闭
+func (f *txFeed) since(seq uint64) ([]TxEvent, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var evs []TxEvent
+	for _, ev := range f.history {
+		if ev.Seq > seq {
+			evs = append(evs, ev)
+		}
+	}
+	return evs, f.notify
+}
+
+// SubscribeEvents 订阅交易池事件
+func (pool *TxPool) SubscribeEvents() *Subscription {
+	return pool.feed.subscribe()
+}
+
+// EventsSince 返回序号大于seq的最近事件，以及有新事件时会关闭的通道，用于长轮询
+func (pool *TxPool) EventsSince(seq uint64) ([]TxEvent, <-chan struct{}) {
+	return pool.feed.since(seq)
+}
@@ -0,0 +1,172 @@
+package txpool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"kortho/transaction"
+	"kortho/util/codec"
+)
+
+var errNoActiveJournal = errors.New("no active journal")
+
+// journal 交易池接受的交易追加写入文件，重启时重新加入交易池。
+// 每条记录是4字节大端序长度加上交易的二进制编码
+type journal struct {
+	path   string
+	writer *os.File
+}
+
+func newJournal(path string) *journal {
+	return &journal{path: path}
+}
+
+// 读取日志中的交易，依次交给add处理，返回读取和加入失败的数量
+func (j *journal) load(add func(*transaction.Transaction) error) (total, dropped int, err error) {
+	file, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			//文件末尾可能有写了一半的记录
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return total, dropped, nil
+			}
+			return total, dropped, err
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n > codec.MaxLength {
+			return total, dropped, codec.ErrLength
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return total, dropped, nil
+			}
+			return total, dropped, err
+		}
+
+		total++
+		tx, err := transaction.Deserialize(data)
+		if err != nil {
+			dropped++
+			continue
+		}
+		if err := add(tx); err != nil {
+			dropped++
+		}
+	}
+}
+
+func (j *journal) insert(tx *transaction.Transaction) error {
+	if j.writer == nil {
+		return errNoActiveJournal
+	}
+	_, err := j.writer.Write(encodeRecord(tx))
+	return err
+}
+
+// rotate 用交易池当前的交易重写日志，已经上链或被淘汰的交易不再保留。
+// 新日志写入磁盘后才替换旧日志，失败时继续追加到旧日志
+func (j *journal) rotate(txs []*transaction.Transaction) error {
+	tmp := j.path + ".new"
+	if err := writeJournal(tmp, txs); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	//新日志已经包含交易池中的所有交易，旧日志关闭失败不影响替换
+	closeErr := j.close()
+	if err := os.Rename(tmp, j.path); err != nil {
+		os.Remove(tmp)
+		if openErr := j.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	syncErr := syncDir(filepath.Dir(j.path))
+	if err := j.open(); err != nil {
+		return err
+	}
+	if syncErr != nil {
+		return syncErr
+	}
+	return closeErr
+}
+
+func (j *journal) open() error {
+	writer, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	j.writer = writer
+	return nil
+}
+
+// 关闭之前把追加的记录写入磁盘
+func (j *journal) close() error {
+	if j.writer == nil {
+		return nil
+	}
+	err := j.writer.Sync()
+	if closeErr := j.writer.Close(); err == nil {
+		err = closeErr
+	}
+	j.writer = nil
+	return err
+}
+
+func writeJournal(path string, txs []*transaction.Transaction) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, tx := range txs {
+		if _, err := w.Write(encodeRecord(tx)); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+//重命名之后同步目录，保证新日志的目录项写入磁盘
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func encodeRecord(tx *transaction.Transaction) []byte {
+	data := tx.Serialize()
+	record := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	return append(record, data...)
+}
@@ -2,18 +2,18 @@ package txpool
 
 import (
 	"kortho/transaction"
-	"kortho/types"
 )
 
+// TxHeap 按实际支付的手续费从高到低排序，同一发送者按nonce排序，其余先到先得
 type TxHeap []*transaction.Transaction
 
 func (h TxHeap) Len() int { return len(h) }
 
 func (h TxHeap) Less(i, j int) bool {
+	if fi, fj := h[i].EffectiveFee(), h[j].EffectiveFee(); fi != fj {
+		return fi > fj
+	}
 	if h[i].From == h[j].From {
-		if h[i].GetNonce() == h[j].GetNonce() {
-			return h[i].GetTime() < h[j].GetTime()
-		}
 		return h[i].GetNonce() < h[j].GetNonce()
 	}
 
@@ -42,19 +42,3 @@ func (h *TxHeap) Get(i int) interface{} {
 	x := old[n-i]
 	return x
 }
-
-func (h *TxHeap) check(fromAddr types.Address, nonce uint64) bool {
-	var count = 0
-	for _, tx := range *h {
-		if fromAddr == tx.From {
-			if nonce == tx.Nonce {
-				return false
-			}
-			count++
-		}
-	}
-	if count >= 50 {
-		return false
-	}
-	return true
-}
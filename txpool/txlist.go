@@ -0,0 +1,60 @@
+package txpool
+
+import (
+	"sort"
+	"time"
+
+	"kortho/transaction"
+)
+
+type txItem struct {
+	tx    *transaction.Transaction
+	added time.Time
+}
+
+// txList 同一发送者的交易，按nonce索引
+type txList struct {
+	items map[uint64]*txItem
+}
+
+func newTxList() *txList {
+	return &txList{items: make(map[uint64]*txItem)}
+}
+
+func (l *txList) len() int {
+	return len(l.items)
+}
+
+func (l *txList) get(nonce uint64) *transaction.Transaction {
+	if item, ok := l.items[nonce]; ok {
+		return item.tx
+	}
+	return nil
+}
+
+func (l *txList) put(tx *transaction.Transaction, added time.Time) {
+	l.items[tx.Nonce] = &txItem{tx, added}
+}
+
+func (l *txList) remove(nonce uint64) {
+	delete(l.items, nonce)
+}
+
+// 按nonce从小到大排序
+func (l *txList) sorted() []*txItem {
+	items := make([]*txItem, 0, len(l.items))
+	for _, item := range l.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].tx.Nonce < items[j].tx.Nonce })
+	return items
+}
+
+func (l *txList) txs() []*transaction.Transaction {
+	items := l.sorted()
+	txs := make([]*transaction.Transaction, len(items))
+	for i, item := range items {
+		txs[i] = item.tx
+	}
+	return txs
+}
@@ -1,12 +1,14 @@
 package txpool
 
 import (
+	"bytes"
 	"container/heap"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"kortho/block"
 	"kortho/blockchain"
+	"kortho/config"
 	"kortho/logger"
 	"kortho/transaction"
 	"kortho/types"
@@ -17,14 +19,43 @@ import (
 	"go.uber.org/zap"
 )
 
-const ReadyTotalQuantity = 500
+const (
+	ReadyTotalQuantity = 500
+	//交易池容量
+	MaxPoolSize = 1500
+	//每个发送者在交易池中的最大交易数
+	MaxAccountTxs = 50
+	//替换相同nonce的交易需要提高的手续费百分比
+	PriceBump = 10
+
+	//以下是配置为0时的默认值
+	DefaultMaxNonceGap  = 16
+	DefaultAccountQueue = 16
+	DefaultLifetime     = 3 * 60 * 60
+	DefaultRejournal    = 60 * 60
+)
 
 var QTJPubKey []byte
 
+// TxPool 每个发送者的交易分为两部分：pending是从链上nonce开始连续、可以打包的交易，
+// queued是nonce不连续的交易，缺少的nonce补上后提升到pending
 type TxPool struct {
 	Mutx sync.RWMutex
-	List *TxHeap
 	Idhc map[string]CheckBlock
+
+	maxNonceGap  uint64
+	accountQueue int
+	lifetime     time.Duration
+
+	pending map[types.Address]*txList
+	queue   map[types.Address]*txList
+	nonces  map[types.Address]uint64 //pending中第一笔交易的nonce，即链上的nonce
+	count   int
+
+	journal   *journal
+	rejournal time.Duration
+	quit      chan struct{}
+	feed      *txFeed
 }
 type stateInfo struct {
 	nonce   uint64
@@ -52,9 +83,35 @@ func (pool *TxPool) SetCheckData(data []byte) error {
 	return err
 }
 
-func New(address string) (*TxPool, error) {
-	pool := &TxPool{List: new(TxHeap)}
-	heap.Init(pool.List)
+func New(address string, cfg *config.TxPoolConfigInfo) (*TxPool, error) {
+	pool := &TxPool{
+		maxNonceGap:  DefaultMaxNonceGap,
+		accountQueue: DefaultAccountQueue,
+		lifetime:     DefaultLifetime * time.Second,
+		rejournal:    DefaultRejournal * time.Second,
+		pending:      make(map[types.Address]*txList),
+		queue:        make(map[types.Address]*txList),
+		nonces:       make(map[types.Address]uint64),
+		quit:         make(chan struct{}),
+		feed:         newTxFeed(),
+	}
+	if cfg != nil {
+		if cfg.MaxNonceGap > 0 {
+			pool.maxNonceGap = cfg.MaxNonceGap
+		}
+		if cfg.AccountQueue > 0 {
+			pool.accountQueue = cfg.AccountQueue
+		}
+		if cfg.Lifetime > 0 {
+			pool.lifetime = time.Duration(cfg.Lifetime) * time.Second
+		}
+		if cfg.Rejournal > 0 {
+			pool.rejournal = time.Duration(cfg.Rejournal) * time.Second
+		}
+		if cfg.Journal != "" {
+			pool.journal = newJournal(cfg.Journal)
+		}
+	}
 
 	//TODO:判断Address是否符合条件
 	addr, err := types.StringToAddress(address)
@@ -70,112 +127,483 @@ func (pool *TxPool) Add(tx *transaction.Transaction, bc blockchain.Blockchains)
 	pool.Mutx.Lock()
 	defer pool.Mutx.Unlock()
 
-	if pool.List.Len() > 1500 {
-		return errtxoutrange
+	if err := pool.add(tx, bc); err != nil {
+		return err
 	}
+	pool.journalTx(tx)
+	return nil
+}
+
+func (pool *TxPool) add(tx *transaction.Transaction, bc blockchain.Blockchains) error {
+	now := time.Now()
+	pool.expire(now)
 
-	if !verify(*tx, bc) {
-		return errtx
+	if err := verify(*tx, bc); err != nil {
+		return err
 	}
 
-	if !pool.List.check(tx.From, tx.Nonce) {
-		return errtomuch
+	nonce, _ := bc.GetNonce(tx.From.Bytes())
+	pool.dropStale(pool.reorganize(tx.From, nonce), bc)
+
+	//相同nonce的交易手续费足够高时替换旧交易
+	if old := pool.get(tx.From, tx.Nonce); old != nil {
+		if bytes.Equal(old.Hash, tx.Hash) {
+			return ErrKnownTx
+		}
+		if !replaceable(old, tx) {
+			return ErrUnderpriced
+		}
+		pool.remove(old)
+		pool.put(tx, now, nonce)
+		ev := newTxEvent(EventReplaced, old)
+		ev.Replacement = tx.Hash
+		pool.feed.send(ev)
+		pool.feed.send(newTxEvent(EventAdded, tx))
+		logger.Info("replace transaction", zap.String("from", tx.From.String()), zap.Uint64("nonce", tx.Nonce),
+			zap.Uint64("old fee", old.Fee), zap.Uint64("fee", tx.Fee))
+		return nil
+	}
+
+	pending, queued := pool.size(tx.From)
+	if pending+queued >= MaxAccountTxs {
+		return ErrAccountLimit
+	}
+	if next := nonce + uint64(pending); tx.Nonce > next {
+		if tx.Nonce-next > pool.maxNonceGap {
+			return ErrNonceGap
+		}
+		if queued >= pool.accountQueue {
+			return ErrQueueFull
+		}
 	}
 
-	heap.Push(pool.List, tx)
+	//交易池满时淘汰手续费最低的交易
+	if pool.count >= MaxPoolSize {
+		evicted := pool.lowest()
+		if evicted == nil || evicted.EffectiveFee() >= tx.EffectiveFee() {
+			return ErrPoolFull
+		}
+		pool.remove(evicted)
+		pool.reorganize(evicted.From, pool.nonces[evicted.From])
+		logger.Info("evict transaction", zap.String("from", evicted.From.String()),
+			zap.Uint64("nonce", evicted.Nonce), zap.Uint64("fee", evicted.Fee))
+		ev := newTxEvent(EventEvicted, evicted)
+		ev.Reason = ReasonPoolFull
+		pool.feed.send(ev)
+	}
+
+	pool.put(tx, now, nonce)
+	pool.feed.send(newTxEvent(EventAdded, tx))
+	return nil
+}
+
+// LoadJournal 把日志中的交易重新加入交易池，然后重写日志并定期压缩，
+// 需要在区块链初始化之后调用
+func (pool *TxPool) LoadJournal(bc blockchain.Blockchains) error {
+	if pool.journal == nil {
+		return nil
+	}
+
+	pool.Mutx.Lock()
+	defer pool.Mutx.Unlock()
+
+	//已经上链或者不再有效的交易不能通过验证
+	total, dropped, err := pool.journal.load(func(tx *transaction.Transaction) error {
+		return pool.add(tx, bc)
+	})
+	if err != nil {
+		logger.Error("failed to load transaction journal", zap.Error(err), zap.String("path", pool.journal.path))
+	}
+	logger.Info("loaded transaction journal", zap.Int("transactions", total), zap.Int("dropped", dropped))
+
+	if err := pool.journal.rotate(pool.all()); err != nil {
+		return err
+	}
+	go pool.loop()
 	return nil
+}
+
+// Close 停止重写日志，把日志写入磁盘后关闭，节点退出时调用
+func (pool *TxPool) Close() error {
+	pool.Mutx.Lock()
+	defer pool.Mutx.Unlock()
+
+	if pool.journal == nil {
+		return nil
+	}
+	close(pool.quit)
+	err := pool.journal.close()
+	pool.journal = nil
+	return err
+}
+
+//定期用交易池中的交易重写日志，丢弃已经上链和被移除的交易，
+//上一次重写失败导致日志不可用时也在这里恢复
+func (pool *TxPool) loop() {
+	ticker := time.NewTicker(pool.rejournal)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pool.quit:
+			return
+		case <-ticker.C:
+		}
+		pool.Mutx.Lock()
+		if pool.journal != nil {
+			if err := pool.journal.rotate(pool.all()); err != nil {
+				logger.Error("failed to rotate transaction journal", zap.Error(err), zap.String("path", pool.journal.path),
+					zap.Bool("active", pool.journal.writer != nil))
+			}
+		}
+		pool.Mutx.Unlock()
+	}
+}
 
+//日志不可用时交易只保存在内存中，重启后会丢失
+func (pool *TxPool) journalTx(tx *transaction.Transaction) {
+	if pool.journal == nil {
+		return
+	}
+	if err := pool.journal.insert(tx); err != nil {
+		logger.Error("failed to journal transaction", zap.Error(err), zap.String("from", tx.From.String()),
+			zap.Uint64("nonce", tx.Nonce))
+	}
 }
 
+//新交易实际支付的手续费至少比旧交易高PriceBump百分比
+func replaceable(old, tx *transaction.Transaction) bool {
+	oldFee, fee := old.EffectiveFee(), tx.EffectiveFee()
+	if fee <= oldFee {
+		return false
+	}
+	bump := oldFee/100*PriceBump + oldFee%100*PriceBump/100
+	return fee-oldFee >= bump
+}
+
+// Pending 选出可以打包的交易，交易仍然留在交易池中，区块提交后由Filter移除
 func (pool *TxPool) Pending(Bc blockchain.Blockchains) (readyTxs []*transaction.Transaction) {
 	pool.Mutx.Lock()
 	defer pool.Mutx.Unlock()
-	var noReadyTxs []*transaction.Transaction
-	var AddrStateMap = make(map[string]stateInfo)
 
-	for pool.List.Len() != 0 && len(readyTxs) < ReadyTotalQuantity {
-		var balance, nonce uint64
-		tx := heap.Pop(pool.List).(*transaction.Transaction)
+	pool.expire(time.Now())
 
-		if state, ok := AddrStateMap[tx.From.String()]; !ok {
-			balance, _ = Bc.GetBalance(tx.From.Bytes())
-			nonce, _ = Bc.GetNonce(tx.From.Bytes())
-		} else {
-			nonce, balance = state.balance, state.nonce
+	accounts := make(map[types.Address][]*transaction.Transaction, len(pool.pending))
+	states := make(map[types.Address]*stateInfo, len(pool.pending))
+	heads := new(TxHeap)
+	for from := range pool.pending {
+		nonce, _ := Bc.GetNonce(from.Bytes())
+		balance, _ := Bc.GetBalance(from.Bytes())
+		pool.dropStale(pool.reorganize(from, nonce), Bc)
+
+		list, ok := pool.pending[from]
+		if !ok {
+			continue
 		}
+		txs := list.txs()
+		accounts[from] = txs
+		states[from] = &stateInfo{nonce, balance}
+		heap.Push(heads, txs[0])
+	}
+
+	//每次取手续费最高的可执行交易，再把该发送者的下一笔交易放入候选
+	for heads.Len() != 0 && len(readyTxs) < ReadyTotalQuantity {
+		tx := heap.Pop(heads).(*transaction.Transaction)
+		state := states[tx.From]
+
+		cost, ok := tx.Cost()
+		if !ok || state.balance < cost {
+			logger.Info("balance is not enough", zap.String("from", tx.From.String()), zap.Uint64("nonce", tx.Nonce),
+				zap.Uint64("balance", state.balance), zap.Uint64("amount", tx.Amount), zap.Uint64("fee", tx.Fee))
+			continue
+		}
+		state.balance -= cost
+		state.nonce = tx.Nonce + 1
+		readyTxs = append(readyTxs, tx)
+
+		txs := accounts[tx.From][1:]
+		accounts[tx.From] = txs
+		if len(txs) > 0 {
+			heap.Push(heads, txs[0])
+		}
+	}
+
+	return
+}
+
+// Content 返回pending和queued中的交易，按发送者分组、nonce排序
+func (pool *TxPool) Content() (pending, queued map[types.Address][]*transaction.Transaction) {
+	pool.Mutx.RLock()
+	defer pool.Mutx.RUnlock()
+
+	pending = make(map[types.Address][]*transaction.Transaction, len(pool.pending))
+	for from, list := range pool.pending {
+		pending[from] = list.txs()
+	}
+	queued = make(map[types.Address][]*transaction.Transaction, len(pool.queue))
+	for from, list := range pool.queue {
+		queued[from] = list.txs()
+	}
+	return
+}
+
+//交易池中的所有交易，同一发送者的交易按nonce排序，重放时依次通过nonce检查
+func (pool *TxPool) all() []*transaction.Transaction {
+	txs := make([]*transaction.Transaction, 0, pool.count)
+	for from, list := range pool.pending {
+		txs = append(txs, list.txs()...)
+		if queued, ok := pool.queue[from]; ok {
+			txs = append(txs, queued.txs()...)
+		}
+	}
+	for from, list := range pool.queue {
+		if _, ok := pool.pending[from]; !ok {
+			txs = append(txs, list.txs()...)
+		}
+	}
+	return txs
+}
+
+func (pool *TxPool) get(from types.Address, nonce uint64) *transaction.Transaction {
+	if list, ok := pool.pending[from]; ok {
+		if tx := list.get(nonce); tx != nil {
+			return tx
+		}
+	}
+	if list, ok := pool.queue[from]; ok {
+		return list.get(nonce)
+	}
+	return nil
+}
+
+func (pool *TxPool) size(from types.Address) (pending, queued int) {
+	if list, ok := pool.pending[from]; ok {
+		pending = list.len()
+	}
+	if list, ok := pool.queue[from]; ok {
+		queued = list.len()
+	}
+	return
+}
+
+//新交易先放入queued，再根据链上的nonce提升到pending
+func (pool *TxPool) put(tx *transaction.Transaction, added time.Time, nonce uint64) {
+	list, ok := pool.queue[tx.From]
+	if !ok {
+		list = newTxList()
+		pool.queue[tx.From] = list
+	}
+	list.put(tx, added)
+	pool.count++
+	pool.reorganize(tx.From, nonce)
+}
 
-		if balance >= tx.Amount && nonce == tx.Nonce {
-			if tx.IsTokenTransaction() {
-				balance -= tx.Amount + tx.Fee
-			} else {
-				balance -= tx.Amount
+func (pool *TxPool) remove(tx *transaction.Transaction) {
+	for _, lists := range []map[types.Address]*txList{pool.pending, pool.queue} {
+		if list, ok := lists[tx.From]; ok && list.get(tx.Nonce) != nil {
+			list.remove(tx.Nonce)
+			pool.count--
+			if list.len() == 0 {
+				delete(lists, tx.From)
 			}
-			nonce = tx.Nonce + 1
-			AddrStateMap[tx.From.String()] = stateInfo{nonce, balance}
-			readyTxs = append(readyTxs, tx)
-		} else if tx.Nonce > nonce {
-			noReadyTxs = append(noReadyTxs, tx)
-		} else {
-			logger.Info("nonce or amount error", zap.Uint64("current nonce", nonce), zap.Uint64("tx nonce", nonce),
-				zap.Uint64("balance", balance), zap.Uint64("amount", tx.Amount))
+			return
 		}
 	}
+}
 
-	//TODO:要避免无法上链的tx越积越多,可以设置nonce的差距，比如大于5直接舍弃
-	for _, tx := range noReadyTxs {
-		pool.List.Push(tx)
+// 根据链上的nonce重新整理发送者的交易：丢弃已经上链的nonce，
+// 从nonce开始连续的交易放入pending，其余放入queued，返回被丢弃的交易
+func (pool *TxPool) reorganize(from types.Address, nonce uint64) (stale []*transaction.Transaction) {
+	var items []*txItem
+	if list, ok := pool.pending[from]; ok {
+		items = append(items, list.sorted()...)
+	}
+	if list, ok := pool.queue[from]; ok {
+		items = append(items, list.sorted()...)
+	}
+	delete(pool.pending, from)
+	delete(pool.queue, from)
+	pool.count -= len(items)
+
+	pending, queued := newTxList(), newTxList()
+	for _, item := range items {
+		if item.tx.Nonce < nonce {
+			stale = append(stale, item.tx)
+			continue
+		}
+		queued.put(item.tx, item.added)
+	}
+	for next := nonce; ; next++ {
+		item, ok := queued.items[next]
+		if !ok {
+			break
+		}
+		queued.remove(next)
+		pending.items[next] = item
 	}
 
+	if pending.len() > 0 {
+		pool.pending[from] = pending
+	}
+	if queued.len() > 0 {
+		pool.queue[from] = queued
+	}
+	if pending.len()+queued.len() > 0 {
+		pool.nonces[from] = nonce
+	} else {
+		delete(pool.nonces, from)
+	}
+	pool.count += pending.len() + queued.len()
 	return
 }
 
-func verify(tx transaction.Transaction, Bc blockchain.Blockchains) bool {
+// 区块提交后Filter之前丢弃的交易：已经上链的由Filter发出included事件，
+// 其余的是被链上相同nonce的其他交易取代
+func (pool *TxPool) dropStale(stale []*transaction.Transaction, bc blockchain.Blockchains) {
+	for _, tx := range stale {
+		if _, err := bc.GetTransactionByHash(tx.Hash); err == nil {
+			continue
+		}
+		ev := newTxEvent(EventEvicted, tx)
+		ev.Reason = ReasonStaleNonce
+		pool.feed.send(ev)
+	}
+}
+
+// 手续费最低的交易，相同时优先选择queued中nonce最大的，尽量不在pending中留下空缺
+func (pool *TxPool) lowest() *transaction.Transaction {
+	var low *transaction.Transaction
+	for _, lists := range []map[types.Address]*txList{pool.queue, pool.pending} {
+		var lowInLists *transaction.Transaction
+		for _, list := range lists {
+			for _, item := range list.items {
+				tx, fee := item.tx, item.tx.EffectiveFee()
+				if lowInLists == nil || fee < lowInLists.EffectiveFee() || (fee == lowInLists.EffectiveFee() && tx.Nonce > lowInLists.Nonce) {
+					lowInLists = tx
+				}
+			}
+		}
+		if lowInLists != nil && (low == nil || lowInLists.EffectiveFee() < low.EffectiveFee()) {
+			low = lowInLists
+		}
+	}
+	return low
+}
+
+// 丢弃在queued中停留超过lifetime的交易
+func (pool *TxPool) expire(now time.Time) (expired []*transaction.Transaction) {
+	for from, list := range pool.queue {
+		for nonce, item := range list.items {
+			if now.Sub(item.added) > pool.lifetime {
+				list.remove(nonce)
+				pool.count--
+				expired = append(expired, item.tx)
+				ev := newTxEvent(EventEvicted, item.tx)
+				ev.Reason = ReasonExpired
+				pool.feed.send(ev)
+				logger.Info("expire transaction", zap.String("from", from.String()), zap.Uint64("nonce", nonce))
+			}
+		}
+		if list.len() == 0 {
+			delete(pool.queue, from)
+			if _, ok := pool.pending[from]; !ok {
+				delete(pool.nonces, from)
+			}
+		}
+	}
+	return
+}
+
+//交易池的准入检查：先检查共识规则，再检查最低金额、手续费、余额和nonce
+func verify(tx transaction.Transaction, Bc blockchain.Blockchains) error {
+	height, err := Bc.GetHeight()
+	if err != nil {
+		return err
+	}
+	if err := checkTx(tx, Bc, height+1); err != nil {
+		return err
+	}
+	if tx.IsCoinBaseTransaction() {
+		return nil
+	}
+
+	//3、验证余额
+	balance, _ := Bc.GetBalance(tx.From.Bytes())
+	if tx.Amount < 500000 {
+		logger.Info("failed to verify amount", zap.String("from", tx.From.String()),
+			zap.String("to", tx.To.String()), zap.Uint64("amount", tx.Amount))
+		return ErrAmount
+	}
+	if cost, ok := tx.Cost(); !ok || cost > balance {
+		logger.Info("failed to verify amount", zap.String("from", tx.From.String()),
+			zap.String("to", tx.To.String()), zap.Uint64("amount", tx.Amount), zap.Uint64("unlockbalance", balance))
+		return ErrBalance
+	}
+
+	if tx.IsTokenTransaction() && tx.Fee < 500000 {
+		logger.Info("failed to verify fee", zap.String("from", tx.From.String()),
+			zap.String("to", tx.To.String()), zap.Uint64("amount", tx.Amount),
+			zap.Uint64("fee", tx.Fee), zap.Uint64("unlockbalance", balance))
+		return ErrFee
+	}
+
+	nonce, _ := Bc.GetNonce(tx.From.Bytes())
+	if tx.Nonce < nonce {
+		logger.Info("failed to verify nonce", zap.String("from", tx.From.String()),
+			zap.Uint64("transaction nonce", tx.Nonce), zap.Uint64("nonce", nonce))
+		return ErrNonceTooLow
+	}
+	return nil
+}
+
+//不依赖账户状态的共识规则，区块中的交易只按这些规则检查，余额和nonce由执行区块时检查
+func checkTx(tx transaction.Transaction, Bc blockchain.Blockchains, height uint64) error {
+	//新旧两种签名格式在升级期间同时有效
+	if tx.Version > transaction.TxVersion {
+		logger.Info("unsupported transaction version", zap.Uint32("version", tx.Version))
+		return ErrTxVersion
+	}
+
+	//旧格式的交易没有链ID，只在配置的高度之前接受
+	if tx.Version == transaction.LegacyVersion && !tx.IsCoinBaseTransaction() {
+		if !Bc.LegacyAllowed(height) {
+			logger.Info("legacy transaction is not accepted", zap.Uint64("height", height))
+			return ErrLegacyTx
+		}
+	} else if !tx.IsCoinBaseTransaction() && tx.ChainID != Bc.ChainID() {
+		logger.Info("transaction chain id mismatch", zap.Uint64("chainid", tx.ChainID), zap.Uint64("chain", Bc.ChainID()))
+		return ErrChainID
+	}
+
 	if !tx.IsCoinBaseTransaction() {
 		//1、检查地址
 		if !tx.From.Verify() {
 			logger.Info("faile to verify address", zap.String("from", tx.From.String()))
-			return false
+			return ErrAddress
 		}
 
-		//2、验证签名
+		//2、验证签名，多签交易的有效签名数量要达到阈值
 		if !tx.Verify() {
+			if tx.MultiSig != nil {
+				logger.Info("failed to verify multisig transaction", zap.String("from", tx.From.String()),
+					zap.Uint32("threshold", tx.MultiSig.Threshold), zap.Int("signed", tx.MultiSig.Signed(tx.Hash)))
+				return ErrMultiSig
+			}
 			logger.Info("failed to verify transaction",
 				zap.String("from", tx.From.String()), zap.String("to", tx.To.String()), zap.Uint64("amount", tx.Amount))
-			return false
-		}
-
-		//3、验证余额
-		balance, _ := Bc.GetBalance(tx.From.Bytes())
-		if tx.Amount < 500000 || tx.Amount > balance {
-			logger.Info("failed to verify amount", zap.String("from", tx.From.String()),
-				zap.String("to", tx.To.String()), zap.Uint64("amount", tx.Amount), zap.Uint64("unlockbalance", balance))
-			return false
-		}
-
-		if tx.IsTokenTransaction() && (tx.Fee < 500000 || tx.Fee+tx.Amount > balance) {
-			logger.Info("failed to verify fee", zap.String("from", tx.From.String()),
-				zap.String("to", tx.To.String()), zap.Uint64("amount", tx.Amount),
-				zap.Uint64("fee", tx.Fee), zap.Uint64("unlockbalance", balance))
-			return false
-		}
-
-		nonce, _ := Bc.GetNonce(tx.From.Bytes())
-		if tx.Nonce < nonce {
-			logger.Info("failed to verify nonce", zap.String("from", tx.From.String()),
-				zap.Uint64("transaction nonce", tx.Nonce), zap.Uint64("nonce", nonce))
-			return false
+			return ErrSignature
 		}
 	}
 
 	if !tx.To.Verify() {
 		logger.Info("failed to verify address", zap.String("to", tx.To.String()))
-		return false
+		return ErrAddress
 	}
 
-	return true
+	return nil
 }
 
-//检查区块的默克尔根
+//检查区块的默克尔根和交易的共识规则
 func VerifyBlcok(b block.Block, Bc blockchain.Blockchains) bool {
 
 	trans := make([][]byte, 0, len(b.Transactions))
@@ -185,14 +613,14 @@ func VerifyBlcok(b block.Block, Bc blockchain.Blockchains) bool {
 
 	if trans != nil {
 		tree := merkle.New(sha256.New(), trans)
-		if ok := tree.VerifyNode(b.Root); ok {
-			logger.Error("Faile to verify node")
+		if !bytes.Equal(tree.GetMtHash(), b.Root) {
+			logger.Error("Failed to verify merkle root", zap.Uint64("height", b.Height))
 			return false
 		}
 
 		for _, tx := range b.Transactions {
-			if !verify(*tx, Bc) {
-				logger.Error("Failed to verify transaction")
+			if err := checkTx(*tx, Bc, b.Height); err != nil {
+				logger.Error("Failed to verify transaction", zap.Error(err), zap.Uint64("height", b.Height))
 				return false
 			}
 		}
@@ -200,20 +628,100 @@ func VerifyBlcok(b block.Block, Bc blockchain.Blockchains) bool {
 	return true
 }
 
-func (pool *TxPool) Filter(block block.Block) {
-	txs := []*transaction.Transaction(*pool.List)
-	txsLenght := len(txs)
-	now := time.Now().UTC().Unix()
-	for j := 0; j < txsLenght; j++ {
-		for _, btx := range block.Transactions {
-			//去除与块中重叠或存在超过10s的交易
-			if txs[j].EqualNonce(btx) || now-txs[j].Time > 10 {
-				txs = append(txs[:j], txs[j+1:]...)
-				txsLenght--
-				break
+// Eviction 区块提交后从交易池移除的交易以及移除的原因
+type Eviction struct {
+	Tx     *transaction.Transaction
+	Reason string
+}
+
+const (
+	ReasonIncluded     = "included in block"
+	ReasonStaleNonce   = "stale nonce"
+	ReasonInsufficient = "insufficient balance"
+	ReasonExpired      = "expired"
+	ReasonPoolFull     = "pool is full"
+)
+
+// Evicted 除了已经上链的交易之外被移除的交易数量
+func Evicted(evictions []Eviction) int {
+	n := 0
+	for _, ev := range evictions {
+		if ev.Reason != ReasonIncluded {
+			n++
+		}
+	}
+	return n
+}
+
+// Filter 区块提交后调用：移除已经上链和nonce过期的交易，按新的余额重新检查区块中发送者的交易，
+// 再把补上空缺的交易提升到pending，返回被移除的交易
+func (pool *TxPool) Filter(b block.Block, bc blockchain.Blockchains) []Eviction {
+	pool.Mutx.Lock()
+	defer pool.Mutx.Unlock()
+
+	included := make(map[string]struct{}, len(b.Transactions))
+	senders := make(map[types.Address]struct{})
+	for _, tx := range b.Transactions {
+		if tx.IsCoinBaseTransaction() {
+			continue
+		}
+		included[string(tx.Hash)] = struct{}{}
+		senders[tx.From] = struct{}{}
+		ev := newTxEvent(EventIncluded, tx)
+		ev.Height = b.Height
+		pool.feed.send(ev)
+	}
+
+	var evictions []Eviction
+	for from := range senders {
+		if _, ok := pool.nonces[from]; !ok {
+			continue
+		}
+		nonce, _ := bc.GetNonce(from.Bytes())
+		balance, _ := bc.GetBalance(from.Bytes())
+
+		var items []*txItem
+		if list, ok := pool.pending[from]; ok {
+			items = append(items, list.sorted()...)
+		}
+		if list, ok := pool.queue[from]; ok {
+			items = append(items, list.sorted()...)
+		}
+		//按nonce顺序累计保留下来的交易的花费，余额不够支付时移除
+		for _, item := range items {
+			tx := item.tx
+			var reason string
+			switch cost, ok := tx.Cost(); {
+			case tx.Nonce < nonce:
+				reason = ReasonStaleNonce
+				if _, ok := included[string(tx.Hash)]; ok {
+					reason = ReasonIncluded
+				}
+			case !ok || cost > balance:
+				reason = ReasonInsufficient
+			default:
+				balance -= cost
+				continue
 			}
+			pool.remove(tx)
+			evictions = append(evictions, Eviction{tx, reason})
 		}
+		//移除后留下的空缺使后面的交易回到queued
+		pool.reorganize(from, nonce)
 	}
 
-	*pool.List = TxHeap(txs[:txsLenght])
+	for _, ev := range evictions {
+		if ev.Reason == ReasonIncluded {
+			continue
+		}
+		txev := newTxEvent(EventEvicted, ev.Tx)
+		txev.Reason = ev.Reason
+		pool.feed.send(txev)
+		logger.Info("evict transaction", zap.String("from", ev.Tx.From.String()), zap.Uint64("nonce", ev.Tx.Nonce),
+			zap.Uint64("amount", ev.Tx.Amount), zap.Uint64("fee", ev.Tx.Fee), zap.String("reason", ev.Reason))
+	}
+	for _, tx := range pool.expire(time.Now()) {
+		evictions = append(evictions, Eviction{tx, ReasonExpired})
+	}
+	return evictions
 }
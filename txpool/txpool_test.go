@@ -0,0 +1,325 @@
+package txpool
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kortho/blockchain"
+	"kortho/config"
+	"kortho/logger"
+	"kortho/transaction"
+	"kortho/types"
+)
+
+const testBalance = 1000000000000
+
+type testAccount struct {
+	priv []byte
+	addr types.Address
+}
+
+func newTestAccounts(t *testing.T, n int) []*testAccount {
+	var accounts []*testAccount
+	for i := 0; i < n; i++ {
+		w := types.NewWallet()
+		addr, err := types.StringToAddress(w.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts = append(accounts, &testAccount{priv: w.PrivateKey, addr: *addr})
+	}
+	return accounts
+}
+
+//fee为0时是普通转账，否则是支付手续费的token交易
+func (a *testAccount) transfer(nonce, amount, fee uint64) *transaction.Transaction {
+	opts := []transaction.ModOption{transaction.WithChainID(1)}
+	if fee > 0 {
+		opts = append(opts, transaction.WithToken(fee, "token", nil))
+	}
+	tx := transaction.NewTransaction(nonce, amount, a.addr, a.addr, opts...)
+	tx.Sgin(a.priv)
+	return tx
+}
+
+//支付手续费的普通转账
+func (a *testAccount) plain(nonce, amount, fee uint64) *transaction.Transaction {
+	tx := transaction.NewTransaction(nonce, amount, a.addr, a.addr, transaction.WithChainID(1))
+	tx.Fee = fee
+	tx.HashTransaction()
+	tx.Sgin(a.priv)
+	return tx
+}
+
+//创世块给每个账户分配testBalance
+func newTestPool(t *testing.T, accounts []*testAccount) (*TxPool, *blockchain.Blockchain, string) {
+	dir, err := ioutil.TempDir("", "txpool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.InitLogger(&config.LogConfigInfo{Level: "INFO", FileName: filepath.Join(dir, "test.log")})
+
+	qtj := types.NewWallet().Address
+	genesis := &config.GenesisConfigInfo{ChainID: 1, Timestamp: 1600000000, QTJAddress: qtj, DSAddress: qtj, CMAddress: qtj}
+	for _, a := range accounts {
+		genesis.Alloc = append(genesis.Alloc, config.AllocInfo{Address: a.addr.String(), Balance: testBalance})
+	}
+	bc := blockchain.NewWithDir(dir)
+	if _, err := bc.SetupGenesis(genesis); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := New(qtj, &config.TxPoolConfigInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool, bc, dir
+}
+
+func TestReplaceByFee(t *testing.T) {
+	accounts := newTestAccounts(t, 1)
+	pool, bc, dir := newTestPool(t, accounts)
+	defer os.RemoveAll(dir)
+	a := accounts[0]
+
+	old := a.transfer(1, 1000000, 1000000)
+	if err := pool.Add(old, bc); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(old, bc); err != ErrKnownTx {
+		t.Fatalf("add again: %v", err)
+	}
+	if err := pool.Add(a.transfer(1, 1000000, 1050000), bc); err != ErrUnderpriced {
+		t.Fatalf("bump below PriceBump: %v", err)
+	}
+	replacement := a.transfer(1, 1000000, 1100000)
+	if err := pool.Add(replacement, bc); err != nil {
+		t.Fatal(err)
+	}
+	if tx := pool.get(a.addr, 1); tx == nil || !bytes.Equal(tx.Hash, replacement.Hash) {
+		t.Fatal("transaction is not replaced")
+	}
+	if pool.count != 1 {
+		t.Fatalf("pool has %d transactions, want 1", pool.count)
+	}
+
+	//普通转账同样按Fee替换
+	if err := pool.Add(a.plain(2, 1000000, 0), bc); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(a.plain(2, 1000000, 0), bc); err != ErrKnownTx {
+		t.Fatalf("add again: %v", err)
+	}
+	paid := a.plain(2, 1000000, 5000000)
+	if err := pool.Add(paid, bc); err != nil {
+		t.Fatalf("replace a plain transfer: %v", err)
+	}
+	if tx := pool.get(a.addr, 2); tx == nil || !bytes.Equal(tx.Hash, paid.Hash) {
+		t.Fatal("plain transfer is not replaced")
+	}
+	if err := pool.Add(a.plain(2, 1000000, 5200000), bc); err != ErrUnderpriced {
+		t.Fatalf("bump below PriceBump: %v", err)
+	}
+}
+
+//交易池满时淘汰实际手续费最低、nonce最大的交易，普通转账和token交易一样按Fee排序
+func TestEvictLowestFee(t *testing.T) {
+	senders := MaxPoolSize / MaxAccountTxs
+	accounts := newTestAccounts(t, senders+1)
+	pool, bc, dir := newTestPool(t, accounts)
+	defer os.RemoveAll(dir)
+
+	cheap := accounts[0]
+	for i, a := range accounts[:senders] {
+		fee := uint64(1000000)
+		if i == 0 {
+			fee = 0
+		}
+		for nonce := uint64(1); nonce <= MaxAccountTxs; nonce++ {
+			if err := pool.Add(a.plain(nonce, 1000000, fee), bc); err != nil {
+				t.Fatalf("sender %d nonce %d: %v", i, nonce, err)
+			}
+		}
+	}
+	if pool.count != MaxPoolSize {
+		t.Fatalf("pool has %d transactions, want %d", pool.count, MaxPoolSize)
+	}
+
+	a := accounts[senders]
+	if err := pool.Add(a.plain(1, 1000000, 0), bc); err != ErrPoolFull {
+		t.Fatalf("add without fee to a full pool: %v", err)
+	}
+	if err := pool.Add(a.plain(1, 1000000, 1000000), bc); err != nil {
+		t.Fatal(err)
+	}
+	if pool.count != MaxPoolSize {
+		t.Fatalf("pool has %d transactions, want %d", pool.count, MaxPoolSize)
+	}
+	if pool.get(cheap.addr, MaxAccountTxs) != nil {
+		t.Fatal("the last transaction without fee is not evicted")
+	}
+	if pool.get(cheap.addr, MaxAccountTxs-1) == nil {
+		t.Fatal("evicted more than one transaction")
+	}
+}
+
+//关闭时写入磁盘的交易在重启后重新加入交易池
+func TestJournalClose(t *testing.T) {
+	accounts := newTestAccounts(t, 1)
+	_, bc, dir := newTestPool(t, accounts)
+	defer os.RemoveAll(dir)
+
+	cfg := &config.TxPoolConfigInfo{Journal: filepath.Join(dir, "transactions.rlp")}
+	pool, err := New(types.NewWallet().Address, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.LoadJournal(bc); err != nil {
+		t.Fatal(err)
+	}
+	tx := accounts[0].transfer(1, 1000000, 1000000)
+	if err := pool.Add(tx, bc); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatalf("close again: %v", err)
+	}
+	if _, err := os.Stat(cfg.Journal + ".new"); !os.IsNotExist(err) {
+		t.Fatalf("temporary journal is left: %v", err)
+	}
+
+	restarted, err := New(types.NewWallet().Address, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	if err := restarted.LoadJournal(bc); err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.get(tx.From, 1); got == nil || !bytes.Equal(got.Hash, tx.Hash) {
+		t.Fatal("journaled transaction is not restored")
+	}
+}
+
+//区块提交后按累计花费重新检查发送者剩余的交易
+func TestFilter(t *testing.T) {
+	accounts := newTestAccounts(t, 2)
+	pool, bc, dir := newTestPool(t, accounts)
+	defer os.RemoveAll(dir)
+	a, b := accounts[0], accounts[1]
+
+	for nonce := uint64(2); nonce <= 4; nonce++ {
+		if err := pool.Add(a.transfer(nonce, testBalance/4, 0), bc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pay := transaction.NewTransaction(1, testBalance/2, a.addr, b.addr, transaction.WithChainID(1))
+	pay.Sgin(a.priv)
+	blk, err := bc.NewBlock([]*transaction.Transaction{pay}, b.addr, b.addr, b.addr, b.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(blk, b.addr.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	evictions := pool.Filter(*blk, bc)
+	if len(evictions) != 1 || evictions[0].Tx.Nonce != 4 || evictions[0].Reason != ReasonInsufficient {
+		t.Fatalf("evictions %+v, want nonce 4 for insufficient balance", evictions)
+	}
+	if Evicted(evictions) != 1 {
+		t.Fatalf("evicted %d, want 1", Evicted(evictions))
+	}
+	pending, queued := pool.size(a.addr)
+	if pending != 2 || queued != 0 {
+		t.Fatalf("pending %d queued %d, want 2 and 0", pending, queued)
+	}
+}
+
+//新发送者的第一笔交易nonce连续，直接进入pending
+func TestFirstTxPending(t *testing.T) {
+	accounts := newTestAccounts(t, 1)
+	pool, bc, dir := newTestPool(t, accounts)
+	defer os.RemoveAll(dir)
+	a := accounts[0]
+
+	if err := pool.Add(a.transfer(1, testBalance/4, 0), bc); err != nil {
+		t.Fatal(err)
+	}
+	if pending, queued := pool.size(a.addr); pending != 1 || queued != 0 {
+		t.Fatalf("pending %d queued %d, want 1 and 0", pending, queued)
+	}
+	if txs := pool.Pending(bc); len(txs) != 1 {
+		t.Fatalf("pending %d transactions, want 1", len(txs))
+	}
+}
+
+//区块提交后Filter之前整理交易池，上链的交易不能被报告为evicted
+func TestStaleBeforeFilter(t *testing.T) {
+	accounts := newTestAccounts(t, 2)
+	pool, bc, dir := newTestPool(t, accounts)
+	defer os.RemoveAll(dir)
+	a, b := accounts[0], accounts[1]
+
+	included := a.transfer(1, testBalance/4, 0)
+	replaced := b.transfer(1, testBalance/4, 0)
+	for _, tx := range []*transaction.Transaction{included, replaced, a.transfer(2, testBalance/4, 0)} {
+		if err := pool.Add(tx, bc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pay := transaction.NewTransaction(1, testBalance/2, b.addr, a.addr, transaction.WithChainID(1))
+	pay.Sgin(b.priv)
+	blk, err := bc.NewBlock([]*transaction.Transaction{included, pay}, b.addr, b.addr, b.addr, b.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddBlock(blk, b.addr.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	evs, _ := pool.EventsSince(0)
+	seq := evs[len(evs)-1].Seq
+	if txs := pool.Pending(bc); len(txs) != 1 || txs[0].Nonce != 2 {
+		t.Fatalf("pending %d transactions, want nonce 2", len(txs))
+	}
+	evs, _ = pool.EventsSince(seq)
+	if len(evs) != 1 || evs[0].Type != EventEvicted || !bytes.Equal(evs[0].Hash, replaced.Hash) || evs[0].Reason != ReasonStaleNonce {
+		t.Fatalf("events %+v, want only the replaced transaction evicted", evs)
+	}
+}
+
+//最低金额是交易池的准入规则，区块中的交易只检查共识规则
+func TestVerifyBlockPolicy(t *testing.T) {
+	accounts := newTestAccounts(t, 1)
+	pool, bc, dir := newTestPool(t, accounts)
+	defer os.RemoveAll(dir)
+	a := accounts[0]
+
+	small := a.plain(1, 1000, 0)
+	if err := pool.Add(small, bc); err != ErrAmount {
+		t.Fatalf("add small transfer: %v, want %v", err, ErrAmount)
+	}
+	blk, err := bc.NewBlock([]*transaction.Transaction{small}, a.addr, a.addr, a.addr, a.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyBlcok(*blk, bc) {
+		t.Fatal("block with a small transfer is rejected")
+	}
+
+	forged := a.plain(1, 1000, 0)
+	forged.Amount = 2000
+	blk, err = bc.NewBlock([]*transaction.Transaction{forged}, a.addr, a.addr, a.addr, a.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyBlcok(*blk, bc) {
+		t.Fatal("block with a forged transaction is accepted")
+	}
+}
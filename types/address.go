@@ -3,6 +3,7 @@ package types
 import (
 	"crypto/ed25519"
 	"kortho/util"
+	"strings"
 
 	"errors"
 )
@@ -11,14 +12,28 @@ const (
 	AddrPrefix     = "kto"
 	AddrPrefixSize = len(AddrPrefix)
 	AddressSize    = 47
+	// AddressVersion 带校验和的地址格式：前缀加上base58check(版本号+公钥)
+	AddressVersion byte = 1
 )
 
+var (
+	errAddress        = errors.New("This string is not a address type")
+	errAddressVersion = errors.New("unsupported address version")
+	errLegacyAddress  = errors.New("legacy address without checksum is not accepted")
+)
+
+// AllowLegacyAddress 迁移期间StringToAddress仍然接受没有校验和的旧格式地址
+var AllowLegacyAddress = true
+
+// Address 内部保存旧格式的地址，用作账户状态的键和交易编码；
+// String和StringToAddress使用带校验和的格式
 type Address [AddressSize]byte
 
 func (a *Address) Bytes() []byte {
 	return a[:]
 }
 
+// BytesToAddress 从内部格式的字节恢复地址，用于读取链上和存储中的数据
 func BytesToAddress(from []byte) (*Address, error) {
 	var addr Address
 	copy(addr[:], from[:])
@@ -29,10 +44,14 @@ func BytesToAddress(from []byte) (*Address, error) {
 }
 
 func (a *Address) ToPublicKey() []byte {
-	return util.Base58Decode(a.String()[AddrPrefixSize:])
+	return util.Base58Decode(string(a[AddrPrefixSize:]))
 }
 
 func PublicKeyToAddress(publicKey []byte) string {
+	return AddrPrefix + util.CheckEncode(publicKey, AddressVersion)
+}
+
+func legacyAddress(publicKey []byte) string {
 	pubStr := util.Base58EncodeToString(publicKey)
 	return AddrPrefix + pubStr
 }
@@ -46,21 +65,55 @@ func (a *Address) IsNil() bool {
 	return false
 }
 
+// String 带校验和的地址，无效的地址返回原始内容
 func (a *Address) String() string {
+	if !a.Verify() {
+		return string(a[:])
+	}
+	return PublicKeyToAddress(a.ToPublicKey())
+}
+
+// LegacyString 旧格式的地址
+func (a *Address) LegacyString() string {
 	return string(a[:])
 }
 
+// StringToAddress 解析带校验和的地址，AllowLegacyAddress为true时也接受旧格式
 func StringToAddress(str string) (*Address, error) {
 	var addr Address
-	copy(addr[:], []byte(str)[:])
+	if len(str) == AddressSize {
+		if !AllowLegacyAddress {
+			return nil, errLegacyAddress
+		}
+		copy(addr[:], str)
+		if !addr.Verify() {
+			return nil, errAddress
+		}
+		return &addr, nil
+	}
+
+	if !strings.HasPrefix(str, AddrPrefix) {
+		return nil, errAddress
+	}
+	publicKey, version, err := util.CheckDecode(str[AddrPrefixSize:])
+	if err != nil {
+		return nil, err
+	}
+	if version != AddressVersion {
+		return nil, errAddressVersion
+	}
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, errAddress
+	}
+	copy(addr[:], legacyAddress(publicKey))
 	if !addr.Verify() {
-		return nil, errors.New("This string is not a address type")
+		return nil, errAddress
 	}
 	return &addr, nil
 }
 
 func (a *Address) Verify() bool {
-	if a.String()[:AddrPrefixSize] != AddrPrefix {
+	if string(a[:AddrPrefixSize]) != AddrPrefix {
 		return false
 	} else if len(a.ToPublicKey()) != ed25519.PublicKeySize {
 		return false
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestChecksumAddress(t *testing.T) {
+	wallet := NewWallet()
+	addr, err := StringToAddress(wallet.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.String() != wallet.Address {
+		t.Fatalf("round trip %s, want %s", addr.String(), wallet.Address)
+	}
+
+	//旧格式和新格式解析出同一个地址
+	legacy, err := StringToAddress(addr.LegacyString())
+	if err != nil || *legacy != *addr {
+		t.Fatalf("legacy %s: %v", addr.LegacyString(), err)
+	}
+
+	//改动任意一个字符都无法通过校验
+	for i := AddrPrefixSize; i < len(wallet.Address); i++ {
+		typo := []byte(wallet.Address)
+		if typo[i] == '2' {
+			typo[i] = '3'
+		} else {
+			typo[i] = '2'
+		}
+		if _, err := StringToAddress(string(typo)); err == nil {
+			t.Fatalf("typo at %d accepted: %s", i, typo)
+		}
+	}
+}
+
+func TestLegacyAddressFlag(t *testing.T) {
+	defer func(allow bool) { AllowLegacyAddress = allow }(AllowLegacyAddress)
+
+	wallet := NewWallet()
+	addr, _ := StringToAddress(wallet.Address)
+
+	AllowLegacyAddress = false
+	if _, err := StringToAddress(addr.LegacyString()); err != errLegacyAddress {
+		t.Fatalf("legacy address accepted: %v", err)
+	}
+	if _, err := StringToAddress(wallet.Address); err != nil {
+		t.Fatal(err)
+	}
+	//链上数据仍然使用内部格式
+	if _, err := BytesToAddress(addr.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddressToPublicKey(t *testing.T) {
+	wallet := NewWallet()
+	addr, _ := StringToAddress(wallet.Address)
+	for _, s := range []string{wallet.Address, addr.LegacyString()} {
+		if !bytes.Equal(AddressToPublicKey(s), addr.ToPublicKey()) {
+			t.Fatalf("public key of %s", s)
+		}
+	}
+	if AddressToPublicKey("kto") != nil {
+		t.Fatal("public key of an invalid address")
+	}
+}
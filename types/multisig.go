@@ -0,0 +1,87 @@
+package types
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// MaxMultiSigKeys 多签账户最多包含的公钥数
+const MaxMultiSigKeys = 16
+
+var multiSigDomain = []byte("kortho-multisig")
+
+var errMultiSig = errors.New("invalid multisig threshold or public keys")
+
+// MultiSigAccount M-of-N多签账户，PublicKeys按字节序排序，
+// 地址由阈值和公钥集合的哈希派生，没有对应的私钥
+type MultiSigAccount struct {
+	Threshold  uint32
+	PublicKeys [][]byte
+}
+
+// NewMultiSigAccount 公钥的顺序不影响地址
+func NewMultiSigAccount(threshold uint32, publicKeys [][]byte) (*MultiSigAccount, error) {
+	keys := make([][]byte, len(publicKeys))
+	for i, key := range publicKeys {
+		keys[i] = append([]byte{}, key...)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	account := &MultiSigAccount{Threshold: threshold, PublicKeys: keys}
+	if err := account.Check(); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Check 检查阈值范围，公钥必须有序且不重复
+func (m *MultiSigAccount) Check() error {
+	n := len(m.PublicKeys)
+	if n == 0 || n > MaxMultiSigKeys || m.Threshold == 0 || int(m.Threshold) > n {
+		return errMultiSig
+	}
+	for i, key := range m.PublicKeys {
+		if len(key) != ed25519.PublicKeySize {
+			return errMultiSig
+		}
+		if i > 0 && bytes.Compare(m.PublicKeys[i-1], key) >= 0 {
+			return errMultiSig
+		}
+	}
+	return nil
+}
+
+// Index 公钥在账户中的位置，不存在时返回-1
+func (m *MultiSigAccount) Index(publicKey []byte) int {
+	for i, key := range m.PublicKeys {
+		if bytes.Equal(key, publicKey) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *MultiSigAccount) Address() Address {
+	var addr Address
+	copy(addr[:], legacyAddress(m.hash()))
+	return addr
+}
+
+func (m *MultiSigAccount) hash() []byte {
+	h := sha3.New256()
+	h.Write(multiSigDomain)
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], m.Threshold)
+	h.Write(b[:])
+	binary.BigEndian.PutUint32(b[:], uint32(len(m.PublicKeys)))
+	h.Write(b[:])
+	for _, key := range m.PublicKeys {
+		h.Write(key)
+	}
+	return h.Sum(nil)
+}
@@ -3,7 +3,6 @@ package types
 import (
 	"crypto/ed25519"
 	"crypto/rand"
-	"kortho/util"
 )
 
 type Wallet struct {
@@ -28,6 +27,11 @@ func GenKeyPair() ([]byte, []byte, error) {
 	return []byte(publicKey), []byte(privateKey), nil
 }
 
+// AddressToPublicKey 解析地址得到公钥，地址无效时返回nil
 func AddressToPublicKey(address string) []byte {
-	return util.Base58Decode(address[AddrPrefixSize:])
+	addr, err := StringToAddress(address)
+	if err != nil {
+		return nil
+	}
+	return addr.ToPublicKey()
 }
@@ -107,6 +107,10 @@ func Base58Decode(b string) []byte {
 	}
 
 	tmpval := answer.Bytes()
+	//超过32字节的不是公钥，和无效字符一样返回空
+	if len(tmpval) > 32 {
+		return []byte("")
+	}
 
 	// var numZeros int
 	// for numZeros = 0; numZeros < len(b); numZeros++ {
@@ -0,0 +1,179 @@
+// Package codec 确定性的二进制编码：字段按固定顺序写入，
+// 整数大端序定长，变长字段带4字节长度前缀
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// MaxLength 单个变长字段的最大长度
+const MaxLength = 32 << 20
+
+var (
+	ErrShortData   = errors.New("codec: unexpected end of data")
+	ErrLength      = errors.New("codec: length exceeds the limit")
+	ErrTrailing    = errors.New("codec: trailing data")
+	ErrVersion     = errors.New("codec: unsupported encoding version")
+	ErrFixedLength = errors.New("codec: fixed field length mismatch")
+)
+
+// IsJSON 旧版本使用json存储的数据以'{'开头，二进制编码以版本号开头
+func IsJSON(data []byte) bool {
+	return len(data) > 0 && data[0] == '{'
+}
+
+type Writer struct {
+	buf bytes.Buffer
+}
+
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+func (w *Writer) WriteUint8(v uint8) {
+	w.buf.WriteByte(v)
+}
+
+func (w *Writer) WriteUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *Writer) WriteUint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *Writer) WriteInt64(v int64) {
+	w.WriteUint64(uint64(v))
+}
+
+// WriteFixed 写入定长字段，不带长度前缀
+func (w *Writer) WriteFixed(v []byte) {
+	w.buf.Write(v)
+}
+
+func (w *Writer) WriteBytes(v []byte) {
+	w.WriteUint32(uint32(len(v)))
+	w.buf.Write(v)
+}
+
+func (w *Writer) WriteString(v string) {
+	w.WriteUint32(uint32(len(v)))
+	w.buf.WriteString(v)
+}
+
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// Reader 读取出错后后续的读取都返回零值，最后通过Err或Finish检查
+type Reader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func NewReader(data []byte) *Reader {
+	return &Reader{data: data}
+}
+
+func (r *Reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data)-r.off < n {
+		r.err = ErrShortData
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *Reader) ReadUint8() uint8 {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *Reader) ReadUint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *Reader) ReadUint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *Reader) ReadInt64() int64 {
+	return int64(r.ReadUint64())
+}
+
+// ReadFixed 读取len(v)字节到v中
+func (r *Reader) ReadFixed(v []byte) {
+	if b := r.next(len(v)); b != nil {
+		copy(v, b)
+	}
+}
+
+// ReadBytes 读取带长度前缀的字段，长度为0时返回nil
+func (r *Reader) ReadBytes() []byte {
+	n := r.ReadUint32()
+	if r.err != nil {
+		return nil
+	}
+	if n > MaxLength {
+		r.err = ErrLength
+		return nil
+	}
+	b := r.next(int(n))
+	if len(b) == 0 {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func (r *Reader) ReadString() string {
+	return string(r.ReadBytes())
+}
+
+// Len 剩余未读取的字节数
+func (r *Reader) Len() int {
+	return len(r.data) - r.off
+}
+
+// Fail 记录解析时发现的错误，之后的读取都返回零值
+func (r *Reader) Fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Finish 检查读取过程中的错误以及是否有多余的数据
+func (r *Reader) Finish() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.off != len(r.data) {
+		return ErrTrailing
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	w := NewWriter()
+	w.WriteUint8(7)
+	w.WriteUint32(1 << 20)
+	w.WriteUint64(1<<63 + 5)
+	w.WriteInt64(-3)
+	w.WriteFixed([]byte{1, 2, 3})
+	w.WriteBytes([]byte("hello"))
+	w.WriteBytes(nil)
+	w.WriteString("kortho")
+
+	r := NewReader(w.Bytes())
+	if v := r.ReadUint8(); v != 7 {
+		t.Fatalf("uint8 = %d", v)
+	}
+	if v := r.ReadUint32(); v != 1<<20 {
+		t.Fatalf("uint32 = %d", v)
+	}
+	if v := r.ReadUint64(); v != 1<<63+5 {
+		t.Fatalf("uint64 = %d", v)
+	}
+	if v := r.ReadInt64(); v != -3 {
+		t.Fatalf("int64 = %d", v)
+	}
+	fixed := make([]byte, 3)
+	r.ReadFixed(fixed)
+	if !bytes.Equal(fixed, []byte{1, 2, 3}) {
+		t.Fatalf("fixed = %v", fixed)
+	}
+	if v := r.ReadBytes(); string(v) != "hello" {
+		t.Fatalf("bytes = %q", v)
+	}
+	if v := r.ReadBytes(); v != nil {
+		t.Fatalf("empty bytes = %v", v)
+	}
+	if v := r.ReadString(); v != "kortho" {
+		t.Fatalf("string = %q", v)
+	}
+	if err := r.Finish(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	encode := func() []byte {
+		w := NewWriter()
+		w.WriteUint64(42)
+		w.WriteString("a")
+		return w.Bytes()
+	}
+	want := []byte{0, 0, 0, 0, 0, 0, 0, 42, 0, 0, 0, 1, 'a'}
+	if got := encode(); !bytes.Equal(got, want) {
+		t.Fatalf("encoding = %v, want %v", got, want)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	w := NewWriter()
+	w.WriteBytes([]byte("hello"))
+	data := w.Bytes()
+
+	r := NewReader(data[:len(data)-1])
+	r.ReadBytes()
+	if err := r.Finish(); err != ErrShortData {
+		t.Fatalf("truncated data: %v", err)
+	}
+
+	r = NewReader(append(data, 0))
+	r.ReadBytes()
+	if err := r.Finish(); err != ErrTrailing {
+		t.Fatalf("trailing data: %v", err)
+	}
+
+	r = NewReader([]byte{0xff, 0xff, 0xff, 0xff})
+	r.ReadBytes()
+	if err := r.Finish(); err != ErrLength {
+		t.Fatalf("oversized length: %v", err)
+	}
+}
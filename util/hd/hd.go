@@ -0,0 +1,170 @@
+// Package hd 助记词(BIP39)和ed25519分层确定性密钥派生(SLIP-0010)，
+// 一个种子可以确定地派生出任意多个地址
+package hd
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"kortho/types"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+const (
+	// HardenedOffset ed25519只支持硬化派生，索引都要加上这个偏移
+	HardenedOffset = 0x80000000
+
+	// CoinType 路径中的币种编号，没有在SLIP-0044注册
+	CoinType = 606
+
+	// DefaultEntropyBits 生成24个单词的助记词
+	DefaultEntropyBits = 256
+)
+
+// BasePath 地址的派生路径是BasePath/i'
+var BasePath = fmt.Sprintf("m/44'/%d'/0'/0'", CoinType)
+
+var (
+	ErrMnemonic = errors.New("invalid mnemonic")
+	ErrPath     = errors.New("invalid derivation path")
+	ErrSeed     = errors.New("seed length must be between 16 and 64 bytes")
+)
+
+var masterSecret = []byte("ed25519 seed")
+
+// NewMnemonic 生成新的助记词，bits是熵的位数，取值128到256之间32的倍数
+func NewMnemonic(bits int) (string, error) {
+	entropy, err := bip39.NewEntropy(bits)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// MnemonicToSeed 校验助记词并和口令一起生成种子
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, ErrMnemonic
+	}
+	return bip39.NewSeed(mnemonic, passphrase), nil
+}
+
+// Key 派生出的私钥种子和链码
+type Key struct {
+	Key       []byte
+	ChainCode []byte
+}
+
+func NewMaster(seed []byte) (*Key, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, ErrSeed
+	}
+	return newKey(masterSecret, seed), nil
+}
+
+// Child 派生硬化子密钥，index不需要加HardenedOffset
+func (k *Key) Child(index uint32) (*Key, error) {
+	if index >= HardenedOffset {
+		return nil, ErrPath
+	}
+	data := make([]byte, 0, 1+len(k.Key)+4)
+	data = append(data, 0)
+	data = append(data, k.Key...)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], index+HardenedOffset)
+	return newKey(k.ChainCode, data), nil
+}
+
+func (k *Key) PrivateKey() ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(k.Key)
+}
+
+func (k *Key) PublicKey() ed25519.PublicKey {
+	return k.PrivateKey().Public().(ed25519.PublicKey)
+}
+
+func (k *Key) Address() string {
+	return types.PublicKeyToAddress(k.PublicKey())
+}
+
+// Wallet 转换成types.Wallet，可以直接用于签名交易
+func (k *Key) Wallet() *types.Wallet {
+	return &types.Wallet{
+		PrivateKey: k.PrivateKey(),
+		Address:    k.Address(),
+	}
+}
+
+func newKey(secret, data []byte) *Key {
+	mac := hmac.New(sha512.New, secret)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	return &Key{Key: sum[:32], ChainCode: sum[32:]}
+}
+
+// ParsePath 解析形如m/44'/606'/0'的路径，每一级都必须是硬化的
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, ErrPath
+	}
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		if !strings.HasSuffix(part, "'") {
+			return nil, ErrPath
+		}
+		index, err := strconv.ParseUint(strings.TrimSuffix(part, "'"), 10, 32)
+		if err != nil || index >= HardenedOffset {
+			return nil, ErrPath
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+// Derive 从种子按路径派生密钥
+func Derive(seed []byte, path string) (*Key, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := NewMaster(seed)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// AddressPath 第index个地址的派生路径
+func AddressPath(index uint32) string {
+	return fmt.Sprintf("%s/%d'", BasePath, index)
+}
+
+// DeriveWallets 从种子派生第start个开始的count个地址
+func DeriveWallets(seed []byte, start, count uint32) ([]*types.Wallet, error) {
+	base, err := Derive(seed, BasePath)
+	if err != nil {
+		return nil, err
+	}
+	wallets := make([]*types.Wallet, 0, count)
+	for i := start; i < start+count; i++ {
+		key, err := base.Child(i)
+		if err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, key.Wallet())
+	}
+	return wallets, nil
+}
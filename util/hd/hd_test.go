@@ -0,0 +1,76 @@
+package hd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+//SLIP-0010的ed25519测试向量1
+func TestSLIP10Vector(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	tests := []struct {
+		path, chainCode, key, public string
+	}{
+		{"m",
+			"90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb",
+			"2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7",
+			"a4b2856bfec510abab89753fac1ac0e1112364e7d250545963f135f2a33188ed"},
+		{"m/0'",
+			"8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69",
+			"68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3",
+			"8c8a13df77a28f3445213a0f432fde644acaa215fc72dcdf300d5efaa85d350c"},
+	}
+	for _, test := range tests {
+		key, err := Derive(seed, test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(key.ChainCode) != test.chainCode {
+			t.Errorf("%s chain code %x", test.path, key.ChainCode)
+		}
+		if hex.EncodeToString(key.Key) != test.key {
+			t.Errorf("%s key %x", test.path, key.Key)
+		}
+		if hex.EncodeToString(key.PublicKey()) != test.public {
+			t.Errorf("%s public key %x", test.path, key.PublicKey())
+		}
+	}
+}
+
+func TestDeriveWallets(t *testing.T) {
+	mnemonic, err := NewMnemonic(DefaultEntropyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := MnemonicToSeed(mnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallets, err := DeriveWallets(seed, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//同一个种子派生的地址相同，并且和单独派生的结果一致
+	again, _ := DeriveWallets(seed, 2, 1)
+	if again[0].Address != wallets[2].Address || !bytes.Equal(again[0].PrivateKey, wallets[2].PrivateKey) {
+		t.Fatal("derivation is not deterministic")
+	}
+	key, _ := Derive(seed, AddressPath(1))
+	if key.Address() != wallets[1].Address {
+		t.Fatalf("path %s derived %s, want %s", AddressPath(1), key.Address(), wallets[1].Address)
+	}
+	if wallets[0].Address == wallets[1].Address {
+		t.Fatal("duplicate addresses")
+	}
+
+	if _, err := MnemonicToSeed(mnemonic+" abandon", ""); err != ErrMnemonic {
+		t.Fatalf("invalid mnemonic: %v", err)
+	}
+	for _, path := range []string{"", "44'", "m/44", "m/44'/x'"} {
+		if _, err := ParsePath(path); err != ErrPath {
+			t.Errorf("path %q: %v", path, err)
+		}
+	}
+}
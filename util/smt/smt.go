@@ -0,0 +1,332 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+)
+
+// 压缩的稀疏默克尔树：只有一个叶子的子树直接用叶子表示，
+// 树的形状只由叶子集合决定，与插入顺序无关
+const (
+	leafFlag     = 0x00
+	internalFlag = 0x01
+
+	HashSize = sha256.Size
+)
+
+var (
+	// NodePrefix 节点在存储中的key前缀，节点按hash存储
+	NodePrefix = []byte("smt")
+
+	emptyHash = make([]byte, HashSize)
+
+	errNodeData = errors.New("invalid smt node data")
+)
+
+// Store 节点存储，storage.Transaction满足该接口
+type Store interface {
+	Get([]byte) ([]byte, error)
+	Set([]byte, []byte) error
+}
+
+// MemStore 内存中的节点存储
+type MemStore map[string][]byte
+
+func (m MemStore) Get(k []byte) ([]byte, error) {
+	v, ok := m[string(k)]
+	if !ok {
+		return nil, errNodeData
+	}
+	return v, nil
+}
+
+func (m MemStore) Set(k, v []byte) error {
+	m[string(k)] = v
+	return nil
+}
+
+type Tree struct {
+	store Store
+	root  []byte
+}
+
+// Proof 从根到目标位置的兄弟节点hash，
+// 如果目标位置是另一个叶子，LeafPath和LeafValue是该叶子的内容，用于证明key不存在
+type Proof struct {
+	Siblings  [][]byte `json:"siblings"`
+	LeafPath  []byte   `json:"leafPath,omitempty"`
+	LeafValue []byte   `json:"leafValue,omitempty"`
+}
+
+// New 打开以root为根的树，root为空表示空树
+func New(store Store, root []byte) *Tree {
+	if len(root) == 0 {
+		root = emptyHash
+	}
+	return &Tree{store: store, root: root}
+}
+
+// EmptyRoot 空树的根
+func EmptyRoot() []byte {
+	return append([]byte{}, emptyHash...)
+}
+
+func (t *Tree) Root() []byte {
+	return append([]byte{}, t.root...)
+}
+
+// Get 返回key对应的值，不存在时返回nil
+func (t *Tree) Get(key []byte) ([]byte, error) {
+	path := keyPath(key)
+	hash := t.root
+	for depth := 0; ; depth++ {
+		if isEmpty(hash) {
+			return nil, nil
+		}
+		data, err := t.load(hash)
+		if err != nil {
+			return nil, err
+		}
+		if data[0] == leafFlag {
+			if bytes.Equal(data[1:1+HashSize], path) {
+				return data[1+HashSize:], nil
+			}
+			return nil, nil
+		}
+		hash = child(data, bit(path, depth))
+	}
+}
+
+// Update 设置key的值，value为nil表示删除
+func (t *Tree) Update(key, value []byte) error {
+	root, err := t.update(t.root, 0, keyPath(key), value)
+	if err != nil {
+		return err
+	}
+	t.root = root
+	return nil
+}
+
+// Prove 生成key存在或不存在的证明
+func (t *Tree) Prove(key []byte) (*Proof, error) {
+	path := keyPath(key)
+	proof := &Proof{}
+	hash := t.root
+	for depth := 0; ; depth++ {
+		if isEmpty(hash) {
+			return proof, nil
+		}
+		data, err := t.load(hash)
+		if err != nil {
+			return nil, err
+		}
+		if data[0] == leafFlag {
+			if !bytes.Equal(data[1:1+HashSize], path) {
+				proof.LeafPath = data[1 : 1+HashSize]
+				proof.LeafValue = data[1+HashSize:]
+			}
+			return proof, nil
+		}
+		b := bit(path, depth)
+		proof.Siblings = append(proof.Siblings, child(data, 1-b))
+		hash = child(data, b)
+	}
+}
+
+// VerifyProof 验证key在root下的值是value，value为nil时验证key不存在
+func VerifyProof(root, key, value []byte, proof *Proof) bool {
+	path := keyPath(key)
+	depth := len(proof.Siblings)
+	if depth > HashSize*8 {
+		return false
+	}
+
+	var hash []byte
+	switch {
+	case value != nil:
+		hash = leafHash(path, value)
+	case proof.LeafPath != nil:
+		//另一个叶子必须位于key的路径上
+		if len(proof.LeafPath) != HashSize || bytes.Equal(proof.LeafPath, path) {
+			return false
+		}
+		for i := 0; i < depth; i++ {
+			if bit(proof.LeafPath, i) != bit(path, i) {
+				return false
+			}
+		}
+		hash = leafHash(proof.LeafPath, proof.LeafValue)
+	default:
+		hash = emptyHash
+	}
+
+	for i := depth - 1; i >= 0; i-- {
+		if bit(path, i) == 0 {
+			hash = internalHash(hash, proof.Siblings[i])
+		} else {
+			hash = internalHash(proof.Siblings[i], hash)
+		}
+	}
+	return bytes.Equal(hash, root)
+}
+
+func (t *Tree) update(hash []byte, depth int, path, value []byte) ([]byte, error) {
+	if isEmpty(hash) {
+		if value == nil {
+			return emptyHash, nil
+		}
+		return t.setLeaf(path, value)
+	}
+
+	data, err := t.load(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if data[0] == leafFlag {
+		leafPath := data[1 : 1+HashSize]
+		if bytes.Equal(leafPath, path) {
+			if value == nil {
+				return emptyHash, nil
+			}
+			return t.setLeaf(path, value)
+		}
+		if value == nil {
+			return hash, nil
+		}
+		leaf, err := t.setLeaf(path, value)
+		if err != nil {
+			return nil, err
+		}
+		return t.split(depth, hash, leafPath, leaf, path)
+	}
+
+	left, right := child(data, 0), child(data, 1)
+	if bit(path, depth) == 0 {
+		left, err = t.update(left, depth+1, path, value)
+	} else {
+		right, err = t.update(right, depth+1, path, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.setInternal(left, right)
+}
+
+// 两个叶子放到同一个子树中，在路径第一个不同的位置分开
+func (t *Tree) split(depth int, hashA, pathA, hashB, pathB []byte) ([]byte, error) {
+	bitA, bitB := bit(pathA, depth), bit(pathB, depth)
+	if bitA != bitB {
+		if bitA == 0 {
+			return t.setInternal(hashA, hashB)
+		}
+		return t.setInternal(hashB, hashA)
+	}
+
+	sub, err := t.split(depth+1, hashA, pathA, hashB, pathB)
+	if err != nil {
+		return nil, err
+	}
+	if bitA == 0 {
+		return t.setInternal(sub, emptyHash)
+	}
+	return t.setInternal(emptyHash, sub)
+}
+
+func (t *Tree) setLeaf(path, value []byte) ([]byte, error) {
+	data := make([]byte, 0, 1+HashSize+len(value))
+	data = append(data, leafFlag)
+	data = append(data, path...)
+	data = append(data, value...)
+
+	hash := leafHash(path, value)
+	if err := t.store.Set(nodeKey(hash), data); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+// 删除后只剩一个叶子的子树收缩成该叶子
+func (t *Tree) setInternal(left, right []byte) ([]byte, error) {
+	if isEmpty(left) && isEmpty(right) {
+		return emptyHash, nil
+	}
+	if isEmpty(left) || isEmpty(right) {
+		other := left
+		if isEmpty(left) {
+			other = right
+		}
+		data, err := t.load(other)
+		if err != nil {
+			return nil, err
+		}
+		if data[0] == leafFlag {
+			return other, nil
+		}
+	}
+
+	data := make([]byte, 0, 1+2*HashSize)
+	data = append(data, internalFlag)
+	data = append(data, left...)
+	data = append(data, right...)
+
+	hash := internalHash(left, right)
+	if err := t.store.Set(nodeKey(hash), data); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+func (t *Tree) load(hash []byte) ([]byte, error) {
+	data, err := t.store.Get(nodeKey(hash))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 1+HashSize || (data[0] == internalFlag && len(data) != 1+2*HashSize) {
+		return nil, errNodeData
+	}
+	return data, nil
+}
+
+func leafHash(path, value []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafFlag})
+	h.Write(path)
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+func internalHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{internalFlag})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+func nodeKey(hash []byte) []byte {
+	key := make([]byte, 0, len(NodePrefix)+len(hash))
+	key = append(key, NodePrefix...)
+	return append(key, hash...)
+}
+
+func keyPath(key []byte) []byte {
+	path := sha256.Sum256(key)
+	return path[:]
+}
+
+func child(data []byte, b int) []byte {
+	if b == 0 {
+		return data[1 : 1+HashSize]
+	}
+	return data[1+HashSize : 1+2*HashSize]
+}
+
+func bit(path []byte, i int) int {
+	return int(path[i/8]>>(7-uint(i%8))) & 1
+}
+
+func isEmpty(hash []byte) bool {
+	return bytes.Equal(hash, emptyHash)
+}
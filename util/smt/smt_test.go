@@ -0,0 +1,105 @@
+package smt
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestUpdateOrder(t *testing.T) {
+	a, b := New(MemStore{}, nil), New(MemStore{}, nil)
+	for i := 0; i < 100; i++ {
+		if err := a.Update([]byte(fmt.Sprint(i)), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 99; i >= 0; i-- {
+		if err := b.Update([]byte(fmt.Sprint(i)), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(a.Root(), b.Root()) {
+		t.Fatalf("root depends on insertion order: %x %x", a.Root(), b.Root())
+	}
+
+	for i := 0; i < 100; i++ {
+		v, err := a.Get([]byte(fmt.Sprint(i)))
+		if err != nil || !bytes.Equal(v, []byte{byte(i)}) {
+			t.Fatalf("get %d = %x, %v", i, v, err)
+		}
+	}
+	if v, err := a.Get([]byte("missing")); err != nil || v != nil {
+		t.Fatalf("get missing = %x, %v", v, err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tree := New(MemStore{}, nil)
+	tree.Update([]byte("a"), []byte("1"))
+	root := tree.Root()
+
+	tree.Update([]byte("b"), []byte("2"))
+	tree.Update([]byte("c"), []byte("3"))
+	tree.Update([]byte("b"), nil)
+	tree.Update([]byte("c"), nil)
+	if !bytes.Equal(tree.Root(), root) {
+		t.Fatalf("root after delete = %x, want %x", tree.Root(), root)
+	}
+
+	tree.Update([]byte("a"), nil)
+	if !bytes.Equal(tree.Root(), EmptyRoot()) {
+		t.Fatalf("root of empty tree = %x", tree.Root())
+	}
+}
+
+func TestHistoricalRoot(t *testing.T) {
+	store := MemStore{}
+	tree := New(store, nil)
+	tree.Update([]byte("a"), []byte("1"))
+	old := tree.Root()
+	tree.Update([]byte("a"), []byte("2"))
+
+	v, err := New(store, old).Get([]byte("a"))
+	if err != nil || !bytes.Equal(v, []byte("1")) {
+		t.Fatalf("get from old root = %s, %v", v, err)
+	}
+}
+
+func TestProof(t *testing.T) {
+	tree := New(MemStore{}, nil)
+	for i := 0; i < 20; i++ {
+		tree.Update([]byte(fmt.Sprint(i)), []byte(fmt.Sprint("v", i)))
+	}
+	root := tree.Root()
+
+	for i := 0; i < 20; i++ {
+		key := []byte(fmt.Sprint(i))
+		proof, err := tree.Prove(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyProof(root, key, []byte(fmt.Sprint("v", i)), proof) {
+			t.Fatalf("failed to verify proof of %d", i)
+		}
+		if VerifyProof(root, key, []byte("wrong"), proof) {
+			t.Fatalf("verified wrong value of %d", i)
+		}
+		if VerifyProof(root, key, nil, proof) {
+			t.Fatalf("verified absence of %d", i)
+		}
+	}
+
+	for i := 20; i < 40; i++ {
+		key := []byte(fmt.Sprint(i))
+		proof, err := tree.Prove(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyProof(root, key, nil, proof) {
+			t.Fatalf("failed to verify absence of %d", i)
+		}
+		if VerifyProof(root, key, []byte("v"), proof) {
+			t.Fatalf("verified presence of %d", i)
+		}
+	}
+}
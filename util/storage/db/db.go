@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"io"
 	"kortho/util/mixed"
 	"kortho/util/storage"
 
@@ -268,6 +269,19 @@ func (db *bgStore) NewTransaction() storage.Transaction {
 	return &bgTransaction{tx}
 }
 
+func (db *bgStore) Backup(w io.Writer) error {
+	_, err := db.db.Backup(w, 0)
+	return err
+}
+
+//清空数据库后从备份中恢复
+func (db *bgStore) Restore(r io.Reader) error {
+	if err := db.db.DropAll(); err != nil {
+		return err
+	}
+	return db.db.Load(r, 256)
+}
+
 func (tx *bgTransaction) Cancel() error {
 	tx.tx.Discard()
 	return nil
@@ -1,6 +1,9 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"io"
+)
 
 var (
 	NotExist  = errors.New("NotExist")
@@ -44,6 +47,9 @@ type DB interface {
 	Zrange([]byte, int32, int32) ([][]byte, error)
 
 	NewTransaction() Transaction
+
+	Backup(io.Writer) error
+	Restore(io.Reader) error
 }
 
 type Transaction interface {